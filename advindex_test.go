@@ -1,8 +1,13 @@
 package jvzc
 
 import (
+	"errors"
 	"io/ioutil"
 	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 )
 
@@ -237,3 +242,378 @@ func testMultiIndex(t *testing.T, compression bool) {
 		t.Fatal("error should be ErrEndOfRange, but isn't")
 	}
 }
+
+func TestMultiIndexUpdate(t *testing.T) {
+	if testing.Short() {
+		t.Parallel()
+	}
+
+	dir, err := ioutil.TempDir("", "jvzc_")
+	panicNotNil(err)
+
+	t.Log("testing directory:", dir)
+	defer func() {
+		if !t.Failed() {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	db, err := Open(dir + "/data")
+	panicNotNil(err)
+
+	defer db.Close()
+
+	db.OnWarning = func(w Warning) {
+		t.Error("unexpected warning:", w)
+	}
+
+	panicNotNil(db.NewTable("index_testing"))
+	table := db.Table("index_testing")
+	panicNotNil(table.NewIndex("Likes.*"))
+
+	jason := Person{Name: "Jason", Likes: []string{"go", "js"}}
+	panicNotNil(table.Set("jason", jason))
+
+	expectLikes := func(like string, count int64) {
+		n, err := table.Index("Likes.*").GetAll(like).Count()
+		panicNotNil(err)
+
+		if n != count {
+			t.Fatal("count of", like, "should be", count, "but is", n)
+		}
+	}
+
+	expectLikes("go", 1)
+	expectLikes("js", 1)
+
+	jason.Likes = []string{"go", "rust", "rust"}
+	panicNotNil(table.Set("jason", jason))
+
+	expectLikes("go", 1)
+	expectLikes("js", 0)
+	expectLikes("rust", 1)
+
+	r := table.Index("Likes.*").GetAll("rust")
+	expectPerson("jason", r, jason)
+	r.Close()
+
+	jason.Likes = nil
+	panicNotNil(table.Set("jason", jason))
+
+	expectLikes("go", 0)
+	expectLikes("rust", 0)
+
+	if table.Index("Likes.*").CountBetween(MinValue, MaxValue) != 0 {
+		t.Fatal("index should be empty, but isn't")
+	}
+}
+
+func TestUniqueMultiIndex(t *testing.T) {
+	if testing.Short() {
+		t.Parallel()
+	}
+
+	dir, err := ioutil.TempDir("", "jvzc_")
+	panicNotNil(err)
+
+	t.Log("testing directory:", dir)
+	defer func() {
+		if !t.Failed() {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	db, err := Open(dir + "/data")
+	panicNotNil(err)
+
+	panicNotNil(db.NewTable("unique_testing"))
+	table := db.Table("unique_testing")
+
+	jason := Person{Name: "Jason", City: "Sydney", Age: 18}
+	panicNotNil(table.Set("jason", jason))
+	panicNotNil(table.Set("jason2", jason))
+
+	err = table.NewUniqueMultiIndex("name_city", "Name", "City")
+	if !errors.Is(err, ErrNotUnique) {
+		t.Fatal("error should be ErrNotUnique, but is", err)
+	}
+
+	if table.Index("name_city") != nil {
+		t.Fatal("index should not exist, but does")
+	}
+
+	if table.NewUniqueMultiIndex("bad", "Name", "") != ErrBadIdentifier {
+		t.Fatal("error should be ErrBadIdentifier, but isn't")
+	}
+
+	panicNotNil(table.Delete("jason2"))
+	panicNotNil(table.NewUniqueMultiIndex("name_city", "Name", "City"))
+
+	// The fields may be shared, but not their combination.
+	panicNotNil(table.Set("jason_melbourne", Person{Name: "Jason",
+		City: "Melbourne", Age: 19}))
+	panicNotNil(table.Set("ben", Person{Name: "Ben", City: "Sydney", Age: 19}))
+
+	err = table.Set("other", Person{Name: "Jason", City: "Sydney", Age: 20})
+	if !errors.Is(err, ErrNotUnique) {
+		t.Fatal("error should be ErrNotUnique, but is", err)
+	}
+
+	_, err = table.Get("other", nil)
+	if err != ErrNotFound {
+		t.Fatal("document should not be written, but is")
+	}
+
+	err = table.Update("ben", func(p Person) (Person, error) {
+		p.Name = "Jason"
+		return p, nil
+	})
+	if !errors.Is(err, ErrNotUnique) {
+		t.Fatal("error should be ErrNotUnique, but is", err)
+	}
+
+	// A document may be written again with the same values.
+	jason.Age = 21
+	panicNotNil(table.Set("jason", jason))
+
+	// Only one of several concurrent writes of the same values succeeds.
+	var wg sync.WaitGroup
+	var written int32
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			err := table.Set("perth"+strconv.Itoa(i), Person{Name: "Drew",
+				City: "Perth"})
+			if err == nil {
+				atomic.AddInt32(&written, 1)
+			} else if !errors.Is(err, ErrNotUnique) {
+				panicNotNil(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if written != 1 {
+		t.Fatal("one write should succeed, but", written, "did")
+	}
+
+	db.Close()
+
+	db, err = Open(dir + "/data")
+	panicNotNil(err)
+
+	defer db.Close()
+
+	table = db.Table("unique_testing")
+	if !table.Config().Indexes[0].Options.Unique {
+		t.Fatal("index should be unique after reopening, but isn't")
+	}
+
+	err = table.Insert("other", Person{Name: "Ben", City: "Sydney"})
+	if !errors.Is(err, ErrNotUnique) {
+		t.Fatal("error should be ErrNotUnique, but is", err)
+	}
+
+	r := table.Index("name_city").GetAll([]interface{}{"Jason", "Sydney"})
+	expectPerson("jason", r, jason)
+	r.Close()
+}
+
+func TestCoveringIndex(t *testing.T) {
+	if testing.Short() {
+		t.Parallel()
+	}
+
+	dir, err := ioutil.TempDir("", "jvzc_")
+	panicNotNil(err)
+
+	t.Log("testing directory:", dir)
+	defer func() {
+		if !t.Failed() {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	db, err := Open(dir + "/data")
+	panicNotNil(err)
+
+	panicNotNil(db.NewTable("covering_testing"))
+	table := db.Table("covering_testing")
+
+	panicNotNil(table.Set("jason", Person{Name: "Jason", City: "Sydney",
+		Age: 18}))
+	panicNotNil(table.Set("ben", Person{Name: "Ben", City: "Sydney", Age: 19}))
+
+	panicNotNil(table.NewCoveringIndex("CityNames", "City", "Name", "Age"))
+	panicNotNil(table.NewIndex("City"))
+
+	type projection struct {
+		Name string
+		Age  int
+	}
+
+	expectProjections := func(city string, keys []string,
+		expected []projection) {
+		r, err := table.Index("CityNames").GetAllProjected(city)
+		panicNotNil(err)
+
+		if r.Len() != len(keys) {
+			t.Fatal("range should have", len(keys), "projections, but has",
+				r.Len())
+		}
+
+		for i := 0; r.Next(); i++ {
+			var p projection
+			panicNotNil(r.Decode(&p))
+
+			if r.Key() != keys[i] || p != expected[i] {
+				t.Fatal("projection should be", keys[i], expected[i],
+					"but is", r.Key(), p)
+			}
+		}
+	}
+
+	expectProjections("Sydney", []string{"ben", "jason"},
+		[]projection{{"Ben", 19}, {"Jason", 18}})
+
+	// Changing a projected field updates the projection, even though the
+	// index value is the same.
+	panicNotNil(table.Set("jason", Person{Name: "Jason", City: "Sydney",
+		Age: 20}))
+	expectProjections("Sydney", []string{"ben", "jason"},
+		[]projection{{"Ben", 19}, {"Jason", 20}})
+
+	panicNotNil(table.Set("ben", Person{Name: "Ben", City: "Perth", Age: 19}))
+	panicNotNil(table.Set("alice", Person{Name: "Alice", City: "Perth",
+		Age: 21}))
+	expectProjections("Sydney", []string{"jason"},
+		[]projection{{"Jason", 20}})
+	expectProjections("Perth", []string{"alice", "ben"},
+		[]projection{{"Alice", 21}, {"Ben", 19}})
+
+	panicNotNil(table.Delete("alice"))
+	expectProjections("Perth", []string{"ben"}, []projection{{"Ben", 19}})
+
+	n, err := table.Index("CityNames").GetAll("Perth").Count()
+	panicNotNil(err)
+
+	if n != 1 {
+		t.Fatal("count should be 1, but is", n)
+	}
+
+	report, err := table.Index("CityNames").Verify()
+	panicNotNil(err)
+
+	if !report.OK() {
+		t.Fatal("index should be consistent, but isn't:", report)
+	}
+
+	if _, err := table.Index("City").GetAllProjected("Perth"); err == nil {
+		t.Fatal("reading projections of a normal index should fail, but " +
+			"didn't")
+	}
+
+	if table.NewCoveringIndex("NoFields", "City") != ErrBadIdentifier {
+		t.Fatal("error should be ErrBadIdentifier, but isn't")
+	}
+
+	db.Close()
+
+	db, err = Open(dir + "/data")
+	panicNotNil(err)
+
+	defer db.Close()
+
+	table = db.Table("covering_testing")
+
+	config := table.Config()
+	for _, index := range config.Indexes {
+		if index.Name == "CityNames" &&
+			(len(index.Options.Project) != 2 || !index.Options.PerKey) {
+			t.Fatal("index should be covering, but isn't:", index)
+		}
+	}
+
+	panicNotNil(table.Set("ben", Person{Name: "Benjamin", City: "Perth",
+		Age: 19}))
+	expectProjections("Perth", []string{"ben"},
+		[]projection{{"Benjamin", 19}})
+}
+
+func TestIndexKind(t *testing.T) {
+	if testing.Short() {
+		t.Parallel()
+	}
+
+	dir, err := ioutil.TempDir("", "jvzc_")
+	panicNotNil(err)
+
+	t.Log("testing directory:", dir)
+	defer func() {
+		if !t.Failed() {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	db, err := Open(dir + "/data")
+	panicNotNil(err)
+
+	panicNotNil(db.NewTable("kind_testing"))
+	table := db.Table("kind_testing")
+
+	panicNotNil(table.NewIndex("City"))
+	panicNotNil(table.NewIndex("City,Age"))
+	panicNotNil(table.NewIndex("Likes.*"))
+	panicNotNil(table.NewUniqueMultiIndex("NameCity", "Name", "City"))
+	panicNotNil(table.NewPartialIndex("Adults", "Age",
+		func(doc Document) bool {
+			return doc.QueryInt("Age") >= 18
+		}))
+	panicNotNil(table.NewCoveringIndex("CityNames", "City", "Name"))
+
+	expected := []struct {
+		name   string
+		kind   IndexKind
+		fields string
+	}{
+		{"City", 0, "City"},
+		{"City,Age", IndexCompound, "City Age"},
+		{"Likes.*", IndexMulti, "Likes.*"},
+		{"NameCity", IndexCompound | IndexUnique, "Name City"},
+		{"Adults", IndexPartial, "Age"},
+		{"CityNames", IndexCovering, "City"},
+	}
+
+	check := func() {
+		for _, test := range expected {
+			index := table.Index(test.name)
+			if index.Kind() != test.kind {
+				t.Fatal("kind of", test.name, "should be", test.kind,
+					"but is", index.Kind())
+			}
+
+			if strings.Join(index.Fields(), " ") != test.fields {
+				t.Fatal("fields of", test.name, "should be", test.fields,
+					"but are", index.Fields())
+			}
+		}
+	}
+
+	check()
+
+	if !table.Index("NameCity").Kind().Has(IndexUnique) ||
+		table.Index("NameCity").Kind().Has(IndexUnique|IndexPartial) {
+		t.Fatal("kind should only have IndexUnique, but doesn't")
+	}
+
+	db.Close()
+
+	db, err = Open(dir + "/data")
+	panicNotNil(err)
+
+	defer db.Close()
+
+	table = db.Table("kind_testing")
+	check()
+}
@@ -0,0 +1,182 @@
+package jvzc
+
+import (
+	"errors"
+	"io"
+	"os"
+
+	"github.com/1lann/msgpack"
+)
+
+// backupEntry is a document written by BackupSince.
+type backupEntry struct {
+	Key     string
+	Counter uint64
+	Value   []byte
+}
+
+// Backup copies every table of the database into a new database in dir,
+// which must not exist yet. The documents of up to workers tables are copied
+// at a time, each table being stored in its own directory, and the config of
+// the backup lists its tables and their directories. The backup can be opened
+// with Open, or restored with Restore.
+//
+// Documents are copied as they are read, so documents written during the
+// backup may or may not be included. Indexes are created with the same
+// queries, options and predicates as those of the database, and documents
+// are not encrypted in the backup. The progress of each table is reported to
+// OnProgress under the "import" operation.
+func (d *DB) Backup(dir string, workers int) error {
+	if _, err := os.Stat(dir); err == nil {
+		return ErrAlreadyExists
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	backup, err := Open(dir)
+	if err != nil {
+		return err
+	}
+
+	defer backup.Close()
+
+	backup.OnProgress = d.OnProgress
+
+	return backup.importTables(d, DuplicateError, workers)
+}
+
+// Restore copies every table of the backup in dir into the database, like
+// ImportFrom, with the documents of up to workers tables being copied at a
+// time. You can optionally specify what to do with documents whose key
+// already exists, which is DuplicateError by default. ErrNotFound is returned
+// if dir does not exist. As predicates aren't persisted, partial indexes of
+// the backup which don't exist in the database yet can't be restored, and
+// should be created before restoring.
+func (d *DB) Restore(dir string, workers int,
+	onDuplicate ...DuplicatePolicy) error {
+	if dir == d.path {
+		return errors.New("jvzc: cannot restore a database into itself")
+	}
+
+	if ex, err := exists(dir); err != nil {
+		return err
+	} else if !ex {
+		return ErrNotFound
+	}
+
+	policy := DuplicateError
+	if len(onDuplicate) > 0 {
+		policy = onDuplicate[0]
+	}
+
+	backup, err := Open(dir)
+	if err != nil {
+		return err
+	}
+
+	defer backup.Close()
+
+	return d.importTables(backup, policy, workers)
+}
+
+// BackupSince writes the documents of the table whose counter is greater
+// than sinceVersion to w, and returns the greatest counter written, or
+// sinceVersion if no documents were written. The counters of a table only
+// increase, so the returned version can be passed to the next call to only
+// write the documents changed since, which can be read back into a table with
+// RestoreBackup. A sinceVersion of 0 writes every document.
+//
+// Deleted documents are not written, use the change log to track them.
+// Documents written during the backup may or may not be included, and if not,
+// may also be missed by later backups, so writes should be paused while the
+// backup runs.
+func (t *Table) BackupSince(sinceVersion uint64, w io.Writer) (uint64,
+	error) {
+	r := t.All()
+	defer r.Close()
+
+	version := sinceVersion
+	enc := msgpack.NewEncoder(w)
+
+	for r.Next() {
+		if r.Counter() <= sinceVersion {
+			continue
+		}
+
+		value := r.lastEntry.data
+		if t.keyToCompressed != nil {
+			var err error
+			value, err = t.toPlain(value)
+			if err != nil {
+				return sinceVersion, err
+			}
+		}
+
+		err := enc.Encode(backupEntry{
+			Key:     r.Key(),
+			Counter: r.Counter(),
+			Value:   value,
+		})
+		if err != nil {
+			return sinceVersion, err
+		}
+
+		if r.Counter() > version {
+			version = r.Counter()
+		}
+	}
+
+	if r.Error() != ErrEndOfRange {
+		return sinceVersion, r.Error()
+	}
+
+	return version, nil
+}
+
+// RestoreBackup reads documents written by BackupSince from r into the table,
+// replacing documents with the same key. Backups should be restored in the
+// order they were written. Like ImportFrom, documents are written in batches,
+// and the documents restored before an error remain in the table.
+func (t *Table) RestoreBackup(r io.Reader) error {
+	dec := msgpack.NewDecoder(r)
+	batch := make([]importEntry, 0, importBatchSize)
+
+	var indexErr error
+
+	for {
+		var entry backupEntry
+		err := dec.Decode(&entry)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+
+		var value interface{}
+		if err = msgpack.Unmarshal(entry.Value, &value); err != nil {
+			return err
+		}
+
+		data, err := t.marshal(value)
+		if err != nil {
+			return err
+		}
+
+		batch = append(batch, importEntry{key: entry.Key, data: data})
+		if len(batch) == importBatchSize {
+			err := t.importBatch(batch, DuplicateOverwrite)
+			if err = keepIndexError(&indexErr, err); err != nil {
+				return err
+			}
+
+			batch = batch[:0]
+		}
+	}
+
+	err := t.importBatch(batch, DuplicateOverwrite)
+	if err = keepIndexError(&indexErr, err); err != nil {
+		return err
+	}
+
+	return indexErr
+}
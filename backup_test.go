@@ -0,0 +1,194 @@
+package jvzc
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"testing"
+)
+
+func TestBackup(t *testing.T) {
+	if testing.Short() {
+		t.Parallel()
+	}
+
+	dir, err := ioutil.TempDir("", "jvzc_")
+	panicNotNil(err)
+
+	t.Log("testing directory:", dir)
+	defer func() {
+		if !t.Failed() {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	db, err := Open(dir + "/data")
+	panicNotNil(err)
+
+	defer db.Close()
+
+	tables := []string{"people_a", "people_b", "people_c"}
+	for i, name := range tables {
+		panicNotNil(db.NewTable(name, i != 0))
+		panicNotNil(db.Table(name).NewIndex("City"))
+
+		for j := 0; j < 150; j++ {
+			panicNotNil(db.Table(name).Set("person"+strconv.Itoa(j),
+				Person{Name: "Person", City: "Sydney", Age: j}))
+		}
+	}
+
+	jason := Person{Name: "Jason", City: "Melbourne", Age: 18}
+	panicNotNil(db.Table("people_b").Set("jason", jason))
+
+	panicNotNil(db.Backup(dir+"/backup", 2))
+
+	if db.Backup(dir+"/backup", 2) != ErrAlreadyExists {
+		t.Fatal("error should be ErrAlreadyExists, but isn't")
+	}
+
+	backup, err := Open(dir + "/backup")
+	panicNotNil(err)
+
+	for _, name := range tables {
+		if backup.Table(name) == nil {
+			t.Fatal("table", name, "should exist, but doesn't")
+		}
+
+		n, err := backup.Table(name).Index("City").GetAll("Sydney").Count()
+		panicNotNil(err)
+
+		if n != 150 {
+			t.Fatal("count should be 150, but is", n)
+		}
+	}
+
+	backup.Close()
+
+	if db.Restore(dir+"/missing", 2) != ErrNotFound {
+		t.Fatal("error should be ErrNotFound, but isn't")
+	}
+
+	if db.Restore(dir+"/backup", 2) != ErrAlreadyExists {
+		t.Fatal("error should be ErrAlreadyExists, but isn't")
+	}
+
+	restored, err := Open(dir + "/restored")
+	panicNotNil(err)
+
+	defer restored.Close()
+
+	panicNotNil(restored.Restore(dir+"/backup", 3))
+
+	for _, name := range tables {
+		n, err := restored.Table(name).All().Count()
+		panicNotNil(err)
+
+		expected := 150
+		if name == "people_b" {
+			expected = 151
+		}
+
+		if n != int64(expected) {
+			t.Fatal("count should be", expected, "but is", n)
+		}
+	}
+
+	expectPerson("jason",
+		restored.Table("people_b").Index("City").GetAll("Melbourne"), jason)
+}
+
+func TestBackupSince(t *testing.T) {
+	if testing.Short() {
+		t.Parallel()
+	}
+
+	dir, err := ioutil.TempDir("", "jvzc_")
+	panicNotNil(err)
+
+	t.Log("testing directory:", dir)
+	defer func() {
+		if !t.Failed() {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	db, err := Open(dir + "/data")
+	panicNotNil(err)
+
+	defer db.Close()
+
+	panicNotNil(db.NewTable("backup_testing"))
+	table := db.Table("backup_testing")
+
+	panicNotNil(db.NewTable("restore_testing", false))
+	restored := db.Table("restore_testing")
+	panicNotNil(restored.NewIndex("City"))
+
+	jason := Person{Name: "Jason", City: "Sydney", Age: 18}
+	ben := Person{Name: "Ben", City: "Melbourne", Age: 19}
+	panicNotNil(table.Set("jason", jason))
+	panicNotNil(table.Set("ben", ben))
+
+	var full bytes.Buffer
+	version, err := table.BackupSince(0, &full)
+	panicNotNil(err)
+
+	if version == 0 {
+		t.Fatal("version should not be 0, but is")
+	}
+
+	jason.City = "Perth"
+	alice := Person{Name: "Alice", City: "Perth", Age: 20}
+	panicNotNil(table.Set("jason", jason))
+	panicNotNil(table.Set("alice", alice))
+
+	var incremental bytes.Buffer
+	newVersion, err := table.BackupSince(version, &incremental)
+	panicNotNil(err)
+
+	if newVersion <= version {
+		t.Fatal("version should increase, but doesn't")
+	}
+
+	var empty bytes.Buffer
+	lastVersion, err := table.BackupSince(newVersion, &empty)
+	panicNotNil(err)
+
+	if lastVersion != newVersion || empty.Len() != 0 {
+		t.Fatal("backup should be empty, but isn't")
+	}
+
+	panicNotNil(restored.RestoreBackup(&full))
+
+	n, err := restored.All().Count()
+	panicNotNil(err)
+
+	if n != 2 {
+		t.Fatal("count should be 2, but is", n)
+	}
+
+	panicNotNil(restored.RestoreBackup(&incremental))
+
+	r := restored.All()
+	expectPerson("alice", r, alice)
+	expectPerson("ben", r, ben)
+	expectPerson("jason", r, jason)
+	if r.Next() {
+		t.Fatal("range should have 3 documents, but doesn't")
+	}
+	r.Close()
+
+	r = restored.Index("City").GetAll("Perth")
+	expectPerson("alice", r, alice)
+	expectPerson("jason", r, jason)
+	r.Close()
+
+	n, err = restored.Index("City").GetAll("Sydney").Count()
+	panicNotNil(err)
+
+	if n != 0 {
+		t.Fatal("count should be 0, but is", n)
+	}
+}
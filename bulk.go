@@ -0,0 +1,102 @@
+package jvzc
+
+import (
+	"sync/atomic"
+
+	"github.com/1lann/badger"
+)
+
+// bulkBatchSize is the number of index entries deleted in a single batch
+// when an index is cleared.
+const bulkBatchSize = 1000
+
+// BulkLoad calls fn with a function which writes documents to the table like
+// Set, but without updating the indexes of the table. Once fn returns, every
+// index of the table is rebuilt from the documents of the table, which is
+// much faster than updating the indexes as each document is written. The
+// error returned by fn is returned after the indexes are rebuilt.
+//
+// While the table is being bulk loaded, writes to the table from anywhere
+// don't update its indexes, and queries on the indexes return incomplete
+// results. If the process stops before the indexes are rebuilt, they are left
+// stale, and can be checked with Verify.
+func (t *Table) BulkLoad(fn func(set func(key string,
+	value interface{}) error) error) error {
+	atomic.AddInt32(&t.bulkLoads, 1)
+
+	err := fn(func(key string, value interface{}) error {
+		return t.Set(key, value)
+	})
+
+	// Concurrent bulk loads rebuild the indexes once the last one completes.
+	if atomic.AddInt32(&t.bulkLoads, -1) > 0 {
+		return err
+	}
+
+	for _, indexName := range t.Indexes() {
+		rebuildErr := t.Index(indexName).rebuild(defaultReindexWorkers)
+		if rebuildErr != nil {
+			return rebuildErr
+		}
+	}
+
+	return err
+}
+
+// deferIndexes returns whether index updates are deferred because the table
+// is being bulk loaded.
+func (t *Table) deferIndexes() bool {
+	return atomic.LoadInt32(&t.bulkLoads) > 0
+}
+
+// rebuild clears the index and indexes every document of the table again
+// with the number of workers.
+func (i *Index) rebuild(workers int) error {
+	if i.partial && i.getPredicate() == nil {
+		return errNoPredicate
+	}
+
+	if err := i.clear(); err != nil {
+		return err
+	}
+
+	return i.indexValues(workers)
+}
+
+// clear deletes every entry of the index.
+func (i *Index) clear() error {
+	if err := i.table.db.acquire(); err != nil {
+		return err
+	}
+	defer i.table.db.release()
+
+	if err := i.table.acquireRange(i); err != nil {
+		return err
+	}
+	defer i.table.releaseRange()
+
+	itOpts := badger.DefaultIteratorOptions
+	itOpts.PrefetchValues = false
+	it := i.index.NewIterator(itOpts)
+	defer it.Close()
+
+	var entries []*badger.Entry
+	for it.Rewind(); it.Valid(); it.Next() {
+		key := append([]byte(nil), it.Item().Key()...)
+		entries = badger.EntriesDelete(entries, key)
+
+		if len(entries) >= bulkBatchSize {
+			if err := i.index.BatchSet(entries); err != nil {
+				return err
+			}
+
+			entries = entries[:0]
+		}
+	}
+
+	if len(entries) == 0 {
+		return nil
+	}
+
+	return i.index.BatchSet(entries)
+}
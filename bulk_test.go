@@ -0,0 +1,141 @@
+package jvzc
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"testing"
+)
+
+func TestBulkLoad(t *testing.T) {
+	if testing.Short() {
+		t.Parallel()
+	}
+
+	dir, err := ioutil.TempDir("", "jvzc_")
+	panicNotNil(err)
+
+	t.Log("testing directory:", dir)
+	defer func() {
+		if !t.Failed() {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	db, err := Open(dir + "/data")
+	panicNotNil(err)
+
+	defer db.Close()
+
+	panicNotNil(db.NewTable("bulk_testing"))
+	table := db.Table("bulk_testing")
+	panicNotNil(table.NewIndex("City"))
+	panicNotNil(table.NewIndex("Age"))
+
+	panicNotNil(table.Set("jason", Person{Name: "Jason", City: "Sydney", Age: 18}))
+
+	errLoad := errors.New("load failed")
+	err = table.BulkLoad(func(set func(key string,
+		value interface{}) error) error {
+		for i := 0; i < 500; i++ {
+			err := set(strconv.Itoa(i), Person{
+				Name: "Person " + strconv.Itoa(i),
+				City: []string{"Sydney", "Melbourne"}[i%2],
+				Age:  i % 50,
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		err := set("jason", Person{Name: "Jason", City: "Perth", Age: 18})
+		if err != nil {
+			return err
+		}
+
+		return errLoad
+	})
+	if err != errLoad {
+		t.Fatal("error should be the error of the load, but is", err)
+	}
+
+	counts := map[string]int64{"Sydney": 250, "Melbourne": 250, "Perth": 1}
+	for city, expected := range counts {
+		n, err := table.Index("City").GetAll(city).Count()
+		panicNotNil(err)
+
+		if n != expected {
+			t.Fatal(city, "should have", expected, "documents, but has", n)
+		}
+	}
+
+	report, err := db.Check()
+	panicNotNil(err)
+
+	if !report.OK() {
+		t.Fatal("indexes should be consistent, but aren't:", report)
+	}
+
+	panicNotNil(table.Set("jason", Person{Name: "Jason", City: "Sydney", Age: 18}))
+
+	n, err := table.Index("City").GetAll("Sydney").Count()
+	panicNotNil(err)
+
+	if n != 251 {
+		t.Fatal("indexes should be updated after the load, but aren't")
+	}
+}
+
+func BenchmarkBulkLoad(b *testing.B) {
+	benchmarks := []struct {
+		name string
+		load func(table *Table, n int) error
+	}{
+		{"Set", func(table *Table, n int) error {
+			for i := 0; i < n; i++ {
+				err := table.Set(strconv.Itoa(i),
+					Person{Name: "Jason", City: "Sydney", Age: i})
+				if err != nil {
+					return err
+				}
+			}
+
+			return nil
+		}},
+		{"BulkLoad", func(table *Table, n int) error {
+			return table.BulkLoad(func(set func(key string,
+				value interface{}) error) error {
+				for i := 0; i < n; i++ {
+					err := set(strconv.Itoa(i),
+						Person{Name: "Jason", City: "Sydney", Age: i})
+					if err != nil {
+						return err
+					}
+				}
+
+				return nil
+			})
+		}},
+	}
+
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			dir, err := ioutil.TempDir("", "jvzc_")
+			panicNotNil(err)
+			defer os.RemoveAll(dir)
+
+			db, err := Open(dir + "/data")
+			panicNotNil(err)
+			defer db.Close()
+
+			panicNotNil(db.NewTable("bench"))
+			table := db.Table("bench")
+			panicNotNil(table.NewIndex("City"))
+			panicNotNil(table.NewIndex("Age"))
+
+			b.ResetTimer()
+			panicNotNil(bm.load(table, b.N))
+		})
+	}
+}
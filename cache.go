@@ -0,0 +1,200 @@
+package jvzc
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// CachedTable is a table whose Get is served from an in-memory cache of
+// recently read documents, falling back to the table's store for documents
+// which aren't cached. Documents are removed from the cache as soon as they
+// are written to or deleted from the table, including through the table
+// itself rather than the CachedTable, so Get never returns a document older
+// than the last completed write. Concurrent Gets of a document which isn't
+// cached share a single read of the store.
+//
+// The other methods of the table are used as they are, and aren't cached.
+type CachedTable struct {
+	*Table
+
+	maxEntries int
+	ttl        time.Duration
+
+	mutex   *sync.Mutex
+	entries map[string]*list.Element
+	recent  *list.List
+	loads   map[string]*cacheLoad
+
+	removeListener func()
+}
+
+// cacheEntry is a document in the cache of a CachedTable.
+type cacheEntry struct {
+	key     string
+	data    []byte
+	counter uint64
+	expires time.Time
+}
+
+// cacheLoad is a read of a document from the store which Gets of the same
+// document wait for. It is stale if the document was written during the
+// read, in which case the document read isn't cached.
+type cacheLoad struct {
+	done    chan struct{}
+	data    []byte
+	counter uint64
+	err     error
+	stale   bool
+}
+
+// WithCache returns the table with an in-memory cache of up to maxEntries
+// documents, where the least recently read documents are evicted first.
+// Documents are read from the store again once they have been cached for
+// ttl. A maxEntries or ttl of 0 disables the limit. Close should be called
+// once the CachedTable is no longer used, so that writes to the table stop
+// updating its cache.
+func (t *Table) WithCache(maxEntries int, ttl time.Duration) *CachedTable {
+	c := &CachedTable{
+		Table:      t,
+		maxEntries: maxEntries,
+		ttl:        ttl,
+		mutex:      new(sync.Mutex),
+		entries:    make(map[string]*list.Element),
+		recent:     list.New(),
+		loads:      make(map[string]*cacheLoad),
+	}
+
+	c.removeListener = t.addListener(c.invalidate)
+	return c
+}
+
+// Get retrieves a value from the table like Table.Get, from the cache if the
+// document is cached.
+func (c *CachedTable) Get(key string, dst interface{}) (uint64, error) {
+	data, counter, err := c.load(key)
+	if err != nil {
+		return 0, err
+	}
+
+	if dst == nil {
+		return counter, nil
+	}
+
+	return counter, unmarshal(c.Table, data, dst)
+}
+
+// Len returns the number of documents in the cache.
+func (c *CachedTable) Len() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.recent.Len()
+}
+
+// Close empties the cache, and stops writes to the table from updating it.
+// Get reads from the store once the CachedTable is closed.
+func (c *CachedTable) Close() {
+	c.removeListener()
+
+	c.mutex.Lock()
+	c.maxEntries = -1
+	c.entries = make(map[string]*list.Element)
+	c.recent.Init()
+	c.mutex.Unlock()
+}
+
+// load returns the marshalled document with the key and its counter, from
+// the cache or otherwise from the store.
+func (c *CachedTable) load(key string) ([]byte, uint64, error) {
+	c.mutex.Lock()
+
+	if elem, found := c.entries[key]; found {
+		entry := elem.Value.(*cacheEntry)
+		if c.ttl <= 0 || time.Now().Before(entry.expires) {
+			c.recent.MoveToFront(elem)
+			c.mutex.Unlock()
+			return entry.data, entry.counter, nil
+		}
+
+		c.remove(elem)
+	}
+
+	if load, found := c.loads[key]; found {
+		c.mutex.Unlock()
+		<-load.done
+		return load.data, load.counter, load.err
+	}
+
+	load := &cacheLoad{done: make(chan struct{})}
+	c.loads[key] = load
+	c.mutex.Unlock()
+
+	data, counter, err := c.Table.getRaw(key)
+	if err == nil {
+		// The document may be owned by the store, so it is copied before
+		// being cached.
+		load.data = append([]byte(nil), data...)
+		load.counter = counter
+	}
+	load.err = err
+
+	c.mutex.Lock()
+	if c.loads[key] == load {
+		delete(c.loads, key)
+	}
+
+	if err == nil && !load.stale {
+		c.add(key, load.data, load.counter)
+	}
+	c.mutex.Unlock()
+
+	close(load.done)
+	return load.data, load.counter, load.err
+}
+
+// add caches the document, evicting the least recently read documents if the
+// cache is full. The mutex must be held.
+func (c *CachedTable) add(key string, data []byte, counter uint64) {
+	if c.maxEntries < 0 {
+		return
+	}
+
+	if elem, found := c.entries[key]; found {
+		c.remove(elem)
+	}
+
+	entry := &cacheEntry{key: key, data: data, counter: counter}
+	if c.ttl > 0 {
+		entry.expires = time.Now().Add(c.ttl)
+	}
+
+	c.entries[key] = c.recent.PushFront(entry)
+
+	for c.maxEntries > 0 && c.recent.Len() > c.maxEntries {
+		c.remove(c.recent.Back())
+	}
+}
+
+// remove removes a document from the cache. The mutex must be held.
+func (c *CachedTable) remove(elem *list.Element) {
+	c.recent.Remove(elem)
+	delete(c.entries, elem.Value.(*cacheEntry).key)
+}
+
+// invalidate removes the document with the key from the cache once it has
+// been written to or deleted, and stops a read of it which is in progress
+// from being cached, as it may have read the previous document.
+func (c *CachedTable) invalidate(key string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if elem, found := c.entries[key]; found {
+		c.remove(elem)
+	}
+
+	if load, found := c.loads[key]; found {
+		load.stale = true
+		delete(c.loads, key)
+	}
+}
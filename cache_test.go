@@ -0,0 +1,235 @@
+package jvzc
+
+import (
+	"io/ioutil"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCachedTable(t *testing.T) {
+	if testing.Short() {
+		t.Parallel()
+	}
+
+	dir, err := ioutil.TempDir("", "jvzc_")
+	panicNotNil(err)
+
+	t.Log("testing directory:", dir)
+	defer func() {
+		if !t.Failed() {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	db, err := Open(dir + "/data")
+	panicNotNil(err)
+
+	defer db.Close()
+
+	panicNotNil(db.NewTable("cache_testing"))
+	table := db.Table("cache_testing")
+
+	cache := table.WithCache(2, 0)
+	defer cache.Close()
+
+	jason := Person{Name: "Jason", City: "Sydney", Age: 18}
+	ben := Person{Name: "Ben", City: "Melbourne", Age: 19}
+	panicNotNil(table.Set("jason", jason))
+
+	var person Person
+	counter, err := cache.Get("jason", &person)
+	panicNotNil(err)
+	if !person.IsSame(jason) {
+		t.Fatal("person should be jason, but isn't")
+	}
+
+	if cache.Len() != 1 {
+		t.Fatal("cache should have 1 document, but doesn't")
+	}
+
+	cachedCounter, err := cache.Get("jason", nil)
+	panicNotNil(err)
+	if cachedCounter != counter {
+		t.Fatal("counters should be the same, but aren't")
+	}
+
+	// Writes through the table and the cached table invalidate the cache.
+	jason.Age = 20
+	panicNotNil(table.Set("jason", jason))
+	if cache.Len() != 0 {
+		t.Fatal("cache should be empty, but isn't")
+	}
+
+	person = Person{}
+	_, err = cache.Get("jason", &person)
+	panicNotNil(err)
+	if !person.IsSame(jason) {
+		t.Fatal("person should be updated, but isn't")
+	}
+
+	panicNotNil(cache.Update("jason", func(p Person) (Person, error) {
+		p.Age = 21
+		return p, nil
+	}))
+
+	person = Person{}
+	_, err = cache.Get("jason", &person)
+	panicNotNil(err)
+	if person.Age != 21 {
+		t.Fatal("age should be 21, but isn't")
+	}
+
+	panicNotNil(cache.Delete("jason"))
+	if _, err = cache.Get("jason", &person); err != ErrNotFound {
+		t.Fatal("error should be ErrNotFound, but is", err)
+	}
+
+	// The least recently read documents are evicted.
+	panicNotNil(table.Set("jason", jason))
+	panicNotNil(table.Set("ben", ben))
+	panicNotNil(table.Set("drew", ben))
+
+	for _, key := range []string{"jason", "ben", "jason", "drew"} {
+		_, err = cache.Get(key, nil)
+		panicNotNil(err)
+	}
+
+	if cache.Len() != 2 {
+		t.Fatal("cache should have 2 documents, but doesn't")
+	}
+
+	if _, found := cache.entries["ben"]; found {
+		t.Fatal("ben should be evicted, but isn't")
+	}
+
+	cache.Close()
+	if cache.Len() != 0 {
+		t.Fatal("cache should be empty, but isn't")
+	}
+
+	_, err = cache.Get("jason", &person)
+	panicNotNil(err)
+	if cache.Len() != 0 {
+		t.Fatal("closed cache should stay empty, but doesn't")
+	}
+}
+
+func TestCachedTableTTL(t *testing.T) {
+	if testing.Short() {
+		t.Parallel()
+	}
+
+	dir, err := ioutil.TempDir("", "jvzc_")
+	panicNotNil(err)
+
+	t.Log("testing directory:", dir)
+	defer func() {
+		if !t.Failed() {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	db, err := Open(dir + "/data")
+	panicNotNil(err)
+
+	defer db.Close()
+
+	panicNotNil(db.NewTable("cache_testing"))
+	table := db.Table("cache_testing")
+
+	cache := table.WithCache(0, 50*time.Millisecond)
+	defer cache.Close()
+
+	panicNotNil(table.Set("jason", Person{Name: "Jason"}))
+
+	_, err = cache.Get("jason", nil)
+	panicNotNil(err)
+
+	cache.mutex.Lock()
+	expires := cache.entries["jason"].Value.(*cacheEntry).expires
+	cache.mutex.Unlock()
+
+	time.Sleep(100 * time.Millisecond)
+
+	_, err = cache.Get("jason", nil)
+	panicNotNil(err)
+
+	cache.mutex.Lock()
+	reloaded := cache.entries["jason"].Value.(*cacheEntry).expires
+	cache.mutex.Unlock()
+
+	if !reloaded.After(expires) {
+		t.Fatal("expired document should be read again, but isn't")
+	}
+}
+
+func TestCachedTableConcurrent(t *testing.T) {
+	if testing.Short() {
+		t.Parallel()
+	}
+
+	dir, err := ioutil.TempDir("", "jvzc_")
+	panicNotNil(err)
+
+	t.Log("testing directory:", dir)
+	defer func() {
+		if !t.Failed() {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	db, err := Open(dir + "/data")
+	panicNotNil(err)
+
+	defer db.Close()
+
+	panicNotNil(db.NewTable("cache_testing"))
+	table := db.Table("cache_testing")
+
+	cache := table.WithCache(100, 0)
+	defer cache.Close()
+
+	panicNotNil(table.Set("counter", Person{Age: 0}))
+
+	// Every write is followed by a read which must see it, while other
+	// goroutines read the document concurrently.
+	wg := new(sync.WaitGroup)
+	stop := make(chan struct{})
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+
+				_, err := cache.Get("counter", &Person{})
+				panicNotNil(err)
+			}
+		}()
+	}
+
+	for i := 1; i <= 200; i++ {
+		panicNotNil(table.Set("counter", Person{Age: i}))
+
+		var person Person
+		_, err = cache.Get("counter", &person)
+		panicNotNil(err)
+
+		if person.Age != i {
+			close(stop)
+			wg.Wait()
+			t.Fatal("age should be " + strconv.Itoa(i) + ", but is " +
+				strconv.Itoa(person.Age))
+		}
+	}
+
+	close(stop)
+	wg.Wait()
+}
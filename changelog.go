@@ -0,0 +1,230 @@
+package jvzc
+
+import (
+	"encoding/binary"
+	"errors"
+	"sync/atomic"
+
+	"github.com/1lann/badger"
+	"github.com/1lann/msgpack"
+)
+
+var errNoChangeLog = errors.New("jvzc: table has no change log")
+
+// ChangeOp is the kind of a change recorded in a change log.
+type ChangeOp int
+
+// Kinds of changes recorded in a change log.
+const (
+	// ChangeSet is recorded when a document is written.
+	ChangeSet ChangeOp = iota + 1
+	// ChangeDelete is recorded when a document is deleted.
+	ChangeDelete
+)
+
+// Change represents an entry of the change log of a table.
+type Change struct {
+	// Seq is the sequence number of the change, which increases with every
+	// change to the table.
+	Seq uint64
+	Op  ChangeOp
+	// Key is the primary key of the document which was changed.
+	Key string
+	// Counter is the counter of the document after the change.
+	Counter uint64
+}
+
+// SetChangeLog sets whether the table records every document written or
+// deleted from now on in its change log, which can be read with Changes.
+// Unlike the listeners of Tail, the change log is stored, so it survives
+// restarts and can be used to reliably sync the table elsewhere. Disabling
+// the change log keeps the changes already recorded, and the log continues
+// from its last sequence number if it is enabled again.
+//
+// Changes are journaled before the write to the table and logged after it
+// while the document is still locked, so the changes of a document are
+// logged in the order it was written, with the counter of each write. If the
+// process stops between the write and logging its change, the change is
+// logged when the database is next opened, so a change may be logged twice
+// but is never lost. A change may also be logged for a write which raced
+// with another write to the document, so consumers should read the current
+// document of each change rather than rely on there being one change per
+// write.
+func (t *Table) SetChangeLog(enabled bool) error {
+	if err := t.db.lockConfig(); err != nil {
+		return err
+	}
+	defer t.db.configMutex.Unlock()
+
+	tableName := t.name()
+	for i, table := range t.db.config.Tables {
+		if table.TableName != tableName {
+			continue
+		}
+
+		if enabled && t.changes == nil {
+			if err := t.openChangeLog(); err != nil {
+				return err
+			}
+		}
+
+		t.db.config.Tables[i].ChangeLog = enabled
+		if err := t.db.writeConfig(); err != nil {
+			t.db.config.Tables[i].ChangeLog = t.changeLog
+			return err
+		}
+
+		t.changeLog = enabled
+		return nil
+	}
+
+	return ErrNotFound
+}
+
+// Changes returns a Range of the changes recorded in the change log of the
+// table after the sequence number, in the order they were recorded. The key
+// and counter of the range are those of the changed document, and each item
+// decodes into a Change. Use the Seq of the last change processed to resume
+// reading the log later.
+func (t *Table) Changes(sinceSeq uint64) *Range {
+	if t.changes == nil {
+		return newRange(func() (string, []byte, uint64, error) {
+			return "", nil, 0, errNoChangeLog
+		}, func() {}, nil)
+	}
+
+	if err := t.acquireRange(nil); err != nil {
+		return newRange(func() (string, []byte, uint64, error) {
+			return "", nil, 0, err
+		}, func() {}, nil)
+	}
+
+	itOpts := badger.DefaultIteratorOptions
+	itOpts.PrefetchSize = prefetchSize
+	it := t.changes.NewIterator(itOpts)
+	it.Seek(changeKey(sinceSeq + 1))
+
+	next, closer := guardIterator(t.db, func() (string, []byte, uint64, error) {
+		if !it.Valid() {
+			return "", nil, 0, ErrEndOfRange
+		}
+
+		data := append([]byte(nil), getItemValue(it.Item())...)
+		it.Next()
+
+		var change Change
+		if err := msgpack.Unmarshal(data, &change); err != nil {
+			return "", nil, 0, err
+		}
+
+		return change.Key, data, change.Counter, nil
+	}, func() {
+		it.Close()
+		t.releaseRange()
+	})
+
+	return newRange(next, closer, nil)
+}
+
+// openChangeLog opens the store of the change log of the table, and
+// continues the sequence numbers from its last change.
+func (t *Table) openChangeLog() error {
+	kv, err := t.db.openKV(t.changeLogDir(), t.db.openOptions)
+	if err != nil {
+		return errors.New("jvzc: failed to open change log: " + err.Error())
+	}
+
+	itOpts := badger.DefaultIteratorOptions
+	itOpts.PrefetchValues = false
+	itOpts.Reverse = true
+	it := kv.NewIterator(itOpts)
+	it.Rewind()
+	if it.Valid() {
+		t.changeSeq = binary.BigEndian.Uint64(it.Item().Key())
+	}
+	it.Close()
+
+	t.changes = kv
+	return nil
+}
+
+// changeLogDir returns the directory of the store of the change log, which
+// can't be the directory of an index as it isn't hexadecimal.
+func (t *Table) changeLogDir() string {
+	return t.db.path + "/" + t.tableName.Hex() + "/changes"
+}
+
+// changed notifies the listeners of the table of a change to the document
+// with the key. Changes are logged in the change log by the function
+// returned by journalWrite instead, while the document is still locked.
+func (t *Table) changed(op ChangeOp, key string) {
+	if op == ChangeDelete {
+		atomic.AddUint64(&t.ops.Deletes, 1)
+	} else {
+		atomic.AddUint64(&t.ops.Sets, 1)
+	}
+
+	t.notify(key)
+}
+
+// logWrittenChange logs a change to the document with the key if it was
+// written, which is when its counter is no longer the given counter it had
+// before the write.
+func (t *Table) logWrittenChange(op ChangeOp, key string, counter uint64) {
+	var item badger.KVItem
+	err := t.data.Get(t.dataKey(key), &item)
+	if err == nil && item.Counter() == counter {
+		return
+	}
+
+	if err != nil {
+		t.db.warn(Warning{
+			Code: ChangeLogFailed,
+			Name: t.name(),
+			Key:  key,
+			Err:  err,
+		})
+		return
+	}
+
+	t.logChange(op, key, item.Counter())
+}
+
+// logChange records a change to the document with the key in the change
+// log. Sequence numbers are assigned and stored under a mutex, so that
+// changes are stored in the order of their sequence numbers, and a consumer
+// which has read up to a change has read every change before it.
+func (t *Table) logChange(op ChangeOp, key string, counter uint64) {
+	t.changeMutex.Lock()
+	defer t.changeMutex.Unlock()
+
+	change := Change{
+		Seq:     t.changeSeq + 1,
+		Op:      op,
+		Key:     key,
+		Counter: counter,
+	}
+
+	data, err := msgpack.Marshal(change)
+	if err == nil {
+		err = t.changes.Set(changeKey(change.Seq), data, 0)
+	}
+
+	if err != nil {
+		t.db.warn(Warning{
+			Code: ChangeLogFailed,
+			Name: t.name(),
+			Key:  key,
+			Err:  err,
+		})
+		return
+	}
+
+	t.changeSeq = change.Seq
+}
+
+func changeKey(seq uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, seq)
+	return key
+}
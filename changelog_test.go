@@ -0,0 +1,95 @@
+package jvzc
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestChangeLog(t *testing.T) {
+	if testing.Short() {
+		t.Parallel()
+	}
+
+	dir, err := ioutil.TempDir("", "jvzc_")
+	panicNotNil(err)
+
+	t.Log("testing directory:", dir)
+	defer func() {
+		if !t.Failed() {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	db, err := Open(dir + "/data")
+	panicNotNil(err)
+
+	panicNotNil(db.NewTable("changes_testing"))
+	table := db.Table("changes_testing")
+	panicNotNil(table.NewIndex("City"))
+
+	r := table.Changes(0)
+	if r.Next() || r.Error() != errNoChangeLog {
+		t.Fatal("error should be errNoChangeLog, but is", r.Error())
+	}
+
+	panicNotNil(table.Set("before", Person{Name: "Before"}))
+	panicNotNil(table.SetChangeLog(true))
+
+	panicNotNil(table.Set("jason", Person{Name: "Jason", City: "Sydney"}))
+	panicNotNil(table.Set("drew", Person{Name: "Drew", City: "London"}))
+	panicNotNil(table.Delete("jason"))
+
+	expected := []Change{
+		{Seq: 1, Op: ChangeSet, Key: "jason"},
+		{Seq: 2, Op: ChangeSet, Key: "drew"},
+		{Seq: 3, Op: ChangeDelete, Key: "jason"},
+	}
+
+	expectChanges := func(since uint64, expected []Change) {
+		r := table.Changes(since)
+		defer r.Close()
+
+		for _, change := range expected {
+			if !r.Next() {
+				t.Fatal("range should have change", change.Seq, "but doesn't:",
+					r.Error())
+			}
+
+			var actual Change
+			panicNotNil(r.Decode(&actual))
+
+			if actual.Seq != change.Seq || actual.Op != change.Op ||
+				actual.Key != change.Key || r.Key() != change.Key {
+				t.Fatal("change should be", change, "but is", actual)
+			}
+
+			if actual.Counter == 0 || r.Counter() != actual.Counter {
+				t.Fatal("change should have a counter, but doesn't")
+			}
+		}
+
+		if r.Next() {
+			t.Fatal("range should have no more changes, but does")
+		}
+	}
+
+	expectChanges(0, expected)
+	expectChanges(2, expected[2:])
+
+	db.Close()
+
+	db, err = Open(dir + "/data")
+	panicNotNil(err)
+
+	defer db.Close()
+
+	table = db.Table("changes_testing")
+	panicNotNil(table.Set("ben", Person{Name: "Ben"}))
+	expected = append(expected, Change{Seq: 4, Op: ChangeSet, Key: "ben"})
+	expectChanges(0, expected)
+
+	panicNotNil(table.SetChangeLog(false))
+	panicNotNil(table.Set("after", Person{Name: "After"}))
+	expectChanges(3, expected[3:])
+}
@@ -0,0 +1,255 @@
+package jvzc
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/1lann/badger"
+	"github.com/1lann/msgpack"
+)
+
+// IndexReport represents the result of verifying an index against the
+// documents of its table.
+type IndexReport struct {
+	// Name is the name of the index, in the form "table/index".
+	Name string
+	// Entries is the number of primary keys stored in the index.
+	Entries int64
+	// Orphaned is the number of primary keys stored in the index whose
+	// document no longer exists, or no longer has the indexed value.
+	Orphaned int64
+	// Missing is the number of indexed values of documents which are not
+	// stored in the index.
+	Missing int64
+	// Corrupt is the number of values of the index which could not be
+	// decoded.
+	Corrupt int64
+}
+
+// OK returns whether the index is consistent with its table.
+func (r IndexReport) OK() bool {
+	return r.Orphaned == 0 && r.Missing == 0 && r.Corrupt == 0
+}
+
+// Report represents the result of checking the consistency of a database.
+type Report struct {
+	// Documents is the number of documents in every table.
+	Documents int64
+	// Indexes are the reports of every index, sorted by their names.
+	Indexes []IndexReport
+}
+
+// OK returns whether every index of the database is consistent with its
+// table. If not, the affected indexes should be rebuilt by dropping and
+// creating them again.
+func (r Report) OK() bool {
+	for _, index := range r.Indexes {
+		if !index.OK() {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Check verifies every index of every table in the database, returning a
+// report of the inconsistencies found. It does not modify the database, so it
+// can be used after a crash to decide whether indexes need to be rebuilt.
+// Documents written while the database is being checked may be reported as
+// inconsistent.
+func (d *DB) Check() (Report, error) {
+	var report Report
+
+	for _, tableName := range d.Tables() {
+		table := d.Table(tableName)
+
+		count, err := table.countDocuments()
+		if err != nil {
+			return report, err
+		}
+
+		report.Documents += count
+
+		for _, indexName := range table.Indexes() {
+			indexReport, err := table.Index(indexName).Verify()
+			if err != nil {
+				return report, fmt.Errorf("jvzc: check %s/%s: %w", tableName,
+					indexName, err)
+			}
+
+			report.Indexes = append(report.Indexes, indexReport)
+		}
+	}
+
+	return report, nil
+}
+
+// Verify compares the index against the documents of its table, returning a
+// report of orphaned and missing entries. It does not modify the index.
+// Partial indexes can only be verified once their predicate has been set.
+func (i *Index) Verify() (IndexReport, error) {
+	report := IndexReport{Name: i.name()}
+
+	if i.partial && i.getPredicate() == nil {
+		return report, errNoPredicate
+	}
+
+	if err := i.table.db.acquire(); err != nil {
+		return report, err
+	}
+	defer i.table.db.release()
+
+	if err := i.table.acquireRange(i); err != nil {
+		return report, err
+	}
+	defer i.table.releaseRange()
+
+	var valid int64
+
+	it := i.index.NewIterator(badger.DefaultIteratorOptions)
+	for it.Rewind(); it.Valid(); it.Next() {
+		indexKey := i.indexKeyOf(it.Item().Key())
+
+		var keys []string
+		if err := msgpack.Unmarshal(getItemValue(it.Item()), &keys); err != nil {
+			report.Corrupt++
+			continue
+		}
+
+		for _, key := range keys {
+			report.Entries++
+
+			data, err := i.table.getData(key)
+			if err != nil {
+				it.Close()
+				return report, err
+			}
+
+			// Documents which can't be queried have no index values, so
+			// their entries are orphaned.
+			values, _ := i.valuesOf(data)
+			if containsValue(values, indexKey) {
+				valid++
+			} else {
+				report.Orphaned++
+			}
+		}
+	}
+	it.Close()
+
+	var expected int64
+
+	it = i.table.data.NewIterator(badger.DefaultIteratorOptions)
+	defer it.Close()
+
+	for it.Rewind(); it.Valid(); it.Next() {
+		data, err := i.table.itemData(it.Item())
+		if err != nil {
+			return report, err
+		}
+
+		values, _ := i.valuesOf(data)
+		expected += int64(len(values))
+	}
+
+	if expected > valid {
+		report.Missing = expected - valid
+	}
+
+	return report, nil
+}
+
+// IndexEntriesForKey returns the keys of every index of the table under which
+// the document with the primary key is stored, mapped by the name of the
+// index. The keys are encoded like the keys returned by HotValues. Only the
+// index values of the current document are looked up, so an index which has
+// no keys, or fewer keys than the document has values, is missing entries for
+// the document, but stale entries under values the document no longer has
+// are not found. Use Verify to find those. ErrNotFound is returned if the
+// document does not exist.
+func (t *Table) IndexEntriesForKey(key string) (map[string][]string, error) {
+	if err := t.db.acquire(); err != nil {
+		return nil, err
+	}
+	defer t.db.release()
+
+	if !validKey(key) {
+		return nil, ErrBadIdentifier
+	}
+
+	data, err := t.getData(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if data == nil {
+		return nil, ErrNotFound
+	}
+
+	entries := make(map[string][]string, len(t.indexes))
+	for name, index := range t.indexes {
+		if index.partial && index.getPredicate() == nil {
+			return nil, errNoPredicate
+		}
+
+		values, err := index.valuesOf(data)
+		if err != nil {
+			return nil, err
+		}
+
+		var indexKeys []string
+		for _, indexKey := range values {
+			keys, err := index.getKeys(indexKey)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, k := range keys {
+				if k == key {
+					indexKeys = append(indexKeys, string(indexKey))
+					break
+				}
+			}
+		}
+
+		entries[string(name)] = indexKeys
+	}
+
+	return entries, nil
+}
+
+// countDocuments returns the number of documents in the table.
+func (t *Table) countDocuments() (int64, error) {
+	if err := t.db.acquire(); err != nil {
+		return 0, err
+	}
+	defer t.db.release()
+
+	if err := t.acquireRange(nil); err != nil {
+		return 0, err
+	}
+	defer t.releaseRange()
+
+	return int64(countKeys(t.data)), nil
+}
+
+// getData returns the marshalled document stored under the key, or nil if
+// the document does not exist.
+func (t *Table) getData(key string) ([]byte, error) {
+	var item badger.KVItem
+	if err := t.data.Get(t.dataKey(key), &item); err != nil {
+		return nil, err
+	}
+
+	return t.itemData(&item)
+}
+
+func containsValue(values [][]byte, value []byte) bool {
+	for _, v := range values {
+		if bytes.Equal(v, value) {
+			return true
+		}
+	}
+
+	return false
+}
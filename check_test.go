@@ -0,0 +1,139 @@
+package jvzc
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	if testing.Short() {
+		t.Parallel()
+	}
+
+	dir, err := ioutil.TempDir("", "jvzc_")
+	panicNotNil(err)
+
+	t.Log("testing directory:", dir)
+	defer func() {
+		if !t.Failed() {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	db, err := Open(dir + "/data")
+	panicNotNil(err)
+	defer db.Close()
+
+	panicNotNil(db.NewTable("check_testing"))
+	table := db.Table("check_testing")
+	panicNotNil(table.NewIndex("City"))
+	panicNotNil(table.NewIndex("Age"))
+
+	panicNotNil(table.Set("ben", Person{Name: "Ben", City: "Melbourne", Age: 19}))
+	panicNotNil(table.Set("drew", Person{Name: "Drew", City: "London", Age: 18}))
+	panicNotNil(table.Set("jason", Person{Name: "Jason", City: "Sydney", Age: 18}))
+
+	report, err := db.Check()
+	panicNotNil(err)
+
+	if !report.OK() || report.Documents != 3 || len(report.Indexes) != 2 {
+		t.Fatal("report should be ok, but isn't:", report)
+	}
+
+	if report.Indexes[0].Name != "check_testing/Age" ||
+		report.Indexes[0].Entries != 3 {
+		t.Fatal("age index report should have 3 entries, but doesn't:",
+			report.Indexes[0])
+	}
+
+	// Write and delete documents without updating their indexes.
+	data, err := table.marshal(Person{Name: "Jason", City: "Perth", Age: 18})
+	panicNotNil(err)
+	stored, err := table.encodeValue(data, Meta{})
+	panicNotNil(err)
+	panicNotNil(table.data.Set([]byte("jason"), stored, 0))
+	panicNotNil(table.data.Delete([]byte("drew")))
+
+	report, err = db.Check()
+	panicNotNil(err)
+
+	if report.OK() || report.Documents != 2 {
+		t.Fatal("report should not be ok, but is:", report)
+	}
+
+	age := report.Indexes[0]
+	if age.Entries != 3 || age.Orphaned != 1 || age.Missing != 0 {
+		t.Fatal("age index should have 1 orphan, but doesn't:", age)
+	}
+
+	city := report.Indexes[1]
+	if city.Entries != 3 || city.Orphaned != 2 || city.Missing != 1 {
+		t.Fatal("city index should have 2 orphans and 1 missing, but doesn't:",
+			city)
+	}
+
+	// Check must not repair the indexes.
+	report, err = db.Check()
+	panicNotNil(err)
+
+	if report.Indexes[1] != city {
+		t.Fatal("check should not modify the index, but did")
+	}
+}
+
+func TestIndexEntriesForKey(t *testing.T) {
+	if testing.Short() {
+		t.Parallel()
+	}
+
+	dir, err := ioutil.TempDir("", "jvzc_")
+	panicNotNil(err)
+
+	t.Log("testing directory:", dir)
+	defer func() {
+		if !t.Failed() {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	db, err := Open(dir + "/data")
+	panicNotNil(err)
+
+	defer db.Close()
+
+	panicNotNil(db.NewTable("entries_testing"))
+	table := db.Table("entries_testing")
+	panicNotNil(table.NewIndex("City"))
+	panicNotNil(table.NewIndex("Likes.*"))
+
+	panicNotNil(table.Set("jason", Person{Name: "Jason", City: "Sydney",
+		Likes: []string{"go", "tea"}}))
+
+	entries, err := table.IndexEntriesForKey("jason")
+	panicNotNil(err)
+
+	if len(entries["City"]) != 1 ||
+		entries["City"][0] != string(valueToBytes("Sydney")) {
+		t.Fatal("City entries should be Sydney, but are", entries["City"])
+	}
+
+	if len(entries["Likes.*"]) != 2 {
+		t.Fatal("Likes.* should have 2 entries, but has", entries["Likes.*"])
+	}
+
+	// Remove the document from the index without updating the document.
+	panicNotNil(table.Index("City").deleteFromIndex(valueToBytes("Sydney"),
+		"jason"))
+
+	entries, err = table.IndexEntriesForKey("jason")
+	panicNotNil(err)
+
+	if len(entries["City"]) != 0 {
+		t.Fatal("City should have no entries, but has", entries["City"])
+	}
+
+	if _, err = table.IndexEntriesForKey("nobody"); err != ErrNotFound {
+		t.Fatal("error should be ErrNotFound, but is", err)
+	}
+}
@@ -0,0 +1,81 @@
+package jvzc
+
+import (
+	"bytes"
+	"strings"
+)
+
+// Collation returns the sort key of a primary key, which determines the order
+// of the keys of a table, such as in ranges. Keys with equal sort keys are
+// ordered by their bytes. The underlying storage orders keys by their bytes,
+// so rather than comparing two keys, a collation maps each key to the bytes
+// it is stored under, which must not contain a zero byte.
+type Collation func(key string) string
+
+// CaseInsensitive is a Collation which orders keys regardless of their case.
+// Keys which only differ in case are still separate documents.
+func CaseInsensitive(key string) string {
+	return strings.ToLower(key)
+}
+
+// SetCollation sets the collation of the primary keys of the table, which
+// changes the bytes keys are stored under, so it must be set before any
+// documents are written to the table, and every time the database is opened
+// before the table is used. Documents written under a different collation
+// can't be found. The bounds of Between, CountBetween and DeleteRange are
+// compared by their sort keys, and include every key with the same sort key,
+// so with CaseInsensitive, Between("a", "b") includes "A", "a", "B" and "b".
+// Likewise, Range.Seek continues from the first key with the same sort key.
+func (t *Table) SetCollation(collation Collation) {
+	t.collation = collation
+}
+
+// dataKey returns the key a primary key is stored under, which is its sort
+// key and the primary key separated by a zero byte if the table has a
+// collation.
+func (t *Table) dataKey(key string) []byte {
+	if t.collation == nil {
+		return []byte(key)
+	}
+
+	sortKey := t.collation(key)
+	result := make([]byte, 0, len(sortKey)+1+len(key))
+	result = append(result, sortKey...)
+	result = append(result, 0)
+	return append(result, key...)
+}
+
+// userKey returns the primary key stored under the key of the table's store.
+func (t *Table) userKey(dataKey []byte) string {
+	if t.collation == nil {
+		return string(dataKey)
+	}
+
+	return string(dataKey[bytes.IndexByte(dataKey, 0)+1:])
+}
+
+// sortKey returns the sort key of the primary key.
+func (t *Table) sortKey(key string) string {
+	if t.collation == nil {
+		return key
+	}
+
+	return t.collation(key)
+}
+
+// boundKey returns the key of the table's store of a range bound, which
+// includes every key with the same sort key as the bound.
+func (t *Table) boundKey(bound string, upper bool) []byte {
+	if t.collation == nil {
+		return []byte(bound)
+	}
+
+	result := []byte(t.collation(bound))
+	if upper {
+		// The separator of stored keys is zero, so every key with the sort
+		// key is before this.
+		result = append(result, 1)
+	}
+
+	return result
+}
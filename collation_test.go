@@ -0,0 +1,91 @@
+package jvzc
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestCollation(t *testing.T) {
+	if testing.Short() {
+		t.Parallel()
+	}
+
+	dir, err := ioutil.TempDir("", "jvzc_")
+	panicNotNil(err)
+
+	t.Log("testing directory:", dir)
+	defer func() {
+		if !t.Failed() {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	db, err := Open(dir + "/data")
+	panicNotNil(err)
+
+	panicNotNil(db.NewTable("collation_testing"))
+	table := db.Table("collation_testing")
+	table.SetCollation(CaseInsensitive)
+	panicNotNil(table.NewIndex("City"))
+
+	people := map[string]Person{
+		"Ben":   {Name: "Ben", City: "Melbourne"},
+		"alice": {Name: "Alice", City: "Sydney"},
+		"bob":   {Name: "Bob", City: "Sydney"},
+		"Carol": {Name: "Carol", City: "Sydney"},
+		"BEN":   {Name: "Ben", City: "London"},
+	}
+	// Documents are written in a fixed order, as the keys of an index value
+	// are in the order they were added.
+	for _, key := range []string{"Ben", "alice", "bob", "Carol", "BEN"} {
+		panicNotNil(table.Set(key, people[key]))
+	}
+
+	r := table.All()
+	for _, key := range []string{"alice", "BEN", "Ben", "bob", "Carol"} {
+		expectPerson(key, r, people[key])
+	}
+	r.Close()
+
+	r = table.Between("b", "BEN", true)
+	expectPerson("Ben", r, people["Ben"])
+	expectPerson("BEN", r, people["BEN"])
+	if r.Next() {
+		t.Fatal("range should only contain ben, but doesn't")
+	}
+	r.Close()
+
+	if n := table.CountBetween("B", "bz"); n != 3 {
+		t.Fatal("count should be 3, but is", n)
+	}
+
+	panicNotNil(table.Delete("bob"))
+
+	r = table.Index("City").GetAll("Sydney")
+	expectPerson("alice", r, people["alice"])
+	expectPerson("Carol", r, people["Carol"])
+	r.Close()
+
+	db.Close()
+
+	db, err = Open(dir + "/data")
+	panicNotNil(err)
+
+	defer db.Close()
+
+	table = db.Table("collation_testing")
+	table.SetCollation(CaseInsensitive)
+
+	var person Person
+	_, err = table.Get("Carol", &person)
+	panicNotNil(err)
+
+	if !person.IsSame(people["Carol"]) {
+		t.Fatal("person should be Carol, but isn't")
+	}
+
+	if _, err = table.Get("carol", nil); err != ErrNotFound {
+		t.Fatal("error should be ErrNotFound, but is", err)
+	}
+}
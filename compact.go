@@ -0,0 +1,81 @@
+package jvzc
+
+import (
+	"github.com/1lann/badger"
+	"github.com/1lann/msgpack"
+)
+
+// CompactIndexes removes the values of every index of the table which no
+// longer have any primary keys, and then runs a value log garbage collection
+// on the store of every index to reclaim their space. Such values are
+// normally removed as the last primary key is, but can be left behind by
+// concurrent writes. The number of values removed is returned. Values which
+// can't be decoded are left as they are, as they are reported by Verify.
+func (t *Table) CompactIndexes() (int, error) {
+	var removed int
+
+	for _, name := range t.Indexes() {
+		index := t.Index(name)
+		if index == nil {
+			continue
+		}
+
+		n, err := index.compact()
+		removed += n
+		if err != nil {
+			return removed, err
+		}
+	}
+
+	return removed, nil
+}
+
+// compact removes the empty values of the index, and returns how many were
+// removed.
+func (i *Index) compact() (int, error) {
+	if err := i.table.db.acquire(); err != nil {
+		return 0, err
+	}
+	defer i.table.db.release()
+
+	if err := i.table.acquireRange(i); err != nil {
+		return 0, err
+	}
+	defer i.table.releaseRange()
+
+	var removed int
+
+	it := i.index.NewIterator(badger.DefaultIteratorOptions)
+	for it.Rewind(); it.Valid(); it.Next() {
+		item := it.Item()
+
+		itemValue := getItemValue(item)
+		if len(itemValue) > 0 {
+			var keys []string
+			if err := msgpack.Unmarshal(itemValue, &keys); err != nil ||
+				len(keys) > 0 {
+				continue
+			}
+		}
+
+		// The value may have gained a primary key since it was read, in
+		// which case it is kept.
+		err := i.index.CompareAndDelete(item.Key(), item.Counter())
+		if err == badger.ErrCasMismatch {
+			continue
+		} else if err != nil {
+			it.Close()
+			return removed, err
+		}
+
+		removed++
+	}
+	it.Close()
+
+	err := i.index.RunValueLogGC(0.5)
+	if err != nil && err != badger.ErrNoRewrite && err != badger.ErrRejected {
+		return removed, err
+	}
+
+	return removed, nil
+}
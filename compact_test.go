@@ -0,0 +1,75 @@
+package jvzc
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/1lann/msgpack"
+)
+
+func TestCompactIndexes(t *testing.T) {
+	if testing.Short() {
+		t.Parallel()
+	}
+
+	dir, err := ioutil.TempDir("", "jvzc_")
+	panicNotNil(err)
+
+	t.Log("testing directory:", dir)
+	defer func() {
+		if !t.Failed() {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	db, err := Open(dir + "/data")
+	panicNotNil(err)
+
+	defer db.Close()
+
+	panicNotNil(db.NewTable("compact_testing"))
+	table := db.Table("compact_testing")
+	panicNotNil(table.NewIndex("City"))
+	panicNotNil(table.NewIndex("Age"))
+
+	jason := Person{Name: "Jason", City: "Sydney", Age: 18}
+	ben := Person{Name: "Ben", City: "Melbourne", Age: 19}
+	panicNotNil(table.Set("jason", jason))
+	panicNotNil(table.Set("ben", ben))
+
+	removed, err := table.CompactIndexes()
+	panicNotNil(err)
+
+	if removed != 0 {
+		t.Fatal("removed should be 0, but is", removed)
+	}
+
+	// Leave empty values behind, as racing writes could.
+	empty, err := msgpack.Marshal([]string{})
+	panicNotNil(err)
+
+	city := table.Index("City").index
+	panicNotNil(city.Set([]byte("Perth"), empty, 0))
+	panicNotNil(city.Set([]byte("Adelaide"), []byte{}, 0))
+	panicNotNil(table.Index("Age").index.Set([]byte("Darwin"), empty, 0))
+
+	removed, err = table.CompactIndexes()
+	panicNotNil(err)
+
+	if removed != 3 {
+		t.Fatal("removed should be 3, but is", removed)
+	}
+
+	for _, name := range []string{"City", "Age"} {
+		report, err := table.Index(name).Verify()
+		panicNotNil(err)
+
+		if !report.OK() || report.Entries != 2 {
+			t.Fatal("index", name, "should be consistent, but isn't:", report)
+		}
+	}
+
+	expectPerson("jason", table.Index("City").GetAll("Sydney"), jason)
+	expectPerson("ben", table.Index("Age").GetAll(19), ben)
+}
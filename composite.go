@@ -0,0 +1,357 @@
+package jvzc
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"time"
+)
+
+// Type tags of the components of composite keys, which keep components of
+// different types apart. Components of the same type sort in the order of
+// their values.
+const (
+	compositeInt    = 0x10
+	compositeFloat  = 0x20
+	compositeString = 0x30
+	compositeBytes  = 0x31
+	compositeTime   = 0x40
+	compositeMax    = 0xff
+)
+
+var errBadComponent = errors.New("jvzc: unsupported composite key component")
+
+// CompositeKey returns the primary key made of the components, which may be
+// integers, floats, strings, []byte or time.Time. Keys sort by their first
+// component, then by their second component, and so on, so all the keys
+// with the same leading components can be scanned with BetweenComposite,
+// such as all the users of a tenant with a key of tenant ID and user ID.
+//
+// Integers are encoded like they are in compound indexes, but unlike index
+// values, strings are not case folded, and are escaped and terminated rather
+// than null terminated, so that keys can be decoded with DecodeCompositeKey.
+func CompositeKey(components ...interface{}) (string, error) {
+	if len(components) == 0 {
+		return "", ErrBadIdentifier
+	}
+
+	key, err := encodeComposite(components, false)
+	if err != nil {
+		return "", err
+	}
+
+	if !validKey(key) {
+		return "", ErrBadIdentifier
+	}
+
+	return key, nil
+}
+
+// DecodeCompositeKey returns the components of a key returned by
+// CompositeKey. Integers are returned as int64, floats as float64, and the
+// other types as themselves.
+func DecodeCompositeKey(key string) ([]interface{}, error) {
+	var components []interface{}
+
+	data := []byte(key)
+	for len(data) > 0 {
+		tag := data[0]
+		data = data[1:]
+
+		switch tag {
+		case compositeInt:
+			if len(data) < 8 {
+				return nil, errBadComponent
+			}
+
+			components = append(components,
+				int64(binary.BigEndian.Uint64(data)-(1<<63)))
+			data = data[8:]
+		case compositeFloat:
+			if len(data) < 8 {
+				return nil, errBadComponent
+			}
+
+			bits := binary.BigEndian.Uint64(data)
+			if bits&(1<<63) != 0 {
+				bits ^= 1 << 63
+			} else {
+				bits = ^bits
+			}
+
+			components = append(components, math.Float64frombits(bits))
+			data = data[8:]
+		case compositeString, compositeBytes:
+			value, rest, ok := unescapeComponent(data)
+			if !ok {
+				return nil, errBadComponent
+			}
+
+			if tag == compositeString {
+				components = append(components, string(value))
+			} else {
+				components = append(components, value)
+			}
+
+			data = rest
+		case compositeTime:
+			if len(data) < 16 {
+				return nil, errBadComponent
+			}
+
+			components = append(components, time.Unix(
+				int64(binary.BigEndian.Uint64(data)-(1<<63)),
+				int64(binary.BigEndian.Uint64(data[8:])-(1<<63))))
+			data = data[16:]
+		default:
+			return nil, errBadComponent
+		}
+	}
+
+	return components, nil
+}
+
+// SetComposite sets a value in the table like Set, with the primary key made
+// of the components as described by CompositeKey.
+func (t *Table) SetComposite(components []interface{}, value interface{},
+	counter ...uint64) error {
+	key, err := CompositeKey(components...)
+	if err != nil {
+		return err
+	}
+
+	return t.Set(key, value, counter...)
+}
+
+// GetComposite retrieves a value from the table like Get, with the primary
+// key made of the components as described by CompositeKey.
+func (t *Table) GetComposite(components []interface{},
+	dst interface{}) (uint64, error) {
+	key, err := CompositeKey(components...)
+	if err != nil {
+		return 0, err
+	}
+
+	return t.Get(key, dst)
+}
+
+// BetweenComposite returns a Range of documents between the lower and upper
+// composite keys like Between, which are inclusive on both ends. MinValue and
+// MaxValue may be used as the last component of a bound to match every key
+// with the preceding components, so every key starting with "acme" is in
+// BetweenComposite([]interface{}{"acme"},
+// []interface{}{"acme", MaxValue}). An empty lower or upper bound is the same
+// as MinValue or MaxValue. Use DecodeCompositeKey to read the components of
+// the keys of the range.
+func (t *Table) BetweenComposite(lower, upper []interface{},
+	reverse ...bool) *Range {
+	var lowerKey, upperKey interface{} = MinValue, MaxValue
+
+	for i, bound := range [][]interface{}{lower, upper} {
+		if len(bound) == 0 {
+			continue
+		}
+
+		key, err := encodeComposite(bound, true)
+		if err != nil {
+			return newRange(func() (string, []byte, uint64, error) {
+				return "", nil, 0, err
+			}, func() {}, nil)
+		}
+
+		if key == "" {
+			continue
+		} else if i == 0 {
+			lowerKey = key
+		} else {
+			upperKey = key
+		}
+	}
+
+	return t.Between(lowerKey, upperKey, reverse...)
+}
+
+// DeletePrefix deletes every document whose composite key starts with the
+// prefix, which is a component or a []interface{} of leading components, and
+// returns the number of documents deleted, such as to delete every document
+// of a tenant. Documents are deleted in batches like with DeleteRange, and
+// indexes are updated. As string components are terminated, the prefix
+// "acme" doesn't match keys starting with "acmex".
+func (t *Table) DeletePrefix(prefix interface{}) (int, error) {
+	lower, upper, err := prefixBounds(prefix)
+	if err != nil {
+		return 0, err
+	}
+
+	return t.deleteRange(lower, upper, true)
+}
+
+// KeepLatest keeps the n documents with the highest composite keys starting
+// with the prefix, and deletes the rest, returning the number of documents
+// deleted. The prefix is described by DeletePrefix. It is intended for
+// history tables with keys of an entity followed by a time, such as to keep
+// the latest 10 versions of a user with KeepLatest("user1", 10). Documents
+// are deleted like with DeletePrefix, and documents written with the prefix
+// while KeepLatest is running may also be deleted if their keys are lower
+// than the documents kept.
+func (t *Table) KeepLatest(prefix interface{}, n int) (int, error) {
+	if n < 0 {
+		return 0, errors.New("jvzc: number of documents to keep must not " +
+			"be negative")
+	}
+
+	lower, upper, err := prefixBounds(prefix)
+	if err != nil {
+		return 0, err
+	}
+
+	// Find the highest key which isn't kept, every key up to which is
+	// deleted.
+	r := t.Between(lower, upper, true)
+	var highest string
+	for kept := 0; r.Next(); {
+		if r.Key() == upper {
+			continue
+		}
+
+		if kept == n {
+			highest = r.Key()
+			break
+		}
+
+		kept++
+	}
+	r.Close()
+
+	if r.Error() != nil && r.Error() != ErrEndOfRange {
+		return 0, r.Error()
+	}
+
+	if highest == "" {
+		return 0, nil
+	}
+
+	return t.deleteRange(lower, highest, false)
+}
+
+// prefixBounds returns the lower bound of the composite keys starting with
+// the prefix, and the exclusive upper bound of them.
+func prefixBounds(prefix interface{}) (string, string, error) {
+	components, ok := prefix.([]interface{})
+	if !ok {
+		components = []interface{}{prefix}
+	}
+
+	if len(components) == 0 {
+		return "", "", ErrBadIdentifier
+	}
+
+	lower, err := encodeComposite(components, false)
+	if err != nil {
+		return "", "", err
+	}
+
+	// No key continues with compositeMax, so every key with the prefix is
+	// before it.
+	return lower, lower + string([]byte{compositeMax}), nil
+}
+
+// encodeComposite encodes the components of a composite key. If bounds is
+// true, the last component may be MinValue, which sorts before any further
+// components, or MaxValue, which sorts after them.
+func encodeComposite(components []interface{}, bounds bool) (string, error) {
+	var result []byte
+
+	for i, component := range components {
+		switch v := component.(type) {
+		case int, int16, int32, int64, uint16, uint32, uint64:
+			result = append(result, compositeInt)
+			result = append(result, integerToBytes(v)...)
+		case float32:
+			result = appendFloat(result, float64(v))
+		case float64:
+			result = appendFloat(result, v)
+		case string:
+			result = append(result, compositeString)
+			result = appendEscaped(result, []byte(v))
+		case []byte:
+			result = append(result, compositeBytes)
+			result = appendEscaped(result, v)
+		case time.Time:
+			result = append(result, compositeTime)
+			result = append(result, integerToBytes(v.Unix())...)
+			result = append(result, integerToBytes(v.Nanosecond())...)
+		case Bounds:
+			if !bounds || i != len(components)-1 {
+				return "", errBadComponent
+			}
+
+			if v == MaxValue {
+				result = append(result, compositeMax)
+			}
+		default:
+			return "", errBadComponent
+		}
+	}
+
+	return string(result), nil
+}
+
+// appendFloat appends the float with its bits arranged to sort in the order
+// of its value, by flipping the sign bit of positive numbers and every bit of
+// negative numbers.
+func appendFloat(dst []byte, value float64) []byte {
+	bits := math.Float64bits(value)
+	if bits&(1<<63) != 0 {
+		bits = ^bits
+	} else {
+		bits ^= 1 << 63
+	}
+
+	result := make([]byte, 8)
+	binary.BigEndian.PutUint64(result, bits)
+	return append(append(dst, compositeFloat), result...)
+}
+
+// appendEscaped appends the value with every 0x00 byte escaped as 0x00 0xff,
+// terminated by 0x00 0x01, so that shorter values sort before the longer
+// values they are a prefix of.
+func appendEscaped(dst []byte, value []byte) []byte {
+	for _, b := range value {
+		dst = append(dst, b)
+		if b == 0 {
+			dst = append(dst, 0xff)
+		}
+	}
+
+	return append(dst, 0, 1)
+}
+
+// unescapeComponent reads a value written by appendEscaped, returning the
+// value and the remaining data.
+func unescapeComponent(data []byte) ([]byte, []byte, bool) {
+	value := []byte{}
+
+	for i := 0; i < len(data); i++ {
+		if data[i] != 0 {
+			value = append(value, data[i])
+			continue
+		}
+
+		if i+1 >= len(data) {
+			return nil, nil, false
+		}
+
+		switch data[i+1] {
+		case 0xff:
+			value = append(value, 0)
+			i++
+		case 1:
+			return value, data[i+2:], true
+		default:
+			return nil, nil, false
+		}
+	}
+
+	return nil, nil, false
+}
@@ -0,0 +1,270 @@
+package jvzc
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestCompositeKey(t *testing.T) {
+	if testing.Short() {
+		t.Parallel()
+	}
+
+	keys := [][]interface{}{
+		{"a", -5},
+		{"a", 3},
+		{"a", 3, "x"},
+		{"a", 300},
+		{"a\x00", 1},
+		{"ab", -1.5},
+		{"ab", 2.5},
+		{"b", []byte("z")},
+		{"b", time.Unix(10, 5).UTC()},
+	}
+
+	var encoded []string
+	for _, components := range keys {
+		key, err := CompositeKey(components...)
+		panicNotNil(err)
+		encoded = append(encoded, key)
+
+		decoded, err := DecodeCompositeKey(key)
+		panicNotNil(err)
+
+		if len(decoded) != len(components) {
+			t.Fatal("decoded key should be", components, "but is", decoded)
+		}
+
+		for i, component := range decoded {
+			if tm, ok := component.(time.Time); ok {
+				component = tm.UTC()
+			}
+
+			expected := components[i]
+			if n, ok := expected.(int); ok {
+				expected = int64(n)
+			}
+
+			if !reflect.DeepEqual(component, expected) {
+				t.Fatal("decoded key should be", components, "but is", decoded)
+			}
+		}
+	}
+
+	if !sort.StringsAreSorted(encoded) {
+		t.Fatal("composite keys should be sorted, but aren't")
+	}
+
+	if _, err := CompositeKey(); err != ErrBadIdentifier {
+		t.Fatal("error should be ErrBadIdentifier, but is", err)
+	}
+
+	if _, err := CompositeKey("a", MaxValue); err != errBadComponent {
+		t.Fatal("error should be errBadComponent, but is", err)
+	}
+}
+
+func TestTableComposite(t *testing.T) {
+	if testing.Short() {
+		t.Parallel()
+	}
+
+	dir, err := ioutil.TempDir("", "jvzc_")
+	panicNotNil(err)
+
+	t.Log("testing directory:", dir)
+	defer func() {
+		if !t.Failed() {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	db, err := Open(dir + "/data")
+	panicNotNil(err)
+
+	defer db.Close()
+
+	panicNotNil(db.NewTable("composite_testing"))
+	table := db.Table("composite_testing")
+
+	jason := Person{Name: "Jason", City: "Sydney", Age: 18}
+	drew := Person{Name: "Drew", City: "London", Age: 21}
+	ben := Person{Name: "Ben", City: "Melbourne", Age: 19}
+
+	panicNotNil(table.SetComposite([]interface{}{"acme", 2}, jason))
+	panicNotNil(table.SetComposite([]interface{}{"acme", 10}, drew))
+	panicNotNil(table.SetComposite([]interface{}{"acmf", 1}, ben))
+
+	var person Person
+	_, err = table.GetComposite([]interface{}{"acme", 10}, &person)
+	panicNotNil(err)
+
+	if !person.IsSame(drew) {
+		t.Fatal("person should be drew, but isn't")
+	}
+
+	acme2, err := CompositeKey("acme", 2)
+	panicNotNil(err)
+	acme10, err := CompositeKey("acme", 10)
+	panicNotNil(err)
+	acmf1, err := CompositeKey("acmf", 1)
+	panicNotNil(err)
+
+	r := table.BetweenComposite([]interface{}{"acme"},
+		[]interface{}{"acme", MaxValue})
+	expectPerson(acme2, r, jason)
+	expectPerson(acme10, r, drew)
+	if r.Next() {
+		t.Fatal("range should only contain acme, but doesn't")
+	}
+	r.Close()
+
+	r = table.BetweenComposite([]interface{}{"acme", 5}, nil, true)
+	expectPerson(acmf1, r, ben)
+	expectPerson(acme10, r, drew)
+	if r.Next() {
+		t.Fatal("range should end at acme 5, but doesn't")
+	}
+	r.Close()
+}
+
+func TestDeletePrefix(t *testing.T) {
+	if testing.Short() {
+		t.Parallel()
+	}
+
+	dir, err := ioutil.TempDir("", "jvzc_")
+	panicNotNil(err)
+
+	t.Log("testing directory:", dir)
+	defer func() {
+		if !t.Failed() {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	db, err := Open(dir + "/data")
+	panicNotNil(err)
+
+	defer db.Close()
+
+	panicNotNil(db.NewTable("prefix_testing"))
+	table := db.Table("prefix_testing")
+	panicNotNil(table.NewIndex("City"))
+
+	for i := 0; i < 50; i++ {
+		panicNotNil(table.SetComposite([]interface{}{"acme", i},
+			Person{Name: "Jason", City: "Sydney"}))
+		panicNotNil(table.SetComposite([]interface{}{"acmex", i},
+			Person{Name: "Drew", City: "Sydney"}))
+	}
+	panicNotNil(table.SetComposite([]interface{}{"acme"},
+		Person{Name: "Acme", City: "Sydney"}))
+
+	n, err := table.DeletePrefix("acme")
+	panicNotNil(err)
+
+	if n != 51 {
+		t.Fatal("51 documents should be deleted, but", n, "were")
+	}
+
+	n, err = table.DeletePrefix([]interface{}{"acmex", 10})
+	panicNotNil(err)
+
+	if n != 1 {
+		t.Fatal("1 document should be deleted, but", n, "were")
+	}
+
+	count, err := table.Index("City").GetAll("Sydney").Count()
+	panicNotNil(err)
+
+	if count != 49 {
+		t.Fatal("49 documents should remain, but", count, "do")
+	}
+
+	if _, err = table.DeletePrefix([]interface{}{}); err != ErrBadIdentifier {
+		t.Fatal("error should be ErrBadIdentifier, but is", err)
+	}
+}
+
+func TestKeepLatest(t *testing.T) {
+	if testing.Short() {
+		t.Parallel()
+	}
+
+	dir, err := ioutil.TempDir("", "jvzc_")
+	panicNotNil(err)
+
+	t.Log("testing directory:", dir)
+	defer func() {
+		if !t.Failed() {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	db, err := Open(dir + "/data")
+	panicNotNil(err)
+
+	defer db.Close()
+
+	panicNotNil(db.NewTable("latest_testing"))
+	table := db.Table("latest_testing")
+	panicNotNil(table.NewIndex("Name"))
+
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 20; i++ {
+		for _, name := range []string{"jason", "ben"} {
+			panicNotNil(table.SetComposite([]interface{}{name,
+				start.Add(time.Duration(i) * time.Hour)},
+				Person{Name: name, Age: i}))
+		}
+	}
+
+	n, err := table.KeepLatest("jason", 5)
+	panicNotNil(err)
+
+	if n != 15 {
+		t.Fatal("15 documents should be deleted, but", n, "were")
+	}
+
+	var results []Person
+	panicNotNil(table.Index("Name").GetAll("jason").All(&results))
+	if len(results) != 5 {
+		t.Fatal("5 documents should remain, but", len(results), "do")
+	}
+
+	for _, person := range results {
+		if person.Age < 15 {
+			t.Fatal("the latest documents should remain, but haven't")
+		}
+	}
+
+	n, err = table.KeepLatest("jason", 5)
+	panicNotNil(err)
+
+	if n != 0 {
+		t.Fatal("0 documents should be deleted, but", n, "were")
+	}
+
+	count, err := table.Index("Name").GetAll("ben").Count()
+	panicNotNil(err)
+
+	if count != 20 {
+		t.Fatal("20 documents should remain, but", count, "do")
+	}
+
+	n, err = table.KeepLatest("ben", 0)
+	panicNotNil(err)
+
+	if n != 20 {
+		t.Fatal("20 documents should be deleted, but", n, "were")
+	}
+
+	if _, err = table.KeepLatest("ben", -1); err == nil {
+		t.Fatal("error should not be nil, but is")
+	}
+}
@@ -0,0 +1,184 @@
+package jvzc
+
+import (
+	"bytes"
+	"errors"
+	"sync/atomic"
+
+	"github.com/1lann/badger"
+	"github.com/1lann/msgpack"
+)
+
+var errNotCovering = errors.New("jvzc: index is not a covering index")
+
+// projectionOf returns the projected fields of the document for a covering
+// index, as a msgpack map of the fields in the order they were specified.
+// Fields the document doesn't have are left out. nil is returned if the index
+// isn't a covering index or the document is empty.
+func (i *Index) projectionOf(data []byte) ([]byte, error) {
+	if len(i.project) == 0 || len(data) == 0 {
+		return nil, nil
+	}
+
+	var doc map[string]interface{}
+	if err := unmarshal(i.table, data, &doc); err != nil {
+		return nil, err
+	}
+
+	var fields []string
+	for _, field := range i.project {
+		if _, found := doc[field]; found {
+			fields = append(fields, field)
+		}
+	}
+
+	// The fields are written in order, rather than marshalling a map, so
+	// that the same fields always have the same projection.
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	if err := enc.EncodeMapLen(len(fields)); err != nil {
+		return nil, err
+	}
+
+	for _, field := range fields {
+		if err := enc.EncodeString(field); err != nil {
+			return nil, err
+		}
+
+		if err := enc.Encode(doc[field]); err != nil {
+			return nil, err
+		}
+	}
+
+	return buf.Bytes(), nil
+}
+
+// projectedAdditions returns the entries to add to a covering index when a
+// document changes from old to new. If the projection of the document
+// changed, every index value of the new document is added again to replace
+// its projection.
+func (i *Index) projectedAdditions(old, new []byte, oldValues,
+	newValues [][]byte) ([]diffEntry, error) {
+	newProjection, err := i.projectionOf(new)
+	if err != nil {
+		return nil, err
+	}
+
+	oldProjection, _ := i.projectionOf(old)
+
+	values := newValues
+	if bytes.Equal(oldProjection, newProjection) {
+		additions := getOneWayDiffs(string(i.indexName), newValues, oldValues)
+		values = make([][]byte, len(additions))
+		for j, addition := range additions {
+			values[j] = addition.IndexKey
+		}
+	}
+
+	additions := make([]diffEntry, len(values))
+	for j, value := range values {
+		additions[j] = diffEntry{
+			IndexName:  string(i.indexName),
+			IndexKey:   value,
+			Projection: newProjection,
+		}
+	}
+
+	return additions, nil
+}
+
+// projectedEntry is a primary key of a covering index with its projection.
+type projectedEntry struct {
+	key        string
+	projection []byte
+}
+
+// ProjectedRange represents the projections of documents stored in a
+// covering index, returned by GetAllProjected.
+type ProjectedRange struct {
+	entries []projectedEntry
+	pos     int
+}
+
+// Next advances the range to the next projection, and returns whether there
+// is one.
+func (r *ProjectedRange) Next() bool {
+	if r.pos >= len(r.entries) {
+		return false
+	}
+
+	r.pos++
+	return true
+}
+
+// Key returns the primary key of the current document.
+func (r *ProjectedRange) Key() string {
+	return r.entries[r.pos-1].key
+}
+
+// Decode decodes the projected fields of the current document into a
+// pointer, such as to a struct with some of the fields of the document or to
+// a map[string]interface{}.
+func (r *ProjectedRange) Decode(dst interface{}) error {
+	return msgpack.Unmarshal(r.entries[r.pos-1].projection, dst)
+}
+
+// Len returns the number of documents in the range.
+func (r *ProjectedRange) Len() int {
+	return len(r.entries)
+}
+
+// GetAllProjected returns the projections of the documents with the index
+// value stored in a covering index created with NewCoveringIndex, in the
+// order GetAll would return the documents, without reading the documents.
+func (i *Index) GetAllProjected(value interface{}) (*ProjectedRange, error) {
+	if len(i.project) == 0 {
+		return nil, errNotCovering
+	}
+
+	atomic.AddUint64(&i.table.ops.Ranges, 1)
+
+	if err := i.table.db.acquire(); err != nil {
+		return nil, err
+	}
+	defer i.table.db.release()
+
+	if err := i.table.acquireRange(i); err != nil {
+		return nil, err
+	}
+	defer i.table.releaseRange()
+
+	indexKey := valueToBytes(value)
+
+	it := i.index.NewIterator(badger.DefaultIteratorOptions)
+	defer it.Close()
+
+	r := &ProjectedRange{}
+	for it.Seek(indexKey); it.Valid(); it.Next() {
+		if !bytes.Equal(i.indexKeyOf(it.Item().Key()), indexKey) {
+			break
+		}
+
+		itemValue := getItemValue(it.Item())
+
+		list, err := i.decodeList(itemValue)
+		if err != nil {
+			return nil, err
+		} else if len(list) != 1 {
+			i.table.db.warn(Warning{Code: CorruptIndex, Name: i.name()})
+			return nil, ErrIndexError
+		}
+
+		header, err := msgpack.Marshal(list)
+		if err != nil {
+			return nil, err
+		}
+
+		r.entries = append(r.entries, projectedEntry{
+			key:        list[0],
+			projection: append([]byte(nil), itemValue[len(header):]...),
+		})
+	}
+
+	return r, nil
+}
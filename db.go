@@ -1,26 +1,274 @@
 package jvzc
 
-import "sync/atomic"
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"sync/atomic"
 
-// Close closes the database (all file handlers to the database).
+	"github.com/1lann/badger"
+)
+
+// Close closes the database (all file handlers to the database). Closing a
+// database which is already closed has no effect. A database opened with
+// OpenMemory is deleted once it is closed. Operations which are in progress
+// are waited for before the stores are closed, and operations started once
+// the database is closing return ErrClosed, including reading the next
+// documents of ranges which are still open.
 func (d *DB) Close() {
-	atomic.StoreInt32(&d.closed, 1)
+	if !atomic.CompareAndSwapInt32(&d.closed, 0, 1) {
+		return
+	}
+
+	d.idle.L.Lock()
+	for atomic.LoadInt32(&d.operations) > 0 {
+		d.idle.Wait()
+	}
+	d.idle.L.Unlock()
+
+	d.configMutex.Lock()
+	defer d.configMutex.Unlock()
 
 	for _, table := range d.tables {
 		for _, index := range table.indexes {
 			index.index.Close()
 		}
 		table.data.Close()
+
+		if table.changes != nil {
+			table.changes.Close()
+		}
+	}
+
+	d.journal.Close()
+
+	if d.tempDir != "" {
+		os.RemoveAll(d.tempDir)
+	}
+}
+
+// acquire registers an operation which reads or writes the stores of the
+// database, so that Close waits for it to be released. ErrClosed is returned
+// if the database is closed.
+func (d *DB) acquire() error {
+	atomic.AddInt32(&d.operations, 1)
+	if atomic.LoadInt32(&d.closed) != 0 {
+		d.release()
+		return ErrClosed
+	}
+
+	return nil
+}
+
+func (d *DB) release() {
+	if atomic.AddInt32(&d.operations, -1) == 0 &&
+		atomic.LoadInt32(&d.closed) != 0 {
+		d.idle.L.Lock()
+		d.idle.Broadcast()
+		d.idle.L.Unlock()
+	}
+}
+
+// lockConfig locks the configuration of the database, returning ErrClosed
+// without locking it if the database is closed.
+func (d *DB) lockConfig() error {
+	d.configMutex.Lock()
+	if atomic.LoadInt32(&d.closed) != 0 {
+		d.configMutex.Unlock()
+		return ErrClosed
+	}
+
+	return nil
+}
+
+// Sync flushes the value logs of every table and index store of the database,
+// and of its journal, to disk, and returns the first error encountered. It is
+// intended for databases opened with SyncWrites disabled, to be called
+// periodically or before shutting down. Note that with SyncWrites disabled,
+// values smaller than the ValueThreshold of the options are only held in
+// memory until the store's memory table is flushed, which Sync cannot force.
+func (d *DB) Sync() error {
+	if err := d.lockConfig(); err != nil {
+		return err
+	}
+	defer d.configMutex.Unlock()
+
+	firstErr := syncDir(d.path + "/journal")
+	for tableName, table := range d.tables {
+		dirs := []string{table.dir}
+		if table.changes != nil {
+			dirs = append(dirs, table.changeLogDir())
+		}
+		for indexName := range table.indexes {
+			dirs = append(dirs, d.kvDir(tableName, indexName))
+		}
+
+		for _, dir := range dirs {
+			if err := syncDir(dir); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+
+	return firstErr
+}
+
+// GCResult represents the result of a value log garbage collection run by
+// RunGC.
+type GCResult struct {
+	// Stores is the number of table, index, change log and journal stores
+	// collected.
+	Stores int
+	// Rewritten is the number of stores which rewrote a value log file.
+	Rewritten int
+	// Reclaimed is the decrease in bytes of the size of the value log files
+	// of the stores. It may be less than the space freed by rewriting, as
+	// rewritten files are only deleted once they are no longer read.
+	Reclaimed int64
+}
+
+// DidWork returns whether any value log file was rewritten.
+func (r GCResult) DidWork() bool {
+	return r.Rewritten > 0
+}
+
+// RunGC runs a value log garbage collection on every table, index, change
+// log and journal store, which rewrites at most one value log file of each
+// store if at least discardRatio of it can be discarded. The database also
+// collects garbage in the background, but RunGC can be called in a loop until
+// it returns ErrNoGCWork to reclaim as much space as possible, such as after
+// deleting many documents. ErrNoGCWork is returned along with the result if
+// no value log file was rewritten. discardRatio must be between 0 and 1,
+// exclusive, and 0.5 is recommended.
+func (d *DB) RunGC(discardRatio float64) (GCResult, error) {
+	if err := d.lockConfig(); err != nil {
+		return GCResult{}, err
+	}
+	defer d.configMutex.Unlock()
+
+	var result GCResult
+
+	type store struct {
+		kv  *badger.KV
+		dir string
 	}
+
+	stores := []store{{d.journal, d.path + "/journal"}}
+	for tableName, table := range d.tables {
+		stores = append(stores, store{table.data, table.dir})
+		if table.changes != nil {
+			stores = append(stores, store{table.changes,
+				table.changeLogDir()})
+		}
+		for indexName, index := range table.indexes {
+			stores = append(stores, store{index.index,
+				d.kvDir(tableName, indexName)})
+		}
+	}
+
+	for _, s := range stores {
+		before := valueLogSize(s.dir)
+
+		err := s.kv.RunValueLogGC(discardRatio)
+		if err == badger.ErrNoRewrite || err == badger.ErrRejected {
+			// A rejected collection means the background collection of the
+			// store is already running.
+			result.Stores++
+			continue
+		} else if err != nil {
+			return result, err
+		}
+
+		result.Stores++
+		result.Rewritten++
+
+		if after := valueLogSize(s.dir); after < before {
+			result.Reclaimed += before - after
+		}
+	}
+
+	if !result.DidWork() {
+		return result, ErrNoGCWork
+	}
+
+	return result, nil
+}
+
+// valueLogSize returns the total size of the value log files in the
+// directory.
+func valueLogSize(dir string) int64 {
+	files, _ := filepath.Glob(filepath.Join(dir, "*.vlog"))
+
+	var size int64
+	for _, path := range files {
+		if stat, err := os.Stat(path); err == nil {
+			size += stat.Size()
+		}
+	}
+
+	return size
+}
+
+// syncDir syncs the value log files in the directory, and then the directory
+// itself.
+func syncDir(dir string) error {
+	files, err := filepath.Glob(filepath.Join(dir, "*.vlog"))
+	if err != nil {
+		return err
+	}
+
+	for _, path := range append(files, dir) {
+		if err := syncFile(path); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func syncFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+
+	if err = file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+// pingKey is the key read by Ping, which is never written.
+var pingKey = []byte("ping")
+
+// Ping checks that the database is open and responsive by reading a key of
+// its journal, which is fast and doesn't write anything, such as for a
+// readiness probe. ErrClosed is returned if the database has been closed.
+func (d *DB) Ping() error {
+	if err := d.acquire(); err != nil {
+		return err
+	}
+	defer d.release()
+
+	_, err := d.journal.Exists(pingKey)
+	return err
+}
+
+// Path returns the path the database was opened at.
+func (d *DB) Path() string {
+	return d.path
 }
 
-// Tables returns the list of tables in the database.
+// Tables returns the list of tables in the database, sorted by name.
 func (d *DB) Tables() []string {
 	var tables []string
 	for name := range d.tables {
 		tables = append(tables, string(name))
 	}
 
+	sort.Strings(tables)
 	return tables
 }
 
@@ -0,0 +1,54 @@
+package jvzc
+
+import (
+	"errors"
+)
+
+var errArrayEncoding = errors.New("jvzc: array encoded tables cannot be " +
+	"indexed")
+
+// SetArrayEncoding sets whether structs written to the table from now on are
+// encoded as msgpack arrays of their field values rather than maps of their
+// field names to values, which saves the space of the field names. Array
+// encoded structs can still be decoded into the same struct type, but not
+// queried by field name, so array encoding can only be enabled on tables
+// without indexes, and NewIndex fails while it is enabled. Documents which
+// are read as a Document or map[string]interface{}, and filters on fields,
+// will also not work with array encoded documents.
+//
+// Existing documents are not rewritten, so documents written with array
+// encoding must be rewritten after it is disabled before the table can be
+// indexed. Array encoding cannot be used with key compression, which is
+// enabled by default, so the table must be created with key compression
+// disabled.
+func (t *Table) SetArrayEncoding(enabled bool) error {
+	if err := t.db.lockConfig(); err != nil {
+		return err
+	}
+	defer t.db.configMutex.Unlock()
+
+	if enabled && len(t.indexes) > 0 {
+		return errArrayEncoding
+	}
+
+	if enabled && t.keyToCompressed != nil {
+		return errors.New("jvzc: array encoding cannot be used with key " +
+			"compression")
+	}
+
+	tableName := t.name()
+	for i, table := range t.db.config.Tables {
+		if table.TableName == tableName {
+			t.db.config.Tables[i].ArrayEncoding = enabled
+			if err := t.db.writeConfig(); err != nil {
+				t.db.config.Tables[i].ArrayEncoding = t.arrayEncoding
+				return err
+			}
+
+			t.arrayEncoding = enabled
+			return nil
+		}
+	}
+
+	return ErrNotFound
+}
@@ -1,9 +1,14 @@
 package jvzc
 
 import (
+	"errors"
 	"io/ioutil"
 	"os"
+	"runtime"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 )
 
 func populateDB(people map[string]Person) (*DB, string) {
@@ -175,3 +180,207 @@ func TestBadFiles(t *testing.T) {
 
 	panicNotNil(os.RemoveAll(dir))
 }
+
+func TestWarnings(t *testing.T) {
+	if testing.Short() {
+		t.Parallel()
+	}
+
+	dir, err := ioutil.TempDir("", "jvzc_")
+	panicNotNil(err)
+
+	t.Log("testing directory:", dir)
+	defer func() {
+		if !t.Failed() {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	db, err := Open(dir + "/data")
+	panicNotNil(err)
+
+	defer db.Close()
+
+	warnings := make(chan Warning, 10)
+	db.OnWarning = func(w Warning) {
+		warnings <- w
+	}
+
+	panicNotNil(db.NewTable("warning_testing"))
+	panicNotNil(db.Table("warning_testing").NewIndex("Age"))
+
+	// Corrupt the index entry for 18.
+	panicNotNil(db.Table("warning_testing").Index("Age").index.Set(
+		valueToBytes(18), []byte{0xc1}, 0))
+
+	err = db.Table("warning_testing").Set("jason", Person{Name: "Jason", Age: 18})
+	if !errors.Is(err, ErrIndexError) {
+		t.Fatal("error should be ErrIndexError, but is", err)
+	}
+
+	_, err = db.Table("warning_testing").Get("jason", nil)
+	panicNotNil(err)
+
+	w := <-warnings
+	if w.Code != CorruptIndex {
+		t.Fatal("warning should be CorruptIndex, but isn't")
+	}
+
+	if w.Name != "warning_testing/Age" {
+		t.Fatal("warning name should be warning_testing/Age, but is", w.Name)
+	}
+
+	if w.Key != "jason" {
+		t.Fatal("warning key should be jason, but is", w.Key)
+	}
+
+	w = <-warnings
+	if w.Code != IndexUpdateFailed || w.Key != "jason" || w.Err == nil {
+		t.Fatal("warning should be IndexUpdateFailed, but isn't")
+	}
+
+	counts := db.Table("warning_testing").IndexErrorCount()
+	if len(counts) != 1 || counts["Age"] != 1 {
+		t.Fatal("index error count should be 1, but isn't")
+	}
+
+	db.Table("warning_testing").Between(1, 2)
+
+	w = <-warnings
+	if w.Code != InvalidBounds || w.Name != "warning_testing" {
+		t.Fatal("warning should be InvalidBounds, but isn't")
+	}
+}
+
+func TestLeakedRange(t *testing.T) {
+	if testing.Short() {
+		t.Parallel()
+	}
+
+	dir, err := ioutil.TempDir("", "jvzc_")
+	panicNotNil(err)
+
+	t.Log("testing directory:", dir)
+	defer func() {
+		if !t.Failed() {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	db, err := Open(dir + "/data")
+	panicNotNil(err)
+
+	defer db.Close()
+
+	warnings := make(chan Warning, 10)
+	db.OnWarning = func(w Warning) {
+		select {
+		case warnings <- w:
+		default:
+		}
+	}
+	db.Debug = true
+
+	panicNotNil(db.NewTable("leak_testing"))
+
+	for i := 0; i < 200; i++ {
+		panicNotNil(db.Table("leak_testing").Set(strconv.Itoa(i), i))
+	}
+
+	r := db.Table("leak_testing").All()
+	r.Next()
+	r.Close()
+
+	func() {
+		r := db.Table("leak_testing").All()
+		r.Next()
+	}()
+
+	for i := 0; i < 50; i++ {
+		runtime.GC()
+
+		select {
+		case w := <-warnings:
+			if w.Code != LeakedRange || w.Name != "leak_testing" {
+				t.Fatal("warning should be LeakedRange, but isn't")
+			}
+
+			if !strings.Contains(w.Err.Error(), "TestLeakedRange") {
+				t.Fatal("warning should contain the creation stack, but doesn't")
+			}
+
+			select {
+			case <-warnings:
+				t.Fatal("closed range should not be reported, but is")
+			case <-time.After(100 * time.Millisecond):
+			}
+			return
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+
+	t.Fatal("leaked range should be reported, but isn't")
+}
+
+func TestRepairHandler(t *testing.T) {
+	if testing.Short() {
+		t.Parallel()
+	}
+
+	dir, err := ioutil.TempDir("", "jvzc_")
+	panicNotNil(err)
+
+	t.Log("testing directory:", dir)
+	defer func() {
+		if !t.Failed() {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	db, err := Open(dir + "/data")
+	panicNotNil(err)
+
+	defer db.Close()
+
+	db.OnWarning = func(w Warning) {}
+
+	panicNotNil(db.NewTable("repair_testing"))
+	table := db.Table("repair_testing")
+	panicNotNil(table.NewIndex("Age"))
+
+	type repair struct {
+		index    string
+		indexKey string
+		key      string
+	}
+
+	var repairs []repair
+	table.SetRepairHandler(func(index string, indexKey []byte, key string) {
+		repairs = append(repairs, repair{index, string(indexKey), key})
+	})
+
+	// Corrupt the index entry for 18.
+	panicNotNil(table.Index("Age").index.Set(valueToBytes(18), []byte{0xc1}, 0))
+
+	err = table.Set("jason", Person{Name: "Jason", Age: 18})
+	if !errors.Is(err, ErrIndexError) {
+		t.Fatal("error should be ErrIndexError, but is", err)
+	}
+
+	if len(repairs) != 1 || repairs[0] != (repair{"Age",
+		string(valueToBytes(18)), "jason"}) {
+		t.Fatal("repair should be requested for 18, but isn't:", repairs)
+	}
+
+	// Repair the index entry, then remove it from under the document.
+	panicNotNil(table.Index("Age").index.Delete(valueToBytes(18)))
+	panicNotNil(table.Index("Age").addToIndex(valueToBytes(18), "jason", nil))
+	panicNotNil(table.Index("Age").index.Delete(valueToBytes(18)))
+
+	panicNotNil(table.Delete("jason"))
+
+	if len(repairs) != 2 || repairs[1] != (repair{"Age",
+		string(valueToBytes(18)), "jason"}) {
+		t.Fatal("repair should be requested for 18, but isn't:", repairs)
+	}
+}
@@ -0,0 +1,27 @@
+package jvzc
+
+import (
+	"fmt"
+	"time"
+)
+
+// TimeKey returns a primary key for the time, such that keys sort in the same
+// order as their times. A unique suffix can be appended to the key to store
+// multiple documents with the same time, such as with
+// TimeKey(t) + "/" + id, which still sort by time. This is intended for
+// tables of time series such as logs and events, which can then be expired
+// with ExpireOlderThan.
+func TimeKey(t time.Time) string {
+	// The sign bit is flipped so that times before 1970 sort first.
+	return fmt.Sprintf("%020d", uint64(t.UnixNano())^(1<<63))
+}
+
+// ExpireOlderThan deletes every document whose primary key was created with
+// TimeKey for a time before the cutoff, and returns the number of documents
+// deleted. Documents are deleted in batches like with DeleteRange, so expiring
+// a large number of documents doesn't hold up other writes to the table.
+// Documents with keys which weren't created with TimeKey may also be deleted
+// if they sort before the cutoff.
+func (t *Table) ExpireOlderThan(cutoff time.Time) (int, error) {
+	return t.deleteRange(MinValue, TimeKey(cutoff), true)
+}
@@ -0,0 +1,82 @@
+package jvzc
+
+import (
+	"io/ioutil"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestTimeKey(t *testing.T) {
+	if testing.Short() {
+		t.Parallel()
+	}
+
+	times := []time.Time{
+		time.Date(1969, 12, 31, 23, 59, 59, 0, time.UTC),
+		time.Unix(0, 0),
+		time.Unix(0, 1),
+		time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(2018, 1, 1, 0, 0, 1, 0, time.UTC),
+	}
+
+	for i := 1; i < len(times); i++ {
+		if TimeKey(times[i-1]) >= TimeKey(times[i]) {
+			t.Fatal("time keys should sort by time, but don't:", times[i-1],
+				times[i])
+		}
+	}
+}
+
+func TestExpireOlderThan(t *testing.T) {
+	if testing.Short() {
+		t.Parallel()
+	}
+
+	dir, err := ioutil.TempDir("", "jvzc_")
+	panicNotNil(err)
+
+	t.Log("testing directory:", dir)
+	defer func() {
+		if !t.Failed() {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	db, err := Open(dir + "/data")
+	panicNotNil(err)
+
+	defer db.Close()
+
+	panicNotNil(db.NewTable("expire_testing"))
+	table := db.Table("expire_testing")
+	panicNotNil(table.NewIndex("City"))
+
+	start := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 100; i++ {
+		key := TimeKey(start.Add(time.Duration(i) * time.Minute))
+		panicNotNil(table.Set(key, Person{Name: "Jason", City: "Sydney"}))
+		panicNotNil(table.Set(key+"/"+strconv.Itoa(i),
+			Person{Name: "Drew", City: "London"}))
+	}
+
+	n, err := table.ExpireOlderThan(start.Add(30 * time.Minute))
+	panicNotNil(err)
+
+	if n != 60 {
+		t.Fatal("60 documents should be expired, but", n, "were")
+	}
+
+	r := table.All()
+	expectPerson(TimeKey(start.Add(30*time.Minute)), r,
+		Person{Name: "Jason", City: "Sydney"})
+	r.Close()
+
+	count, err := table.Index("City").GetAll("London").Count()
+	panicNotNil(err)
+
+	if count != 70 {
+		t.Fatal("70 documents should remain in London, but", count, "do")
+	}
+}
@@ -0,0 +1,367 @@
+package jvzc
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/1lann/badger"
+)
+
+// DuplicatePolicy determines what ImportFrom does with a document whose key
+// already exists in the destination table.
+type DuplicatePolicy int
+
+// Policies for documents which already exist during an import.
+const (
+	// DuplicateError stops the import and returns ErrAlreadyExists.
+	DuplicateError DuplicatePolicy = iota
+	// DuplicateSkip keeps the existing document.
+	DuplicateSkip
+	// DuplicateOverwrite replaces the existing document.
+	DuplicateOverwrite
+)
+
+const importBatchSize = 100
+
+type importEntry struct {
+	key  string
+	data []byte
+}
+
+// ImportFrom copies all of the documents of every table in other into the
+// database, creating any tables and indexes which do not exist yet. Indexes
+// are created with the same queries, options and predicates as those of
+// other, and an error is returned if a partial index of other has no
+// predicate set. Documents are written in batches, and the indexes of the
+// database are updated as they are written. You can optionally specify what
+// to do with documents whose key already exists, which is DuplicateError by
+// default.
+//
+// The import is not atomic. If an error is returned, the documents imported
+// before the error remain in the database. The progress of each table is
+// reported to OnProgress under the "import" operation.
+func (d *DB) ImportFrom(other *DB, onDuplicate ...DuplicatePolicy) error {
+	if other == d {
+		return errors.New("jvzc: cannot import a database into itself")
+	}
+
+	policy := DuplicateError
+	if len(onDuplicate) > 0 {
+		policy = onDuplicate[0]
+	}
+
+	return d.importTables(other, policy, 1)
+}
+
+// newIndexLike creates an index on the table with the same name, query and
+// options as the index of another table. Partial indexes are created with the
+// predicate of the other index, so errNoPredicate is returned if it isn't
+// set.
+func (t *Table) newIndexLike(other *Index) error {
+	predicate := other.getPredicate()
+	if other.partial && predicate == nil {
+		return fmt.Errorf("%w: %s", errNoPredicate, other.name())
+	}
+
+	return t.newIndex(string(other.indexName), other.query, predicate,
+		IndexOptions{
+			Shards:   other.shards,
+			PerKey:   other.perKey,
+			SelfHeal: other.selfHeal,
+			Unique:   other.unique,
+			Project:  other.project,
+		})
+}
+
+// importTables imports every table of other into the database, creating the
+// tables and indexes first, then copying the documents of up to workers
+// tables at a time. Tables which haven't started importing when an error
+// occurs are skipped, and the error of the first table in sorted order to
+// fail is returned.
+func (d *DB) importTables(other *DB, policy DuplicatePolicy,
+	workers int) error {
+	names := other.Tables()
+	sort.Strings(names)
+
+	srcs := make([]*Table, len(names))
+	dsts := make([]*Table, len(names))
+
+	for i, name := range names {
+		src := other.Table(name)
+
+		if d.Table(name) == nil {
+			err := d.NewTable(name, src.keyToCompressed != nil)
+			if err != nil && err != ErrAlreadyExists {
+				return err
+			}
+		}
+
+		dst := d.Table(name)
+
+		for _, indexName := range src.Indexes() {
+			if dst.Index(indexName) != nil {
+				continue
+			}
+
+			err := dst.newIndexLike(src.Index(indexName))
+			if err != nil && err != ErrAlreadyExists {
+				return err
+			}
+		}
+
+		srcs[i], dsts[i] = src, dst
+	}
+
+	if workers < 1 {
+		workers = 1
+	}
+
+	errs := make([]error, len(names))
+	queue := make(chan int)
+	var failed int32
+	var wg sync.WaitGroup
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range queue {
+				if atomic.LoadInt32(&failed) != 0 {
+					continue
+				}
+
+				errs[i] = dsts[i].importFrom(srcs[i], policy)
+				if errs[i] != nil {
+					atomic.StoreInt32(&failed, 1)
+				}
+			}
+		}()
+	}
+
+	for i := range names {
+		queue <- i
+	}
+	close(queue)
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (t *Table) importFrom(src *Table, policy DuplicatePolicy) error {
+	r := src.All()
+	defer r.Close()
+
+	p := t.db.newProgress("import", t.name(), src.data)
+	batch := make([]importEntry, 0, importBatchSize)
+
+	// Index errors don't stop the import, the first one is returned once
+	// all the documents have been imported.
+	var indexErr error
+
+	for r.Next() {
+		// Documents are decoded and marshalled again, as the key compression
+		// of the two tables will differ.
+		var value interface{}
+		if err := r.Decode(&value); err != nil {
+			return err
+		}
+
+		data, err := t.marshal(value)
+		if err != nil {
+			return err
+		}
+
+		batch = append(batch, importEntry{key: r.Key(), data: data})
+		if len(batch) == importBatchSize {
+			err := t.importBatch(batch, policy)
+			if err = keepIndexError(&indexErr, err); err != nil {
+				return err
+			}
+
+			batch = batch[:0]
+		}
+
+		p.add()
+	}
+
+	if r.Error() != ErrEndOfRange {
+		return r.Error()
+	}
+
+	err := t.importBatch(batch, policy)
+	if err = keepIndexError(&indexErr, err); err != nil {
+		return err
+	}
+
+	p.report()
+
+	return indexErr
+}
+
+// keepIndexError stores err in indexErr if it is the first index error, and
+// returns err if it is any other error.
+func keepIndexError(indexErr *error, err error) error {
+	if !errors.Is(err, ErrIndexError) {
+		return err
+	}
+
+	if *indexErr == nil {
+		*indexErr = err
+	}
+
+	return nil
+}
+
+func (t *Table) importBatch(batch []importEntry, policy DuplicatePolicy) error {
+	keys := make([]string, len(batch))
+	for i, e := range batch {
+		keys[i] = e.key
+	}
+
+	// Listeners are notified once the documents are unlocked, as they may
+	// write to them.
+	var written []string
+	defer func() {
+		for _, key := range written {
+			t.changed(ChangeSet, key)
+		}
+	}()
+	defer t.lockKeys(keys)()
+
+	if t.hasUniqueIndex() && !t.deferIndexes() {
+		t.uniqueMutex.Lock()
+		defer t.uniqueMutex.Unlock()
+	}
+
+	return t.writeImportBatch(batch, policy, &written)
+}
+
+// writeImportBatch writes a batch of imported documents, which must be locked
+// by importBatch, and appends the keys of the written documents to written.
+func (t *Table) writeImportBatch(batch []importEntry,
+	policy DuplicatePolicy, written *[]string) error {
+	var entries []*badger.Entry
+	var imported []importEntry
+	var diffs [][2][]diffEntry
+	var indexErr error
+
+	if err := t.checkPredicates(); err != nil {
+		return err
+	}
+
+	// The unique index values added by the batch, as they aren't in the
+	// indexes until the batch is written.
+	added := make(map[string]string)
+
+	for _, e := range batch {
+		if !t.validStoreKey(e.key) {
+			return ErrBadIdentifier
+		}
+
+		var item badger.KVItem
+		if err := t.data.Get(t.dataKey(e.key), &item); err != nil {
+			return err
+		}
+
+		old, err := t.itemData(&item)
+		if err != nil {
+			return err
+		}
+
+		if old != nil {
+			if policy == DuplicateSkip {
+				continue
+			} else if policy != DuplicateOverwrite {
+				return ErrAlreadyExists
+			}
+		}
+
+		stored, err := t.encodeValue(e.data, t.nextMeta(&item))
+		if err != nil {
+			return err
+		}
+
+		additions, removals, diffErr := t.diffIndexes(e.key, old, e.data)
+		keepIndexError(&indexErr, diffErr)
+
+		if err := t.checkUnique(e.key, additions); err != nil {
+			return err
+		}
+
+		for _, addition := range additions {
+			index := t.indexes[Name(addition.IndexName)]
+			if !index.unique {
+				continue
+			}
+
+			value := addition.IndexName + "\x00" + string(addition.IndexKey)
+			if other, found := added[value]; found && other != e.key {
+				return fmt.Errorf("%w: %s", ErrNotUnique, index.name())
+			}
+
+			added[value] = e.key
+		}
+
+		done, err := t.journalWrite(e.key, item.Counter(), ChangeSet,
+			additions, removals)
+		if err != nil {
+			return err
+		}
+		defer done()
+
+		entry := &badger.Entry{
+			Key:             t.dataKey(e.key),
+			Value:           stored,
+			CASCounterCheck: item.Counter(),
+		}
+		if item.Counter() == 0 {
+			// A zero counter isn't checked, so documents which didn't exist
+			// are only written if they still don't exist.
+			entry.Meta = badger.BitSetIfAbsent
+		}
+
+		entries = append(entries, entry)
+		imported = append(imported, e)
+		diffs = append(diffs, [2][]diffEntry{additions, removals})
+	}
+
+	if len(entries) == 0 {
+		return nil
+	}
+
+	if err := t.data.BatchSet(entries); err != nil {
+		return err
+	}
+
+	for i, entry := range entries {
+		if entry.Error == badger.ErrCasMismatch ||
+			entry.Error == badger.ErrKeyExists {
+			// The document was changed while it was being imported, so try
+			// again with the new document.
+			err := t.writeImportBatch(imported[i:i+1], policy, written)
+			if err = keepIndexError(&indexErr, err); err != nil {
+				return err
+			}
+
+			continue
+		} else if entry.Error != nil {
+			return entry.Error
+		}
+
+		keepIndexError(&indexErr, t.applyIndexDiffs(imported[i].key,
+			diffs[i][0], diffs[i][1], false))
+
+		*written = append(*written, imported[i].key)
+	}
+
+	return indexErr
+}
@@ -0,0 +1,275 @@
+package jvzc
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestImportFrom(t *testing.T) {
+	if testing.Short() {
+		t.Parallel()
+	}
+
+	dir, err := ioutil.TempDir("", "jvzc_")
+	panicNotNil(err)
+
+	t.Log("testing directory:", dir)
+	defer func() {
+		if !t.Failed() {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	src, err := Open(dir + "/src")
+	panicNotNil(err)
+
+	defer src.Close()
+
+	dst, err := Open(dir + "/dst")
+	panicNotNil(err)
+
+	defer dst.Close()
+
+	panicNotNil(src.NewTable("people"))
+	panicNotNil(src.Table("people").NewIndex("City"))
+
+	for i := 0; i < 150; i++ {
+		panicNotNil(src.Table("people").Set("person"+strconv.Itoa(i),
+			Person{Name: "Person", City: "Sydney", Age: i}))
+	}
+
+	jason := Person{Name: "Jason", City: "Sydney", Age: 18}
+	panicNotNil(src.Table("people").Set("jason", jason))
+
+	// The destination table does not use key compression, and has a
+	// conflicting document.
+	panicNotNil(dst.NewTable("people", false))
+	oldJason := Person{Name: "Jason", City: "Melbourne", Age: 17}
+	panicNotNil(dst.Table("people").Set("jason", oldJason))
+
+	if dst.ImportFrom(src) != ErrAlreadyExists {
+		t.Fatal("error should be ErrAlreadyExists, but isn't")
+	}
+
+	panicNotNil(dst.ImportFrom(src, DuplicateSkip))
+
+	if dst.Table("people").Index("City") == nil {
+		t.Fatal("index should be created, but isn't")
+	}
+
+	n, err := dst.Table("people").Index("City").GetAll("Sydney").Count()
+	panicNotNil(err)
+
+	if n != 150 {
+		t.Fatal("count should be 150, but is", n)
+	}
+
+	var person Person
+	_, err = dst.Table("people").Get("jason", &person)
+	panicNotNil(err)
+
+	if !person.IsSame(oldJason) {
+		t.Fatal("person should be the old jason, but isn't")
+	}
+
+	_, err = dst.Table("people").Get("person42", &person)
+	panicNotNil(err)
+
+	if !person.IsSame(Person{Name: "Person", City: "Sydney", Age: 42}) {
+		t.Fatal("person should be person42, but isn't")
+	}
+
+	panicNotNil(dst.ImportFrom(src, DuplicateOverwrite))
+
+	_, err = dst.Table("people").Get("jason", &person)
+	panicNotNil(err)
+
+	if !person.IsSame(jason) {
+		t.Fatal("person should be jason, but isn't")
+	}
+
+	n, err = dst.Table("people").Index("City").GetAll("Melbourne").Count()
+	panicNotNil(err)
+
+	if n != 0 {
+		t.Fatal("count should be 0, but is", n)
+	}
+
+	n, err = dst.Table("people").Index("City").GetAll("Sydney").Count()
+	panicNotNil(err)
+
+	if n != 151 {
+		t.Fatal("count should be 151, but is", n)
+	}
+}
+
+func TestImportFromIndexOptions(t *testing.T) {
+	if testing.Short() {
+		t.Parallel()
+	}
+
+	dir, err := ioutil.TempDir("", "jvzc_")
+	panicNotNil(err)
+
+	t.Log("testing directory:", dir)
+	defer func() {
+		if !t.Failed() {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	src, err := Open(dir + "/src")
+	panicNotNil(err)
+
+	dst, err := Open(dir + "/dst")
+	panicNotNil(err)
+
+	defer dst.Close()
+
+	panicNotNil(src.NewTable("people"))
+	table := src.Table("people")
+	panicNotNil(table.NewUniqueMultiIndex("NameCity", "Name", "City"))
+	panicNotNil(table.NewCoveringIndex("CityNames", "City", "Name"))
+	panicNotNil(table.NewIndex("Age", IndexOptions{Shards: 4,
+		SelfHeal: true}))
+	panicNotNil(table.NewPartialIndex("Adults", "City",
+		func(doc Document) bool {
+			return doc.QueryInt("Age") >= 18
+		}))
+
+	panicNotNil(table.Set("jason", Person{Name: "Jason", City: "Sydney",
+		Age: 18}))
+	panicNotNil(table.Set("drew", Person{Name: "Drew", City: "Sydney",
+		Age: 17}))
+
+	panicNotNil(dst.ImportFrom(src))
+
+	// Indexes are created in sorted order, rather than the order they were
+	// created in the source.
+	indexConfigs := func(table *Table) map[string]IndexConfig {
+		configs := make(map[string]IndexConfig)
+		for _, config := range table.Config().Indexes {
+			configs[config.Name] = config
+		}
+		return configs
+	}
+
+	if !reflect.DeepEqual(indexConfigs(dst.Table("people")),
+		indexConfigs(table)) {
+		t.Fatal("indexes should be the same as the source, but aren't")
+	}
+
+	n, err := dst.Table("people").Index("Adults").GetAll("Sydney").Count()
+	panicNotNil(err)
+
+	if n != 1 {
+		t.Fatal("count should be 1, but is", n)
+	}
+
+	err = dst.Table("people").Set("jason2", Person{Name: "Jason",
+		City: "Sydney"})
+	if !errors.Is(err, ErrNotUnique) {
+		t.Fatal("error should be ErrNotUnique, but is", err)
+	}
+
+	// The predicate isn't persisted, so the partial index can't be created
+	// once the source is reopened.
+	src.Close()
+	src, err = Open(dir + "/src")
+	panicNotNil(err)
+
+	defer src.Close()
+
+	other, err := Open(dir + "/other")
+	panicNotNil(err)
+
+	defer other.Close()
+
+	if err := other.ImportFrom(src); !errors.Is(err, errNoPredicate) {
+		t.Fatal("error should be errNoPredicate, but is", err)
+	}
+}
+
+func TestImportFromConcurrentSet(t *testing.T) {
+	if testing.Short() {
+		t.Parallel()
+	}
+
+	dir, err := ioutil.TempDir("", "jvzc_")
+	panicNotNil(err)
+
+	t.Log("testing directory:", dir)
+	defer func() {
+		if !t.Failed() {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	src, err := Open(dir + "/src")
+	panicNotNil(err)
+
+	defer src.Close()
+
+	dst, err := Open(dir + "/dst")
+	panicNotNil(err)
+
+	defer dst.Close()
+
+	const count = 1000
+
+	panicNotNil(src.NewTable("people"))
+	for i := 0; i < count; i++ {
+		panicNotNil(src.Table("people").Set("person"+strconv.Itoa(i),
+			Person{Name: "Person", City: "Sydney", Age: i}))
+	}
+
+	panicNotNil(dst.NewTable("people"))
+	table := dst.Table("people")
+	panicNotNil(table.NewIndex("City"))
+
+	// Documents which are created while they are being imported must not be
+	// overwritten without updating the index.
+	stop := make(chan struct{})
+	done := make(chan error)
+	go func() {
+		for i := 0; ; i = (i + 7) % count {
+			select {
+			case <-stop:
+				done <- nil
+				return
+			default:
+			}
+
+			err := table.Set("person"+strconv.Itoa(i),
+				Person{Name: "Person", City: "Paris", Age: i})
+			if err != nil {
+				done <- err
+				return
+			}
+		}
+	}()
+
+	panicNotNil(dst.ImportFrom(src, DuplicateOverwrite))
+	close(stop)
+	panicNotNil(<-done)
+
+	report, err := table.Index("City").Verify()
+	panicNotNil(err)
+
+	if report.Orphaned != 0 || report.Missing != 0 {
+		t.Fatal("index should be consistent, but isn't:", report)
+	}
+
+	sydney, err := table.Index("City").GetAll("Sydney").Count()
+	panicNotNil(err)
+	paris, err := table.Index("City").GetAll("Paris").Count()
+	panicNotNil(err)
+
+	if sydney+paris != count {
+		t.Fatal("count should be", count, "but is", sydney+paris)
+	}
+}
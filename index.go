@@ -2,9 +2,14 @@ package jvzc
 
 import (
 	"bytes"
-	"log"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/fnv"
 	"os"
+	"sort"
 	"strings"
+	"sync"
 	"sync/atomic"
 
 	"github.com/1lann/badger"
@@ -22,18 +27,202 @@ var (
 
 const prefetchSize = 2
 
+var errNoPredicate = errors.New("jvzc: partial index has no predicate")
+
+// MaxShards is the maximum number of shards of an index.
+const MaxShards = 256
+
+// IndexOptions represents the options of an index, which can optionally be
+// specified to NewIndex.
+type IndexOptions struct {
+	// Shards splits the list of primary keys stored for each index value
+	// across the given number of keys, with each primary key assigned to a
+	// shard by its hash. This reduces contention between concurrent writes
+	// to documents with the same index value, which is common with low
+	// cardinality indexes such as booleans, at the cost of lookups having to
+	// read every shard. 0 or 1 disables sharding. It must be no more than
+	// MaxShards.
+	Shards int
+
+	// PerKey stores each primary key as its own entry under the index value,
+	// rather than in a list shared by all the documents with the same index
+	// value. Adding or removing a document from the index is then a single
+	// independent write instead of a compare-and-set loop on the list, which
+	// removes contention between concurrent writes entirely. It cannot be
+	// combined with Shards.
+	PerKey bool
+
+	// ValidateSample is the number of documents of the table which are
+	// checked for the indexed field when the index is created. If none of
+	// them contain the field, which is almost always a typo, a
+	// MissingIndexField warning is reported. 0 disables validation.
+	ValidateSample int
+
+	// StrictValidation makes NewIndex return ErrFieldNotFound instead of
+	// reporting a warning if validation fails, without creating the index.
+	StrictValidation bool
+
+	// SelfHeal removes primary keys whose documents no longer exist from the
+	// index when they are found by GetAll or One, which gradually repairs an
+	// index which has drifted from its table, such as after a crash. Such
+	// keys are always skipped. A document deleted while it is being read may
+	// be removed by both, which is reported as a CorruptIndex warning.
+	SelfHeal bool
+
+	// Unique only allows one document to have each index value. Writing a
+	// document with an index value another document already has fails with
+	// ErrNotUnique without writing the document, and creating the index
+	// fails with ErrNotUnique if the documents of the table already have
+	// duplicate values. Writes to tables with unique indexes are serialized,
+	// and uniqueness is not enforced while the table is bulk loaded. It
+	// cannot be combined with Shards or PerKey.
+	Unique bool
+
+	// Project is the fields of documents which are stored with their
+	// primary keys in the index, which makes it a covering index that can be
+	// read with GetAllProjected without reading the documents. It implies
+	// PerKey, and cannot be combined with Shards or Unique. It is set by
+	// NewCoveringIndex.
+	Project []string
+}
+
 // NewIndex creates a new index on the table, using the name as the Query.
 // The index name must not be empty, and must be no more than 125 bytes
 // long. ErrAlreadyExists will be returned if the index already exists.
+// You can optionally specify IndexOptions to configure the index.
+//
+// To index each element of a slice field, such as a list of tags, use a
+// wildcard query like "Tags.*". The document will be indexed under every
+// element, so GetAll("tag") returns the documents containing "tag", and
+// only the elements which were added or removed are updated when the
+// document changes. Compound indexes are created by separating queries with
+// commas, such as "City,Age".
+//
+// Only documents which are maps or structs can be indexed. Documents whose
+// indexed field can't be queried, such as strings or slices, are left out of
+// the index and reported as an UnindexableDocument warning, and writing them
+// returns an error wrapping ErrIndexError.
 //
 // NewIndex may take a while if there are already values in the
 // table, as it needs to index all the existing values in the table.
-func (t *Table) NewIndex(name string) error {
-	if name == "" || len(name) > 125 {
+func (t *Table) NewIndex(name string, opts ...IndexOptions) error {
+	return t.newIndex(name, name, nil, opts...)
+}
+
+// NewPartialIndex creates a new index on the table like NewIndex, using
+// field as the Query, which only contains the documents for which the
+// predicate returns true. Documents are removed from the index when they are
+// changed to no longer match the predicate, and added when they are changed
+// to match it. This keeps indexes small when only some documents are queried
+// by the index, such as only active users.
+//
+// The predicate is not persisted, and must be set with SetPredicate every
+// time the database is opened, before documents are written to the table.
+// Until it is set, the index will fail to update.
+func (t *Table) NewPartialIndex(name, field string,
+	predicate func(doc Document) bool, opts ...IndexOptions) error {
+	if predicate == nil {
+		return errors.New("jvzc: partial index must have a predicate")
+	}
+
+	return t.newIndex(name, field, predicate, opts...)
+}
+
+// NewUniqueMultiIndex creates a new compound index on the table like
+// NewIndex, with the Unique option, whose Query is the fields separated by
+// commas. Only one document can have each combination of values of the
+// fields, while separate documents can share the values of each field.
+func (t *Table) NewUniqueMultiIndex(name string, fields ...string) error {
+	if len(fields) == 0 {
+		return ErrBadIdentifier
+	}
+
+	for _, field := range fields {
+		if field == "" || strings.Contains(field, ",") {
+			return ErrBadIdentifier
+		}
+	}
+
+	return t.newIndex(name, strings.Join(fields, ","), nil,
+		IndexOptions{Unique: true})
+}
+
+// NewCoveringIndex creates a new index on the table like NewIndex, using
+// keyField as the Query, which also stores the projectFields of each document
+// with its primary key. GetAllProjected returns the stored fields without
+// reading the documents, which is faster for listing documents by only a
+// few of their fields. The stored fields are updated whenever they change.
+func (t *Table) NewCoveringIndex(name, keyField string,
+	projectFields ...string) error {
+	if len(projectFields) == 0 {
+		return ErrBadIdentifier
+	}
+
+	for _, field := range projectFields {
+		if field == "" {
+			return ErrBadIdentifier
+		}
+	}
+
+	return t.newIndex(name, keyField, nil, IndexOptions{Project: projectFields})
+}
+
+func (t *Table) newIndex(name, query string, predicate func(doc Document) bool,
+	opts ...IndexOptions) error {
+	if name == "" || len(name) > 125 || query == "" {
 		return ErrBadIdentifier
 	}
 
-	t.db.configMutex.Lock()
+	var options IndexOptions
+	if len(opts) > 0 {
+		options = opts[0]
+	}
+
+	if options.Shards < 0 || options.Shards > MaxShards {
+		return errors.New("jvzc: invalid number of index shards")
+	}
+
+	if options.Shards == 1 {
+		options.Shards = 0
+	}
+
+	if options.PerKey && options.Shards > 0 {
+		return errors.New("jvzc: per key indexes cannot be sharded")
+	}
+
+	if options.Unique && (options.PerKey || options.Shards > 0) {
+		return errors.New("jvzc: unique indexes cannot be sharded or per key")
+	}
+
+	if len(options.Project) > 0 {
+		if options.Unique || options.Shards > 0 {
+			return errors.New("jvzc: covering indexes cannot be sharded " +
+				"or unique")
+		}
+
+		options.PerKey = true
+	}
+
+	if options.ValidateSample > 0 {
+		found, err := t.sampleHasField(query, options.ValidateSample)
+		if err != nil {
+			return err
+		}
+
+		if !found && options.StrictValidation {
+			return ErrFieldNotFound
+		} else if !found {
+			t.db.warn(Warning{
+				Code: MissingIndexField,
+				Name: t.name() + "/" + name,
+				Err:  ErrFieldNotFound,
+			})
+		}
+	}
+
+	if err := t.db.lockConfig(); err != nil {
+		return err
+	}
 
 	tableName := t.name()
 	tableConfigKey := -1
@@ -41,6 +230,11 @@ func (t *Table) NewIndex(name string) error {
 	for key, table := range t.db.config.Tables {
 		if table.TableName == tableName {
 			tableConfigKey = key
+			if table.ArrayEncoding {
+				t.db.configMutex.Unlock()
+				return errArrayEncoding
+			}
+
 			for _, index := range table.Indexes {
 				if index.IndexName == name {
 					t.db.configMutex.Unlock()
@@ -62,7 +256,21 @@ func (t *Table) NewIndex(name string) error {
 	}
 
 	indexes := t.db.config.Tables[tableConfigKey].Indexes
-	indexes = append(indexes, indexConfig{IndexName: name})
+	config := indexConfig{
+		IndexName: name,
+		Shards:    options.Shards,
+		PerKey:    options.PerKey,
+		Partial:   predicate != nil,
+		SelfHeal:  options.SelfHeal,
+		Unique:    options.Unique,
+		Project:   options.Project,
+	}
+
+	if query != name {
+		config.Field = query
+	}
+
+	indexes = append(indexes, config)
 	t.db.config.Tables[tableConfigKey].Indexes = indexes
 	if err = t.db.writeConfig(); err != nil {
 		t.db.configMutex.Unlock()
@@ -72,48 +280,206 @@ func (t *Table) NewIndex(name string) error {
 	t.db.configMutex.Unlock()
 
 	idx := &Index{
-		index: kv,
-		table: t,
+		index:     kv,
+		table:     t,
+		indexName: Name(name),
+		query:     query,
+		shards:    options.Shards,
+		perKey:    options.PerKey,
+		selfHeal:  options.SelfHeal,
+		unique:    options.Unique,
+		project:   options.Project,
+		partial:   predicate != nil,
+		predicate: predicate,
+
+		predicateMutex: new(sync.RWMutex),
 	}
 
 	t.indexes[Name(name)] = idx
 
-	if err = idx.indexValues(name); err != nil {
-		log.Println("jvzc: error while indexing \""+
-			idx.name()+"\", index likely corrupt:", err)
+	if err = idx.indexValues(defaultReindexWorkers); err != nil {
+		t.db.warn(Warning{
+			Code: IndexUpdateFailed,
+			Name: idx.name(),
+			Err:  err,
+		})
 		return nil
 	}
 
+	if idx.unique {
+		duplicated, err := idx.hasDuplicates()
+		if err != nil {
+			return err
+		}
+
+		if duplicated {
+			if err = idx.Drop(); err != nil {
+				return err
+			}
+
+			return fmt.Errorf("%w: %s", ErrNotUnique, idx.name())
+		}
+	}
+
 	return nil
 }
 
-func (i *Index) indexValues(name string) error {
-	var total int64
+// hasDuplicates returns whether any value of the index has more than one
+// primary key.
+func (i *Index) hasDuplicates() (bool, error) {
+	if err := i.table.db.acquire(); err != nil {
+		return false, err
+	}
+	defer i.table.db.release()
 
-	i.table.Between(MinValue, MaxValue).Do(func(key string, counter uint64, doc Document) error {
-		last := atomic.AddInt64(&total, 1)
-		if last%100000 == 0 {
-			log.Println(last)
-		}
+	if err := i.table.acquireRange(i); err != nil {
+		return false, err
+	}
+	defer i.table.releaseRange()
 
-		results, err := i.indexQuery(doc.data, name)
+	it := i.index.NewIterator(badger.DefaultIteratorOptions)
+	defer it.Close()
+
+	for it.Rewind(); it.Valid(); it.Next() {
+		var keys []string
+		err := msgpack.Unmarshal(getItemValue(it.Item()), &keys)
 		if err != nil {
-			return nil
+			return false, err
 		}
 
-		for _, result := range results {
-			err = i.addToIndex(valueToBytes(result), key)
-			if err != nil {
-				log.Println("jvzc: index error for index \""+name+"\":", err)
-			}
+		if len(keys) > 1 {
+			return true, nil
 		}
+	}
+
+	return false, nil
+}
+
+// SetPredicate sets the predicate of a partial index created with
+// NewPartialIndex. It must be called every time the database is opened, as
+// the predicate is not persisted. Until it is called, writes to the table
+// fail with an error without being written, so that the index doesn't miss
+// them. It may be called while documents are written, in which case each
+// write uses either the previous or the new predicate.
+func (i *Index) SetPredicate(predicate func(doc Document) bool) {
+	i.predicateMutex.Lock()
+	i.predicate = predicate
+	i.predicateMutex.Unlock()
+}
+
+// getPredicate returns the predicate of a partial index, which is nil if it
+// hasn't been set.
+func (i *Index) getPredicate() func(doc Document) bool {
+	i.predicateMutex.RLock()
+	defer i.predicateMutex.RUnlock()
 
+	return i.predicate
+}
+
+// checkPredicates returns an error wrapping errNoPredicate if a partial
+// index of the table has no predicate, in which case documents can't be
+// written without the index missing them. Indexes aren't updated while the
+// table is bulk loaded, so it can be written to then.
+func (t *Table) checkPredicates() error {
+	if t.deferIndexes() {
 		return nil
-	}, 20)
+	}
+
+	for _, index := range t.indexes {
+		if index.partial && index.getPredicate() == nil {
+			return fmt.Errorf("%w: %s", errNoPredicate, index.name())
+		}
+	}
 
 	return nil
 }
 
+// IndexKind describes the shape of an index, as a combination of the kinds
+// below. An index which has none of them is a simple index of one field.
+type IndexKind int
+
+// Kinds of indexes, which are combined by Kind.
+const (
+	// IndexCompound indexes more than one field, such as "City,Age".
+	IndexCompound IndexKind = 1 << iota
+	// IndexMulti indexes every element of a slice field with a wildcard
+	// query, such as "Tags.*".
+	IndexMulti
+	// IndexUnique only allows one document to have each index value.
+	IndexUnique
+	// IndexPartial only contains the documents matching a predicate.
+	IndexPartial
+	// IndexCovering stores a projection of each document.
+	IndexCovering
+)
+
+// Has returns whether the kind includes all of the given kinds.
+func (k IndexKind) Has(kind IndexKind) bool {
+	return k&kind == kind
+}
+
+// Kind returns the shape of the index, as persisted when it was created.
+func (i *Index) Kind() IndexKind {
+	var kind IndexKind
+
+	fields := i.Fields()
+	if len(fields) > 1 {
+		kind |= IndexCompound
+	}
+
+	for _, field := range fields {
+		if strings.Contains(field, "*") {
+			kind |= IndexMulti
+			break
+		}
+	}
+
+	if i.unique {
+		kind |= IndexUnique
+	}
+
+	if i.partial {
+		kind |= IndexPartial
+	}
+
+	if len(i.project) > 0 {
+		kind |= IndexCovering
+	}
+
+	return kind
+}
+
+// Fields returns the queries of the fields indexed by the index, which is
+// the Query of the index split by commas for compound indexes.
+func (i *Index) Fields() []string {
+	return strings.Split(i.query, ",")
+}
+
+// sampleHasField returns whether any of the first n documents of the table
+// contain a value for the index query. It returns true if the table is empty.
+func (t *Table) sampleHasField(query string, n int) (bool, error) {
+	idx := &Index{table: t}
+
+	r := t.All().Limit(int64(n))
+	defer r.Close()
+
+	empty := true
+	for r.Next() {
+		empty = false
+
+		results, err := idx.indexQuery(r.lastEntry.data, query)
+		if err == nil && len(results) > 0 {
+			return true, nil
+		}
+	}
+
+	if r.Error() != ErrEndOfRange {
+		return false, r.Error()
+	}
+
+	return empty, nil
+}
+
 func (i *Index) indexQuery(data []byte, query string) ([]interface{}, error) {
 	rd := bytes.NewReader(data)
 	dec := msgpack.NewDecoder(rd)
@@ -175,10 +541,102 @@ func (i *Index) One(key interface{}, dst interface{}) (string, uint64, error) {
 	return r.Key(), r.Counter(), r.Decode(dst)
 }
 
+// Contains returns whether any document has the value in the index, without
+// reading the documents, such as to check whether a value is in use. It
+// reads the list of primary keys of the value, so it is much faster than
+// scanning the table, but a document deleted while its index entry failed to
+// be removed is still found.
+func (i *Index) Contains(value interface{}) (bool, error) {
+	keys, err := i.getKeys(valueToBytes(value))
+	if err != nil {
+		return false, err
+	}
+
+	return len(keys) > 0, nil
+}
+
+// Page returns up to limit documents with the index value whose primary keys
+// sort after afterKey, and the token to pass as afterKey to get the next
+// page, which is empty if there are no more documents. Pass an empty afterKey
+// to get the first page. Unlike GetAll, documents are sorted by their primary
+// keys, so that pages remain consistent if documents are added or removed
+// between them, including the document of afterKey.
+func (i *Index) Page(value interface{}, afterKey string,
+	limit int) ([]Document, string, error) {
+	if limit <= 0 {
+		return nil, "", errors.New("jvzc: page limit must be positive")
+	}
+
+	atomic.AddUint64(&i.table.ops.Ranges, 1)
+
+	keys, err := i.getKeys(valueToBytes(value))
+	if err != nil {
+		return nil, "", err
+	}
+
+	sort.Strings(keys)
+	start := sort.Search(len(keys), func(j int) bool {
+		return keys[j] > afterKey
+	})
+
+	var docs []Document
+	for j := start; j < len(keys); j++ {
+		if j > start && keys[j] == keys[j-1] {
+			continue
+		}
+
+		if len(docs) == limit {
+			return docs, keys[j-1], nil
+		}
+
+		data, _, err := i.table.getRaw(keys[j])
+		if err == ErrNotFound {
+			continue
+		} else if err != nil {
+			return nil, "", err
+		}
+
+		docs = append(docs, Document{
+			data:  append([]byte(nil), data...),
+			table: i.table,
+		})
+	}
+
+	return docs, "", nil
+}
+
 // GetAll returns all the matching values as a range for the provided index key.
 func (i *Index) GetAll(key interface{}) *Range {
+	atomic.AddUint64(&i.table.ops.Ranges, 1)
+
+	return resettable(i.getAll(key), func() *Range {
+		return i.getAll(key)
+	})
+}
+
+func (i *Index) getAll(key interface{}) *Range {
+	if err := i.table.db.acquire(); err != nil {
+		return newRange(func() (string, []byte, uint64, error) {
+			return "", nil, 0, err
+		}, func() {}, nil)
+	}
+	defer i.table.db.release()
+
+	indexKey := valueToBytes(key)
+
+	if i.shards > 0 || i.perKey {
+		keys, err := i.getKeys(indexKey)
+		if err != nil {
+			return newRange(func() (string, []byte, uint64, error) {
+				return "", nil, 0, err
+			}, func() {}, nil)
+		}
+
+		return i.table.keysRange(keys, i.healer(indexKey)...)
+	}
+
 	var item badger.KVItem
-	err := i.index.Get(valueToBytes(key), &item)
+	err := i.index.Get(indexKey, &item)
 	if err != nil {
 		return newRange(func() (string, []byte, uint64, error) {
 			return "", nil, 0, err
@@ -192,7 +650,7 @@ func (i *Index) GetAll(key interface{}) *Range {
 		}, func() {}, nil)
 	}
 
-	r, err := i.getAllValues(itemValue)
+	r, err := i.getAllValues(itemValue, i.healer(indexKey)...)
 	if err != nil {
 		return newRange(func() (string, []byte, uint64, error) {
 			return "", nil, 0, err
@@ -201,47 +659,142 @@ func (i *Index) GetAll(key interface{}) *Range {
 	return r
 }
 
-func (i *Index) getAllValues(indexValue []byte) (*Range, error) {
+// healer returns the function which removes a dangling primary key from the
+// index key, if the index self heals.
+func (i *Index) healer(indexKey []byte) []func(key string) {
+	if !i.selfHeal {
+		return nil
+	}
+
+	return []func(key string){func(key string) {
+		_, err := i.removeFromIndex(indexKey, key)
+		if err != nil {
+			i.table.db.warn(Warning{
+				Code: IndexUpdateFailed,
+				Name: i.name(),
+				Key:  key,
+				Err:  err,
+			})
+		}
+	}}
+}
+
+func (i *Index) getAllValues(indexValue []byte,
+	missing ...func(key string)) (*Range, error) {
 	var keys []string
 	err := msgpack.Unmarshal(indexValue, &keys)
 	if err != nil {
-		log.Println("jvzc: corrupt index \""+i.name()+"\":", err)
+		i.table.db.warn(Warning{Code: CorruptIndex, Name: i.name(), Err: err})
 		return nil, ErrIndexError
 	}
 
 	if len(keys) == 0 {
-		log.Println("jvzc: corrupt index \""+i.name()+"\":", err)
+		i.table.db.warn(Warning{Code: CorruptIndex, Name: i.name()})
 		return nil, ErrIndexError
 	}
 
-	c := 0
-	var value []byte
-	var item badger.KVItem
+	return i.table.keysRange(keys, missing...), nil
+}
 
-	return newRange(func() (string, []byte, uint64, error) {
-		for {
-			if c >= len(keys) {
-				return "", nil, 0, ErrEndOfRange
-			}
+// getKeys returns the list of primary keys stored under the index key. A nil
+// list is returned if there are no documents with the index key.
+func (i *Index) getKeys(indexKey []byte) ([]string, error) {
+	if err := i.table.db.acquire(); err != nil {
+		return nil, err
+	}
+	defer i.table.db.release()
 
-			err = i.table.data.Get([]byte(keys[c]), &item)
-			if err != nil {
-				return "", nil, 0, err
-			}
+	if i.perKey {
+		return i.getEntries(indexKey)
+	}
 
-			itemValue := getItemValue(&item)
-			if itemValue == nil {
-				c++
-				continue
-			}
+	if i.shards == 0 {
+		return i.getList(indexKey)
+	}
+
+	var keys []string
+	for shard := 0; shard < i.shards; shard++ {
+		list, err := i.getList(appendEntrySuffix(indexKey, []byte{byte(shard)}))
+		if err != nil {
+			return nil, err
+		}
+
+		keys = append(keys, list...)
+	}
+
+	return keys, nil
+}
+
+// hasKey returns whether the primary key is stored under the index key.
+func (i *Index) hasKey(indexKey []byte, key string) bool {
+	keys, err := i.getKeys(indexKey)
+	if err != nil {
+		return false
+	}
+
+	for _, k := range keys {
+		if k == key {
+			return true
+		}
+	}
+
+	return false
+}
+
+// getEntries returns the primary keys stored as separate entries under the
+// index key of a per key index.
+func (i *Index) getEntries(indexKey []byte) ([]string, error) {
+	if err := i.table.acquireRange(i); err != nil {
+		return nil, err
+	}
+	defer i.table.releaseRange()
+
+	it := i.index.NewIterator(badger.DefaultIteratorOptions)
+	defer it.Close()
 
-			value = make([]byte, len(itemValue))
-			copy(value, itemValue)
+	var keys []string
+	for it.Seek(indexKey); it.Valid(); it.Next() {
+		if !bytes.Equal(i.indexKeyOf(it.Item().Key()), indexKey) {
+			break
+		}
 
-			c++
-			return keys[c-1], value, item.Counter(), nil
+		list, err := i.decodeList(getItemValue(it.Item()))
+		if err != nil {
+			return nil, err
 		}
-	}, func() {}, i.table), nil
+
+		keys = append(keys, list...)
+	}
+
+	return keys, nil
+}
+
+// getList returns the list of primary keys stored under a key of the index.
+func (i *Index) getList(entryKey []byte) ([]string, error) {
+	var item badger.KVItem
+	err := i.index.Get(entryKey, &item)
+	if err != nil {
+		return nil, err
+	}
+
+	return i.decodeList(getItemValue(&item))
+}
+
+// decodeList decodes a list of primary keys stored in the index. A nil list
+// is returned if the value is nil.
+func (i *Index) decodeList(itemValue []byte) ([]string, error) {
+	if itemValue == nil {
+		return nil, nil
+	}
+
+	var keys []string
+	err := msgpack.Unmarshal(itemValue, &keys)
+	if err != nil {
+		i.table.db.warn(Warning{Code: CorruptIndex, Name: i.name(), Err: err})
+		return nil, ErrIndexError
+	}
+
+	return keys, nil
 }
 
 // Between returns a Range of documents between the lower and upper index values
@@ -254,13 +807,53 @@ func (i *Index) getAllValues(indexValue []byte) (*Range, error) {
 // You can use jvzc.MinValue and jvzc.MaxValue to specify minimum and maximum
 // bound values.
 func (i *Index) Between(lower, upper interface{}, reverse ...bool) *Range {
+	return i.BetweenWithOptions(lower, upper, IndexRangeOptions{
+		Reverse: len(reverse) > 0 && reverse[0],
+	})
+}
+
+// IndexRangeOptions configures a range returned by Index.BetweenWithOptions.
+// The zero value is the same as the range returned by Between.
+type IndexRangeOptions struct {
+	// Reverse sorts the range in descending order by index value.
+	Reverse bool
+	// ReverseKeys reverses the order of the documents with the same index
+	// value, independently of the order of the index values. By default,
+	// they are in the order they were added to the index, or for indexes
+	// with the PerKey option, in the order of their primary keys, which is
+	// descending if Reverse is set.
+	ReverseKeys bool
+}
+
+// BetweenWithOptions is like Between, but configured by opts.
+func (i *Index) BetweenWithOptions(lower, upper interface{},
+	opts IndexRangeOptions) *Range {
+	atomic.AddUint64(&i.table.ops.Ranges, 1)
+
+	r := resettable(i.between(lower, upper, opts), func() *Range {
+		return i.between(lower, upper, opts)
+	})
+
+	r.lower, r.upper, r.reverse = lower, upper, opts.Reverse
+
+	return r
+}
+
+func (i *Index) between(lower, upper interface{},
+	opts IndexRangeOptions) *Range {
 	if lower == MaxValue || upper == MinValue {
 		return newRange(func() (string, []byte, uint64, error) {
 			return "", nil, 0, ErrEndOfRange
 		}, func() {}, nil)
 	}
 
-	shouldReverse := (len(reverse) > 0) && reverse[0]
+	shouldReverse := opts.Reverse
+
+	if err := i.table.acquireRange(i); err != nil {
+		return newRange(func() (string, []byte, uint64, error) {
+			return "", nil, 0, err
+		}, func() {}, nil)
+	}
 
 	itOpts := badger.DefaultIteratorOptions
 	itOpts.PrefetchSize = prefetchSize
@@ -279,6 +872,21 @@ func (i *Index) Between(lower, upper interface{}, reverse ...bool) *Range {
 	} else {
 		if upper == MaxValue {
 			it.Rewind()
+		} else if i.perKey {
+			// Entries of the upper index key sort after it, so seek past all
+			// of them and skip back to the last one.
+			if end := prefixEnd(upperBytes); end != nil {
+				it.Seek(end)
+			} else {
+				it.Rewind()
+			}
+
+			for it.Valid() &&
+				bytes.Compare(i.indexKeyOf(it.Item().Key()), upperBytes) > 0 {
+				it.Next()
+			}
+		} else if i.shards > 0 {
+			it.Seek(appendEntrySuffix(upperBytes, []byte{0xff}))
 		} else {
 			it.Seek(upperBytes)
 		}
@@ -286,13 +894,18 @@ func (i *Index) Between(lower, upper interface{}, reverse ...bool) *Range {
 
 	var lastRange *Range
 
-	return newRange(i.betweenNext(it, lastRange, shouldReverse, lower, upper),
+	next, closer := guardIterator(i.table.db,
+		i.betweenNext(it, lastRange, shouldReverse, opts.ReverseKeys, lower,
+			upper),
 		func() {
 			if lastRange != nil {
 				lastRange.Close()
 			}
 			it.Close()
-		}, i.table)
+			i.table.releaseRange()
+		})
+
+	return newRange(next, closer, i.table)
 }
 
 // CountBetween returns the number of documents whose index values are
@@ -304,9 +917,20 @@ func (i *Index) CountBetween(lower, upper interface{}) int64 {
 		return 0
 	}
 
+	if i.table.db.acquire() != nil {
+		return 0
+	}
+	defer i.table.db.release()
+
+	if i.table.acquireRange(i) != nil {
+		return 0
+	}
+	defer i.table.releaseRange()
+
 	itOpts := badger.DefaultIteratorOptions
 	itOpts.PrefetchSize = prefetchSize
 	it := i.index.NewIterator(itOpts)
+	defer it.Close()
 
 	upperBytes := valueToBytes(upper)
 	lowerBytes := valueToBytes(lower)
@@ -321,17 +945,11 @@ func (i *Index) CountBetween(lower, upper interface{}) int64 {
 
 	for it.Valid() {
 		if upper != MaxValue &&
-			bytes.Compare(it.Item().Key(), upperBytes) > 0 {
+			bytes.Compare(i.indexKeyOf(it.Item().Key()), upperBytes) > 0 {
 			return count
 		}
 
-		itemValue := getItemValue(it.Item())
-		if len(itemValue) < 5 {
-			// Malformed index value my cause a panic here
-			count += decodeArrayCount(itemValue)
-		} else {
-			count += decodeArrayCount(itemValue[:5])
-		}
+		count += listCount(getItemValue(it.Item()))
 
 		it.Next()
 	}
@@ -339,6 +957,188 @@ func (i *Index) CountBetween(lower, upper interface{}) int64 {
 	return count
 }
 
+// ApproxCardinality returns the number of distinct values in the index. It
+// is approximate as documents may be written while the index is being
+// counted. Only the keys of the index are read, which is much faster than
+// counting the documents in the index.
+func (i *Index) ApproxCardinality() (int, error) {
+	if err := i.table.db.acquire(); err != nil {
+		return 0, err
+	}
+	defer i.table.db.release()
+
+	if err := i.table.acquireRange(i); err != nil {
+		return 0, err
+	}
+	defer i.table.releaseRange()
+
+	if i.shards == 0 && !i.perKey {
+		return countKeys(i.index), nil
+	}
+
+	itOpts := badger.DefaultIteratorOptions
+	itOpts.PrefetchValues = false
+	it := i.index.NewIterator(itOpts)
+	defer it.Close()
+
+	var count int
+	var last []byte
+	for it.Rewind(); it.Valid(); it.Next() {
+		indexKey := i.indexKeyOf(it.Item().Key())
+		if last == nil || !bytes.Equal(indexKey, last) {
+			last = append(last[:0], indexKey...)
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+// HotValues returns the number of documents of every index value which has
+// at least minCount documents. The values are the keys of the index, which
+// are encoded the same way as they are sorted, so for example string values
+// are lowercased and followed by a zero byte. Writing documents with these
+// values contends on the same key of the index, which can be avoided by
+// sharding the index with the Shards option.
+func (i *Index) HotValues(minCount int) (map[string]int, error) {
+	values := make(map[string]int)
+
+	err := i.countValues(func(indexKey []byte, count int64) {
+		if count >= int64(minCount) {
+			values[string(indexKey)] = int(count)
+		}
+	})
+
+	return values, err
+}
+
+// countValues calls fn with the number of documents of every index value, in
+// ascending order of index value.
+func (i *Index) countValues(fn func(indexKey []byte, count int64)) error {
+	if err := i.table.db.acquire(); err != nil {
+		return err
+	}
+	defer i.table.db.release()
+
+	if err := i.table.acquireRange(i); err != nil {
+		return err
+	}
+	defer i.table.releaseRange()
+
+	itOpts := badger.DefaultIteratorOptions
+	itOpts.PrefetchSize = prefetchSize
+	it := i.index.NewIterator(itOpts)
+	defer it.Close()
+
+	var last []byte
+	var count int64
+	for it.Rewind(); it.Valid(); it.Next() {
+		indexKey := i.indexKeyOf(it.Item().Key())
+		if last != nil && !bytes.Equal(indexKey, last) {
+			fn(last, count)
+			count = 0
+		}
+
+		last = append(last[:0], indexKey...)
+		count += listCount(getItemValue(it.Item()))
+	}
+
+	if last != nil {
+		fn(last, count)
+	}
+
+	return nil
+}
+
+// entryKey returns the key of the index under which the primary key is
+// stored for the index key. For sharded indexes, this is the index key
+// followed by the shard of the primary key, and for per key indexes it is the
+// index key followed by the primary key.
+func (i *Index) entryKey(indexKey []byte, key string) []byte {
+	if i.perKey {
+		return appendEntrySuffix(indexKey, []byte(key))
+	}
+
+	if i.shards == 0 {
+		return indexKey
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	shard := byte(h.Sum32() % uint32(i.shards))
+
+	return appendEntrySuffix(indexKey, []byte{shard})
+}
+
+// indexKeyOf returns the index key of a key of the index, reversing entryKey.
+func (i *Index) indexKeyOf(entryKey []byte) []byte {
+	if i.shards == 0 && !i.perKey {
+		return entryKey
+	}
+
+	indexKey, _ := splitEntryKey(entryKey)
+	return indexKey
+}
+
+// appendEntrySuffix returns the index key followed by the suffix, and the
+// length of the suffix as a big endian uint32 so that it can be split again
+// with splitEntryKey.
+func appendEntrySuffix(indexKey, suffix []byte) []byte {
+	result := make([]byte, len(indexKey), len(indexKey)+len(suffix)+4)
+	copy(result, indexKey)
+	result = append(result, suffix...)
+
+	var length [4]byte
+	binary.BigEndian.PutUint32(length[:], uint32(len(suffix)))
+
+	return append(result, length[:]...)
+}
+
+func splitEntryKey(entryKey []byte) ([]byte, []byte) {
+	if len(entryKey) < 4 {
+		return entryKey, nil
+	}
+
+	end := len(entryKey) - 4
+	n := int(binary.BigEndian.Uint32(entryKey[end:]))
+	if n > end {
+		return entryKey, nil
+	}
+
+	return entryKey[:end-n], entryKey[end-n : end]
+}
+
+// prefixEnd returns the smallest key which is greater than every key
+// starting with the prefix, or nil if there is no such key.
+func prefixEnd(prefix []byte) []byte {
+	end := make([]byte, len(prefix))
+	copy(end, prefix)
+
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return end[:i+1]
+		}
+	}
+
+	return nil
+}
+
+// listCount returns the number of primary keys in a list stored in the index,
+// without decoding the list.
+func listCount(itemValue []byte) int64 {
+	if len(itemValue) == 0 {
+		return 0
+	}
+
+	if len(itemValue) < 5 {
+		// Malformed index value my cause a panic here
+		return decodeArrayCount(itemValue)
+	}
+
+	return decodeArrayCount(itemValue[:5])
+}
+
 func decodeArrayCount(header []byte) int64 {
 	if (header[0] >> 4) == 9 {
 		return int64(header[0] & 0xf)
@@ -354,7 +1154,7 @@ func decodeArrayCount(header []byte) int64 {
 }
 
 func (i *Index) betweenNext(it *badger.Iterator, lastRange *Range,
-	shouldReverse bool, lower,
+	shouldReverse, reverseKeys bool, lower,
 	upper interface{}) func() (string, []byte, uint64, error) {
 	upperBytes := valueToBytes(upper)
 	lowerBytes := valueToBytes(lower)
@@ -363,7 +1163,7 @@ func (i *Index) betweenNext(it *badger.Iterator, lastRange *Range,
 
 	return func() (string, []byte, uint64, error) {
 		if lastRange != nil {
-			entry = <-lastRange.buffer
+			entry, _ = lastRange.receive()
 			if entry.err != ErrEndOfRange {
 				return entry.key, entry.data, entry.counter, entry.err
 			}
@@ -372,23 +1172,30 @@ func (i *Index) betweenNext(it *badger.Iterator, lastRange *Range,
 		}
 
 		for it.Valid() {
+			indexKey := i.indexKeyOf(it.Item().Key())
 			if !shouldReverse && upper != MaxValue &&
-				bytes.Compare(it.Item().Key(), upperBytes) > 0 {
+				bytes.Compare(indexKey, upperBytes) > 0 {
 				return "", nil, 0, ErrEndOfRange
 			} else if shouldReverse && lower != MinValue &&
-				bytes.Compare(it.Item().Key(), lowerBytes) < 0 {
+				bytes.Compare(indexKey, lowerBytes) < 0 {
 				return "", nil, 0, ErrEndOfRange
 			}
 
-			r, err := i.getAllValues(getItemValue(it.Item()))
-			it.Next()
+			var r *Range
+			var err error
+			if reverseKeys {
+				r, err = i.reversedValues(it, indexKey)
+			} else {
+				r, err = i.getAllValues(getItemValue(it.Item()))
+				it.Next()
+			}
 			if err != nil {
 				continue
 			}
 
 			lastRange = r
 
-			entry = <-lastRange.buffer
+			entry, _ = lastRange.receive()
 			if entry.err != ErrEndOfRange {
 				return entry.key, entry.data, entry.counter, entry.err
 			}
@@ -400,6 +1207,39 @@ func (i *Index) betweenNext(it *badger.Iterator, lastRange *Range,
 	}
 }
 
+// reversedValues returns a range of the documents with the index key in the
+// reverse of the order they are iterated over, advancing the iterator past
+// every item of the index key, of which sharded and per key indexes have
+// several.
+func (i *Index) reversedValues(it *badger.Iterator,
+	indexKey []byte) (*Range, error) {
+	indexKey = append([]byte(nil), indexKey...)
+
+	var keys []string
+	for ; it.Valid() &&
+		bytes.Equal(i.indexKeyOf(it.Item().Key()), indexKey); it.Next() {
+		var list []string
+		err := msgpack.Unmarshal(getItemValue(it.Item()), &list)
+		if err != nil {
+			i.table.db.warn(Warning{Code: CorruptIndex, Name: i.name(),
+				Err: err})
+			continue
+		}
+
+		keys = append(keys, list...)
+	}
+
+	if len(keys) == 0 {
+		return nil, ErrIndexError
+	}
+
+	for l, r := 0, len(keys)-1; l < r; l, r = l+1, r-1 {
+		keys[l], keys[r] = keys[r], keys[l]
+	}
+
+	return i.table.keysRange(keys), nil
+}
+
 // All returns all the documents which have an index value. It is shorthand
 // for Between(MinValue, MaxValue, reverse...)
 func (i *Index) All(reverse ...bool) *Range {
@@ -408,24 +1248,29 @@ func (i *Index) All(reverse ...bool) *Range {
 
 // Drop drops the index from the table, deleting its folder from the disk.
 // All further calls to the index will result in undefined behaviour.
-// Note that table.Index("deleted index") will be nil.
+// Note that table.Index("deleted index") will be nil. ErrInUse will be returned
+// if there are ranges over the table or its indexes which have not been
+// closed yet.
 func (i *Index) Drop() error {
-	i.table.db.configMutex.Lock()
+	if err := i.table.db.lockConfig(); err != nil {
+		return err
+	}
 	defer i.table.db.configMutex.Unlock()
 
 	tableName := i.table.name()
 
-	var indexName string
-
-	for idxName, index := range i.table.indexes {
-		if index == i {
-			indexName = string(idxName)
-		}
+	indexName := string(i.indexName)
+	if i.table.indexes[i.indexName] != i {
+		return ErrNotFound
 	}
 
-	if indexName == "" {
-		return ErrNotFound
+	i.table.rangeMutex.Lock()
+	if i.table.openRanges > 0 {
+		i.table.rangeMutex.Unlock()
+		return ErrInUse
 	}
+	i.dropped = true
+	i.table.rangeMutex.Unlock()
 
 tableLoop:
 	for key, table := range i.table.db.config.Tables {
@@ -442,6 +1287,9 @@ tableLoop:
 	}
 
 	if err := i.table.db.writeConfig(); err != nil {
+		i.table.rangeMutex.Lock()
+		i.dropped = false
+		i.table.rangeMutex.Unlock()
 		return err
 	}
 
@@ -2,8 +2,14 @@ package jvzc
 
 import (
 	"bytes"
+	"errors"
+	"fmt"
 	"io/ioutil"
 	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -1335,3 +1341,928 @@ func TestIndexAll(t *testing.T) {
 		t.Fatal("error should be ErrEndOfRange, but isn't")
 	}
 }
+
+func TestShardedIndex(t *testing.T) {
+	if testing.Short() {
+		t.Parallel()
+	}
+
+	dir, err := ioutil.TempDir("", "jvzc_")
+	panicNotNil(err)
+
+	t.Log("testing directory:", dir)
+	defer func() {
+		if !t.Failed() {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	db, err := Open(dir + "/data")
+	panicNotNil(err)
+
+	panicNotNil(db.NewTable("shard_testing"))
+
+	if db.Table("shard_testing").NewIndex("City",
+		IndexOptions{Shards: MaxShards + 1}) == nil {
+		t.Fatal("too many shards should have an error, but doesn't")
+	}
+
+	panicNotNil(db.Table("shard_testing").NewIndex("City",
+		IndexOptions{Shards: 8}))
+	panicNotNil(db.Table("shard_testing").NewIndex("Age",
+		IndexOptions{Shards: 8}))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				panicNotNil(db.Table("shard_testing").Set(
+					strconv.Itoa(i*20+j+1000),
+					Person{Name: "Jason", City: "Sydney", Age: j}))
+			}
+		}(i)
+	}
+
+	wg.Wait()
+
+	panicNotNil(db.Table("shard_testing").Set("ben",
+		Person{Name: "Ben", City: "Melbourne", Age: 100}))
+
+	db.Close()
+
+	db, err = Open(dir + "/data")
+	panicNotNil(err)
+
+	defer db.Close()
+
+	table := db.Table("shard_testing")
+
+	n, err := table.Index("City").GetAll("Sydney").Count()
+	panicNotNil(err)
+
+	if n != 200 {
+		t.Fatal("count should be 200, but is", n)
+	}
+
+	if table.Index("City").CountBetween("Sydney", "Sydney") != 200 {
+		t.Fatal("count between should be 200, but isn't")
+	}
+
+	cardinality, err := table.Index("City").ApproxCardinality()
+	panicNotNil(err)
+
+	if cardinality != 2 {
+		t.Fatal("cardinality should be 2, but is", cardinality)
+	}
+
+	r := table.Index("Age").Between(18, 100, true)
+	expectPerson("ben", r, Person{Name: "Ben", City: "Melbourne", Age: 100})
+
+	n, err = r.Count()
+	panicNotNil(err)
+
+	if n != 20 {
+		t.Fatal("count should be 20, but is", n)
+	}
+
+	r = table.Index("Age").Between(MinValue, 0)
+	n, err = r.Count()
+	panicNotNil(err)
+
+	if n != 10 {
+		t.Fatal("count should be 10, but is", n)
+	}
+
+	for i := 0; i < 200; i++ {
+		panicNotNil(table.Delete(strconv.Itoa(i + 1000)))
+	}
+
+	n, err = table.Index("City").GetAll("Sydney").Count()
+	panicNotNil(err)
+
+	if n != 0 {
+		t.Fatal("count should be 0, but is", n)
+	}
+
+	var person Person
+	_, _, err = table.Index("City").One("Melbourne", &person)
+	panicNotNil(err)
+
+	if person.Name != "Ben" {
+		t.Fatal("person should be ben, but isn't")
+	}
+}
+
+func TestPerKeyIndex(t *testing.T) {
+	if testing.Short() {
+		t.Parallel()
+	}
+
+	dir, err := ioutil.TempDir("", "jvzc_")
+	panicNotNil(err)
+
+	t.Log("testing directory:", dir)
+	defer func() {
+		if !t.Failed() {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	db, err := Open(dir + "/data")
+	panicNotNil(err)
+
+	panicNotNil(db.NewTable("per_key_testing"))
+
+	if db.Table("per_key_testing").NewIndex("City",
+		IndexOptions{PerKey: true, Shards: 8}) == nil {
+		t.Fatal("sharded per key index should have an error, but doesn't")
+	}
+
+	panicNotNil(db.Table("per_key_testing").NewIndex("City",
+		IndexOptions{PerKey: true}))
+	panicNotNil(db.Table("per_key_testing").NewIndex("Age",
+		IndexOptions{PerKey: true}))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				panicNotNil(db.Table("per_key_testing").Set(
+					strconv.Itoa(i*20+j+1000),
+					Person{Name: "Jason", City: "Sydney", Age: j}))
+			}
+		}(i)
+	}
+
+	wg.Wait()
+
+	panicNotNil(db.Table("per_key_testing").Set("ben",
+		Person{Name: "Ben", City: "Melbourne", Age: 100}))
+
+	db.Close()
+
+	db, err = Open(dir + "/data")
+	panicNotNil(err)
+
+	defer db.Close()
+
+	table := db.Table("per_key_testing")
+
+	n, err := table.Index("City").GetAll("Sydney").Count()
+	panicNotNil(err)
+
+	if n != 200 {
+		t.Fatal("count should be 200, but is", n)
+	}
+
+	if table.Index("City").CountBetween("Sydney", "Sydney") != 200 {
+		t.Fatal("count between should be 200, but isn't")
+	}
+
+	cardinality, err := table.Index("City").ApproxCardinality()
+	panicNotNil(err)
+
+	if cardinality != 2 {
+		t.Fatal("cardinality should be 2, but is", cardinality)
+	}
+
+	r := table.Index("Age").Between(18, 100, true)
+	expectPerson("ben", r, Person{Name: "Ben", City: "Melbourne", Age: 100})
+
+	n, err = r.Count()
+	panicNotNil(err)
+
+	if n != 20 {
+		t.Fatal("count should be 20, but is", n)
+	}
+
+	n, err = table.Index("Age").Between(MinValue, 0).Count()
+	panicNotNil(err)
+
+	if n != 10 {
+		t.Fatal("count should be 10, but is", n)
+	}
+
+	for i := 0; i < 200; i++ {
+		panicNotNil(table.Delete(strconv.Itoa(i + 1000)))
+	}
+
+	n, err = table.Index("City").GetAll("Sydney").Count()
+	panicNotNil(err)
+
+	if n != 0 {
+		t.Fatal("count should be 0, but is", n)
+	}
+
+	var person Person
+	_, _, err = table.Index("City").One("Melbourne", &person)
+	panicNotNil(err)
+
+	if person.Name != "Ben" {
+		t.Fatal("person should be ben, but isn't")
+	}
+}
+
+func BenchmarkIndexConcurrentSet(b *testing.B) {
+	benchmarks := []struct {
+		name    string
+		options IndexOptions
+	}{
+		{"List", IndexOptions{}},
+		{"Sharded", IndexOptions{Shards: 16}},
+		{"PerKey", IndexOptions{PerKey: true}},
+	}
+
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			dir, err := ioutil.TempDir("", "jvzc_")
+			panicNotNil(err)
+			defer os.RemoveAll(dir)
+
+			db, err := Open(dir + "/data")
+			panicNotNil(err)
+			defer db.Close()
+
+			panicNotNil(db.NewTable("bench"))
+			table := db.Table("bench")
+			panicNotNil(table.NewIndex("City", bm.options))
+
+			var next int64
+
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					key := strconv.FormatInt(atomic.AddInt64(&next, 1), 10)
+					panicNotNil(table.Set(key,
+						Person{Name: "Jason", City: "Sydney", Age: 18}))
+				}
+			})
+		})
+	}
+}
+
+func TestIndexValidation(t *testing.T) {
+	if testing.Short() {
+		t.Parallel()
+	}
+
+	dir, err := ioutil.TempDir("", "jvzc_")
+	panicNotNil(err)
+
+	t.Log("testing directory:", dir)
+	defer func() {
+		if !t.Failed() {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	db, err := Open(dir + "/data")
+	panicNotNil(err)
+
+	defer db.Close()
+
+	var warnings []Warning
+	var mutex sync.Mutex
+	db.OnWarning = func(w Warning) {
+		mutex.Lock()
+		warnings = append(warnings, w)
+		mutex.Unlock()
+	}
+
+	panicNotNil(db.NewTable("validation_testing"))
+	table := db.Table("validation_testing")
+
+	panicNotNil(table.NewIndex("Nmae", IndexOptions{
+		ValidateSample:   10,
+		StrictValidation: true,
+	}))
+	panicNotNil(table.Index("Nmae").Drop())
+
+	for i := 0; i < 20; i++ {
+		panicNotNil(table.Set(strconv.Itoa(i),
+			Person{Name: "Jason", City: "Sydney", Age: i}))
+	}
+
+	err = table.NewIndex("Nmae", IndexOptions{
+		ValidateSample:   10,
+		StrictValidation: true,
+	})
+	if err != ErrFieldNotFound {
+		t.Fatal("error should be ErrFieldNotFound, but is", err)
+	}
+
+	if table.Index("Nmae") != nil {
+		t.Fatal("index should not exist, but does")
+	}
+
+	panicNotNil(table.NewIndex("Nmae", IndexOptions{ValidateSample: 10}))
+
+	mutex.Lock()
+	if len(warnings) != 1 || warnings[0].Code != MissingIndexField ||
+		warnings[0].Name != "validation_testing/Nmae" {
+		t.Fatal("warnings should have a MissingIndexField, but is", warnings)
+	}
+	mutex.Unlock()
+
+	panicNotNil(table.NewIndex("Name", IndexOptions{
+		ValidateSample:   10,
+		StrictValidation: true,
+	}))
+}
+
+func TestPartialIndex(t *testing.T) {
+	if testing.Short() {
+		t.Parallel()
+	}
+
+	dir, err := ioutil.TempDir("", "jvzc_")
+	panicNotNil(err)
+
+	t.Log("testing directory:", dir)
+	defer func() {
+		if !t.Failed() {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	db, err := Open(dir + "/data")
+	panicNotNil(err)
+
+	adult := func(doc Document) bool {
+		return doc.QueryInt("Age") >= 18
+	}
+
+	panicNotNil(db.NewTable("partial_testing"))
+	table := db.Table("partial_testing")
+
+	panicNotNil(table.Set("jason", Person{Name: "Jason", City: "Sydney", Age: 18}))
+	panicNotNil(table.Set("ben", Person{Name: "Ben", City: "Sydney", Age: 12}))
+
+	panicNotNil(table.NewPartialIndex("AdultCity", "City", adult))
+
+	expectCount := func(table *Table, city string, count int64) {
+		n, err := table.Index("AdultCity").GetAll(city).Count()
+		panicNotNil(err)
+
+		if n != count {
+			t.Fatal("count of", city, "should be", count, "but is", n)
+		}
+	}
+
+	expectCount(table, "Sydney", 1)
+
+	panicNotNil(table.Set("ben", Person{Name: "Ben", City: "Sydney", Age: 18}))
+	expectCount(table, "Sydney", 2)
+
+	panicNotNil(table.Set("jason", Person{Name: "Jason", City: "Sydney", Age: 17}))
+	expectCount(table, "Sydney", 1)
+
+	panicNotNil(table.Set("drew", Person{Name: "Drew", City: "London", Age: 10}))
+	expectCount(table, "London", 0)
+
+	config := table.Config().Indexes[0]
+	if config.Name != "AdultCity" || config.Field != "City" || !config.Partial {
+		t.Fatal("index config should be partial, but is", config)
+	}
+
+	db.Close()
+
+	db, err = Open(dir + "/data")
+	panicNotNil(err)
+
+	defer db.Close()
+
+	db.OnWarning = func(w Warning) {}
+
+	table = db.Table("partial_testing")
+
+	// Writes are rejected until the predicate is set, so that the index
+	// doesn't miss them.
+	err = table.Set("drew", Person{Name: "Drew", City: "London", Age: 18})
+	if !errors.Is(err, errNoPredicate) {
+		t.Fatal("error should be errNoPredicate, but is", err)
+	}
+
+	var drew Person
+	_, err = table.Get("drew", &drew)
+	panicNotNil(err)
+
+	if drew.Age != 10 {
+		t.Fatal("drew should not be written, but is")
+	}
+
+	if err = table.Delete("ben"); !errors.Is(err, errNoPredicate) {
+		t.Fatal("error should be errNoPredicate, but is", err)
+	}
+
+	table.Index("AdultCity").SetPredicate(adult)
+	expectCount(table, "London", 0)
+	expectCount(table, "Sydney", 1)
+
+	panicNotNil(table.Set("drew", Person{Name: "Drew", City: "Paris", Age: 18}))
+	expectCount(table, "Paris", 1)
+
+	panicNotNil(table.Delete("ben"))
+	expectCount(table, "Sydney", 0)
+}
+
+func TestHotValues(t *testing.T) {
+	if testing.Short() {
+		t.Parallel()
+	}
+
+	dir, err := ioutil.TempDir("", "jvzc_")
+	panicNotNil(err)
+
+	t.Log("testing directory:", dir)
+	defer func() {
+		if !t.Failed() {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	db, err := Open(dir + "/data")
+	panicNotNil(err)
+
+	defer db.Close()
+
+	panicNotNil(db.NewTable("hot_testing"))
+	table := db.Table("hot_testing")
+	panicNotNil(table.NewIndex("City"))
+	panicNotNil(table.NewIndex("Age", IndexOptions{Shards: 4}))
+
+	for i := 0; i < 30; i++ {
+		panicNotNil(table.Set(strconv.Itoa(i),
+			Person{Name: "Jason", City: "Sydney", Age: 18}))
+	}
+
+	panicNotNil(table.Set("ben", Person{Name: "Ben", City: "Melbourne", Age: 19}))
+	panicNotNil(table.Set("drew", Person{Name: "Drew", City: "Melbourne", Age: 19}))
+
+	values, err := table.Index("City").HotValues(2)
+	panicNotNil(err)
+
+	if len(values) != 2 || values[string(valueToBytes("Sydney"))] != 30 ||
+		values[string(valueToBytes("Melbourne"))] != 2 {
+		t.Fatal("hot values should be Sydney and Melbourne, but aren't:",
+			values)
+	}
+
+	values, err = table.Index("City").HotValues(3)
+	panicNotNil(err)
+
+	if len(values) != 1 || values[string(valueToBytes("Sydney"))] != 30 {
+		t.Fatal("hot values should be Sydney, but aren't:", values)
+	}
+
+	values, err = table.Index("Age").HotValues(10)
+	panicNotNil(err)
+
+	if len(values) != 1 || values[string(valueToBytes(18))] != 30 {
+		t.Fatal("sharded hot values should be 18, but aren't:", values)
+	}
+}
+
+func TestSelfHealIndex(t *testing.T) {
+	if testing.Short() {
+		t.Parallel()
+	}
+
+	dir, err := ioutil.TempDir("", "jvzc_")
+	panicNotNil(err)
+
+	t.Log("testing directory:", dir)
+	defer func() {
+		if !t.Failed() {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	db, err := Open(dir + "/data")
+	panicNotNil(err)
+
+	defer db.Close()
+
+	panicNotNil(db.NewTable("heal_testing"))
+	table := db.Table("heal_testing")
+	panicNotNil(table.NewIndex("City", IndexOptions{SelfHeal: true}))
+	panicNotNil(table.NewIndex("Name", IndexOptions{SelfHeal: true,
+		PerKey: true}))
+	panicNotNil(table.NewIndex("Age"))
+
+	jason := Person{Name: "Jason", City: "Sydney", Age: 18}
+	panicNotNil(table.Set("jason", jason))
+	panicNotNil(table.Set("other", Person{Name: "Jason", City: "Sydney",
+		Age: 18}))
+
+	// Delete the document without updating its indexes.
+	panicNotNil(table.data.Delete([]byte("other")))
+
+	for _, index := range []string{"City", "Name", "Age"} {
+		value := map[string]interface{}{
+			"City": "Sydney", "Name": "Jason", "Age": 18,
+		}[index]
+
+		r := table.Index(index).GetAll(value)
+		expectPerson("jason", r, jason)
+		if r.Next() {
+			t.Fatal("dangling document should be skipped, but isn't")
+		}
+		r.Close()
+
+		keys, err := table.Index(index).getKeys(valueToBytes(value))
+		panicNotNil(err)
+
+		if index == "Age" && len(keys) != 2 {
+			t.Fatal("index without self healing should have 2 keys, but has",
+				keys)
+		} else if index != "Age" && len(keys) != 1 {
+			t.Fatal(index, "index should have healed to 1 key, but has", keys)
+		}
+	}
+
+	if !table.Config().Indexes[0].Options.SelfHeal {
+		t.Fatal("self healing should be in the config, but isn't")
+	}
+}
+
+func TestConcurrentIndexSet(t *testing.T) {
+	if testing.Short() {
+		t.Parallel()
+	}
+
+	dir, err := ioutil.TempDir("", "jvzc_")
+	panicNotNil(err)
+
+	t.Log("testing directory:", dir)
+	defer func() {
+		if !t.Failed() {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	db, err := Open(dir + "/data")
+	panicNotNil(err)
+
+	defer db.Close()
+
+	panicNotNil(db.NewTable("concurrent_set_testing"))
+	table := db.Table("concurrent_set_testing")
+	panicNotNil(table.NewIndex("City"))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 25; j++ {
+				panicNotNil(table.Set("jason", Person{Name: "Jason",
+					City: strconv.Itoa(i*25 + j), Age: 18}))
+			}
+		}(i)
+	}
+
+	wg.Wait()
+
+	report, err := table.Index("City").Verify()
+	panicNotNil(err)
+
+	if !report.OK() {
+		t.Fatal("index should be consistent, but isn't:", report)
+	}
+
+	if report.Entries != 1 {
+		t.Fatal("entries should be 1, but is", report.Entries)
+	}
+}
+
+func TestUnindexableDocument(t *testing.T) {
+	if testing.Short() {
+		t.Parallel()
+	}
+
+	dir, err := ioutil.TempDir("", "jvzc_")
+	panicNotNil(err)
+
+	t.Log("testing directory:", dir)
+	defer func() {
+		if !t.Failed() {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	db, err := Open(dir + "/data")
+	panicNotNil(err)
+
+	defer db.Close()
+
+	var warnings []Warning
+	var mutex sync.Mutex
+	db.OnWarning = func(w Warning) {
+		mutex.Lock()
+		warnings = append(warnings, w)
+		mutex.Unlock()
+	}
+
+	panicNotNil(db.NewTable("unindexable_testing"))
+	table := db.Table("unindexable_testing")
+	jason := Person{Name: "Jason", City: "Sydney", Age: 18}
+	panicNotNil(table.Set("jason", jason))
+	panicNotNil(table.Set("early", "not a map"))
+	panicNotNil(table.NewIndex("City"))
+
+	err = table.Set("string", "not a map")
+	if !errors.Is(err, ErrIndexError) {
+		t.Fatal("error should be ErrIndexError, but is", err)
+	}
+
+	// The document is still written.
+	var value string
+	_, err = table.Get("string", &value)
+	panicNotNil(err)
+
+	if value != "not a map" {
+		t.Fatal("value should be \"not a map\", but is", value)
+	}
+
+	mutex.Lock()
+	if len(warnings) != 2 || warnings[0].Code != UnindexableDocument ||
+		warnings[0].Key != "early" || warnings[1].Code != UnindexableDocument ||
+		warnings[1].Name != "unindexable_testing/City" ||
+		warnings[1].Key != "string" {
+		t.Fatal("warnings should have two UnindexableDocument, but is",
+			warnings)
+	}
+	mutex.Unlock()
+
+	if table.IndexErrorCount()["City"] != 1 {
+		t.Fatal("index error count should be 1, but isn't")
+	}
+
+	// Replacing the document with one which can be queried indexes it.
+	panicNotNil(table.Set("string", jason))
+
+	r := table.Index("City").GetAll("Sydney")
+	expectPerson("jason", r, jason)
+	expectPerson("string", r, jason)
+	r.Close()
+}
+
+func TestIndexReverseKeys(t *testing.T) {
+	if testing.Short() {
+		t.Parallel()
+	}
+
+	dir, err := ioutil.TempDir("", "jvzc_")
+	panicNotNil(err)
+
+	t.Log("testing directory:", dir)
+	defer func() {
+		if !t.Failed() {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	db, err := Open(dir + "/data")
+	panicNotNil(err)
+
+	defer db.Close()
+
+	panicNotNil(db.NewTable("reverse_keys_testing"))
+	table := db.Table("reverse_keys_testing")
+	panicNotNil(table.NewIndex("City"))
+	panicNotNil(table.NewIndex("Age", IndexOptions{PerKey: true}))
+
+	people := []Person{
+		{Name: "a", City: "Sydney", Age: 18},
+		{Name: "b", City: "Melbourne", Age: 20},
+		{Name: "c", City: "Sydney", Age: 18},
+		{Name: "d", City: "Melbourne", Age: 20},
+		{Name: "e", City: "Sydney", Age: 18},
+	}
+	for _, person := range people {
+		panicNotNil(table.Set(person.Name, person))
+	}
+
+	tests := []struct {
+		index string
+		opts  IndexRangeOptions
+		keys  []string
+	}{
+		{"City", IndexRangeOptions{}, []string{"b", "d", "a", "c", "e"}},
+		{"City", IndexRangeOptions{ReverseKeys: true},
+			[]string{"d", "b", "e", "c", "a"}},
+		{"City", IndexRangeOptions{Reverse: true, ReverseKeys: true},
+			[]string{"e", "c", "a", "d", "b"}},
+		{"Age", IndexRangeOptions{ReverseKeys: true},
+			[]string{"e", "c", "a", "d", "b"}},
+		{"Age", IndexRangeOptions{Reverse: true},
+			[]string{"d", "b", "e", "c", "a"}},
+		{"Age", IndexRangeOptions{Reverse: true, ReverseKeys: true},
+			[]string{"b", "d", "a", "c", "e"}},
+	}
+
+	for _, test := range tests {
+		r := table.Index(test.index).BetweenWithOptions(MinValue, MaxValue,
+			test.opts)
+
+		var keys []string
+		for r.Next() {
+			keys = append(keys, r.Key())
+		}
+		r.Close()
+
+		if r.Error() != ErrEndOfRange {
+			t.Fatal("error should be ErrEndOfRange, but is", r.Error())
+		}
+
+		if strings.Join(keys, ",") != strings.Join(test.keys, ",") {
+			t.Fatal(test.index, test.opts, "keys should be", test.keys,
+				"but are", keys)
+		}
+	}
+}
+
+func TestIndexPage(t *testing.T) {
+	if testing.Short() {
+		t.Parallel()
+	}
+
+	dir, err := ioutil.TempDir("", "jvzc_")
+	panicNotNil(err)
+
+	t.Log("testing directory:", dir)
+	defer func() {
+		if !t.Failed() {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	db, err := Open(dir + "/data")
+	panicNotNil(err)
+
+	defer db.Close()
+
+	panicNotNil(db.NewTable("page_testing"))
+	table := db.Table("page_testing")
+	panicNotNil(table.NewIndex("City"))
+	panicNotNil(table.NewIndex("Name", IndexOptions{PerKey: true}))
+
+	// Documents are written out of order, as index lists are kept in the
+	// order documents were added.
+	for _, i := range []int{7, 3, 12, 0, 9, 1, 14, 5, 11, 2, 8, 13, 4, 10, 6} {
+		panicNotNil(table.Set(fmt.Sprintf("p%02d", i),
+			Person{Name: "Jason", City: "Sydney", Age: i}))
+	}
+	panicNotNil(table.Set("other", Person{Name: "Ben", City: "Perth"}))
+
+	for _, index := range []string{"City", "Name"} {
+		value := "Sydney"
+		if index == "Name" {
+			value = "Jason"
+		}
+
+		var ages []int
+		afterKey := ""
+		for pages := 0; ; pages++ {
+			if pages > 3 {
+				t.Fatal("there should be 3 pages, but there are more")
+			}
+
+			docs, next, err := table.Index(index).Page(value, afterKey, 6)
+			panicNotNil(err)
+
+			for _, doc := range docs {
+				var person Person
+				panicNotNil(doc.Decode(&person))
+				ages = append(ages, person.Age)
+			}
+
+			if next == "" {
+				break
+			}
+
+			afterKey = next
+		}
+
+		if fmt.Sprint(ages) != "[0 1 2 3 4 5 6 7 8 9 10 11 12 13 14]" {
+			t.Fatal("pages of", index, "should be sorted by key, but are", ages)
+		}
+	}
+
+	docs, next, err := table.Index("City").Page("Sydney", "", 5)
+	panicNotNil(err)
+
+	if len(docs) != 5 || next != "p04" {
+		t.Fatal("page should end at p04, but ends at", next)
+	}
+
+	// The next page starts after the token even if its document is deleted.
+	panicNotNil(table.Delete("p04"))
+	panicNotNil(table.Delete("p05"))
+
+	docs, next, err = table.Index("City").Page("Sydney", next, 5)
+	panicNotNil(err)
+
+	var person Person
+	panicNotNil(docs[0].Decode(&person))
+
+	if len(docs) != 5 || person.Age != 6 || next != "p10" {
+		t.Fatal("page should start at p06 and end at p10, but doesn't")
+	}
+
+	docs, next, err = table.Index("City").Page("Melbourne", "", 5)
+	panicNotNil(err)
+
+	if len(docs) != 0 || next != "" {
+		t.Fatal("page should be empty, but isn't")
+	}
+
+	if _, _, err := table.Index("City").Page("Sydney", "", 0); err == nil {
+		t.Fatal("a limit of 0 should fail, but didn't")
+	}
+}
+
+func TestIndexContains(t *testing.T) {
+	if testing.Short() {
+		t.Parallel()
+	}
+
+	dir, err := ioutil.TempDir("", "jvzc_")
+	panicNotNil(err)
+
+	t.Log("testing directory:", dir)
+	defer func() {
+		if !t.Failed() {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	db, err := Open(dir + "/data")
+	panicNotNil(err)
+
+	defer db.Close()
+
+	panicNotNil(db.NewTable("contains_testing"))
+	table := db.Table("contains_testing")
+	panicNotNil(table.NewIndex("City"))
+	panicNotNil(table.NewIndex("Age", IndexOptions{Shards: 4}))
+	panicNotNil(table.NewIndex("Name", IndexOptions{PerKey: true}))
+
+	panicNotNil(table.Set("jason", Person{Name: "Jason", City: "Sydney",
+		Age: 18}))
+	panicNotNil(table.Set("ben", Person{Name: "Ben", City: "Sydney",
+		Age: 19}))
+
+	for _, c := range []struct {
+		index string
+		value interface{}
+		found bool
+	}{
+		{"City", "Sydney", true},
+		{"City", "Melbourne", false},
+		{"Age", 18, true},
+		{"Age", 20, false},
+		{"Name", "Jason", true},
+		{"Name", "Drew", false},
+	} {
+		found, err := table.Index(c.index).Contains(c.value)
+		panicNotNil(err)
+		if found != c.found {
+			t.Fatal(fmt.Sprint(c.index, " contains ", c.value,
+				" should be ", c.found, ", but isn't"))
+		}
+	}
+
+	panicNotNil(table.Delete("jason"))
+
+	found, err := table.Index("Age").Contains(18)
+	panicNotNil(err)
+	if found {
+		t.Fatal("Age should not contain 18, but does")
+	}
+
+	found, err = table.Index("Name").Contains("Jason")
+	panicNotNil(err)
+	if found {
+		t.Fatal("Name should not contain Jason, but does")
+	}
+
+	found, err = table.Index("City").Contains("Sydney")
+	panicNotNil(err)
+	if !found {
+		t.Fatal("City should contain Sydney, but doesn't")
+	}
+
+	panicNotNil(table.Delete("ben"))
+
+	found, err = table.Index("City").Contains("Sydney")
+	panicNotNil(err)
+	if found {
+		t.Fatal("City should not contain Sydney, but does")
+	}
+}
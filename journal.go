@@ -0,0 +1,150 @@
+package jvzc
+
+import (
+	"encoding/binary"
+	"errors"
+	"log"
+	"sync/atomic"
+
+	"github.com/1lann/badger"
+	"github.com/1lann/msgpack"
+)
+
+// journalEntry records the index updates of a document write which is in
+// progress, so that they can be applied when the database is next opened if
+// the process stops after the document is written but before its indexes are
+// updated. For tables with a change log, it also records the kind of change,
+// so that a change which was written but not logged is logged. Only index
+// keys are recorded, which are already stored in plaintext, so that the
+// journal can be replayed before an encryption key is set. The key the
+// document is stored under is recorded as well, as the journal is replayed
+// before the collation of the table can be set.
+type journalEntry struct {
+	Table     string
+	Key       string
+	DataKey   []byte
+	Counter   uint64
+	Op        ChangeOp
+	Additions []diffEntry
+	Removals  []diffEntry
+}
+
+// journalTableSize is the maximum table size of the journal's store. Journal
+// entries are small and short lived, so a much smaller memory table than
+// that of the other stores is used.
+const journalTableSize = 1 << 20
+
+// openJournal opens the journal of the database, and replays any index
+// updates left in it.
+func (d *DB) openJournal() error {
+	opts := d.openOptions
+	opts.MaxTableSize = journalTableSize
+
+	var err error
+	d.journal, err = d.openKV(d.path+"/journal", opts)
+	if err != nil {
+		return errors.New("jvzc: failed to open journal: " + err.Error())
+	}
+
+	if err = d.replayJournal(); err != nil {
+		d.journal.Close()
+		return errors.New("jvzc: failed to replay journal: " + err.Error())
+	}
+
+	return nil
+}
+
+// journalWrite records the index updates of a document which is about to be
+// written, whose counter is currently the given counter, along with the kind
+// of change if the table has a change log. The returned function logs the
+// change if the document was written, and then removes the record. It must
+// be called after the index updates have been applied, while the document
+// is still locked, so that the counter logged is the one of the write.
+func (t *Table) journalWrite(key string, counter uint64, op ChangeOp,
+	additions, removals []diffEntry) (func(), error) {
+	if !t.changeLog {
+		op = 0
+	}
+
+	if len(additions) == 0 && len(removals) == 0 && op == 0 {
+		return func() {}, nil
+	}
+
+	data, err := msgpack.Marshal(journalEntry{
+		Table:     t.name(),
+		Key:       key,
+		DataKey:   t.dataKey(key),
+		Counter:   counter,
+		Op:        op,
+		Additions: additions,
+		Removals:  removals,
+	})
+	if err != nil {
+		log.Fatal("jvzc: marshal should never fail: ", err)
+	}
+
+	id := make([]byte, 8)
+	binary.BigEndian.PutUint64(id, atomic.AddUint64(&t.db.journalID, 1))
+
+	if err := t.db.journal.Set(id, data, 0); err != nil {
+		return nil, err
+	}
+
+	return func() {
+		if op != 0 {
+			t.logWrittenChange(op, key, counter)
+		}
+
+		t.db.journal.Delete(id)
+	}, nil
+}
+
+// replayJournal applies the index updates of documents which were written
+// without their indexes being updated. Entries whose document still has the
+// recorded counter were never written, and are discarded.
+func (d *DB) replayJournal() error {
+	it := d.journal.NewIterator(badger.DefaultIteratorOptions)
+
+	var ids [][]byte
+	for it.Rewind(); it.Valid(); it.Next() {
+		ids = append(ids, append([]byte(nil), it.Item().Key()...))
+
+		var entry journalEntry
+		err := msgpack.Unmarshal(getItemValue(it.Item()), &entry)
+		if err != nil {
+			it.Close()
+			return err
+		}
+
+		table := d.tables[Name(entry.Table)]
+		if table == nil {
+			continue
+		}
+
+		var item badger.KVItem
+		if err = table.data.Get(entry.DataKey, &item); err != nil {
+			it.Close()
+			return err
+		}
+
+		if item.Counter() == entry.Counter {
+			continue
+		}
+
+		table.applyIndexDiffs(entry.Key, entry.Additions, entry.Removals, true)
+
+		if entry.Op != 0 && table.changes != nil {
+			table.logChange(entry.Op, entry.Key, item.Counter())
+		}
+	}
+
+	it.Close()
+
+	for _, id := range ids {
+		if err := d.journal.Delete(id); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
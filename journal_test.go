@@ -0,0 +1,263 @@
+package jvzc
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestJournalReplay(t *testing.T) {
+	if testing.Short() {
+		t.Parallel()
+	}
+
+	dir, err := ioutil.TempDir("", "jvzc_")
+	panicNotNil(err)
+
+	t.Log("testing directory:", dir)
+	defer func() {
+		if !t.Failed() {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	db, err := Open(dir + "/data")
+	panicNotNil(err)
+
+	panicNotNil(db.NewTable("journal_testing"))
+	table := db.Table("journal_testing")
+	panicNotNil(table.NewIndex("City"))
+
+	jason := Person{Name: "Jason", City: "Sydney", Age: 18}
+	panicNotNil(table.Set("jason", jason))
+
+	// Simulate the process stopping after the document is written, but
+	// before its indexes are updated.
+	old, err := table.marshal(jason)
+	panicNotNil(err)
+
+	jason.City = "Melbourne"
+	data, err := table.marshal(jason)
+	panicNotNil(err)
+
+	counter, err := table.Get("jason", nil)
+	panicNotNil(err)
+
+	additions, removals, err := table.diffIndexes("jason", old, data)
+	panicNotNil(err)
+	_, err = table.journalWrite("jason", counter, 0, additions, removals)
+	panicNotNil(err)
+
+	stored, err := table.encodeValue(data, Meta{})
+	panicNotNil(err)
+	panicNotNil(table.data.Set([]byte("jason"), stored, 0))
+
+	// Simulate the process stopping before a document is written.
+	drew := Person{Name: "Drew", City: "London", Age: 18}
+	data, err = table.marshal(drew)
+	panicNotNil(err)
+
+	additions, removals, err = table.diffIndexes("drew", nil, data)
+	panicNotNil(err)
+	_, err = table.journalWrite("drew", 0, 0, additions, removals)
+	panicNotNil(err)
+
+	db.Close()
+
+	db, err = Open(dir + "/data")
+	panicNotNil(err)
+
+	defer db.Close()
+
+	table = db.Table("journal_testing")
+
+	r := table.Index("City").GetAll("Melbourne")
+	expectPerson("jason", r, jason)
+	r.Close()
+
+	n, err := table.Index("City").GetAll("Sydney").Count()
+	panicNotNil(err)
+
+	if n != 0 {
+		t.Fatal("count should be 0, but is", n)
+	}
+
+	n, err = table.Index("City").GetAll("London").Count()
+	panicNotNil(err)
+
+	if n != 0 {
+		t.Fatal("count should be 0, but is", n)
+	}
+
+	if countKeys(db.journal) != 0 {
+		t.Fatal("journal should be empty, but isn't")
+	}
+}
+
+func TestJournalReplayChangeLog(t *testing.T) {
+	if testing.Short() {
+		t.Parallel()
+	}
+
+	dir, err := ioutil.TempDir("", "jvzc_")
+	panicNotNil(err)
+
+	t.Log("testing directory:", dir)
+	defer func() {
+		if !t.Failed() {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	db, err := Open(dir + "/data")
+	panicNotNil(err)
+
+	panicNotNil(db.NewTable("journal_testing"))
+	table := db.Table("journal_testing")
+	panicNotNil(table.SetChangeLog(true))
+
+	panicNotNil(table.Set("jason", Person{Name: "Jason", City: "Sydney"}))
+
+	// Simulate the process stopping after the document is written, but
+	// before its change is logged.
+	counter, err := table.Get("jason", nil)
+	panicNotNil(err)
+
+	_, err = table.journalWrite("jason", counter, ChangeSet, nil, nil)
+	panicNotNil(err)
+
+	data, err := table.marshal(Person{Name: "Jason", City: "Melbourne"})
+	panicNotNil(err)
+	stored, err := table.encodeValue(data, Meta{})
+	panicNotNil(err)
+	panicNotNil(table.data.Set([]byte("jason"), stored, 0))
+
+	// Simulate the process stopping before a document is deleted.
+	counter, err = table.Get("jason", nil)
+	panicNotNil(err)
+
+	_, err = table.journalWrite("jason", counter, ChangeDelete, nil, nil)
+	panicNotNil(err)
+
+	db.Close()
+
+	db, err = Open(dir + "/data")
+	panicNotNil(err)
+
+	defer db.Close()
+
+	table = db.Table("journal_testing")
+
+	counter, err = table.Get("jason", nil)
+	panicNotNil(err)
+
+	r := table.Changes(1)
+	defer r.Close()
+
+	var changes []Change
+	for r.Next() {
+		var change Change
+		panicNotNil(r.Decode(&change))
+		changes = append(changes, change)
+	}
+
+	if len(changes) != 1 {
+		t.Fatal("1 change should be replayed, but", len(changes), "were")
+	}
+
+	if changes[0].Seq != 2 || changes[0].Op != ChangeSet ||
+		changes[0].Key != "jason" || changes[0].Counter != counter {
+		t.Fatal("change should be the write, but is", changes[0])
+	}
+
+	if countKeys(db.journal) != 0 {
+		t.Fatal("journal should be empty, but isn't")
+	}
+}
+
+func TestJournalReplayCollation(t *testing.T) {
+	if testing.Short() {
+		t.Parallel()
+	}
+
+	dir, err := ioutil.TempDir("", "jvzc_")
+	panicNotNil(err)
+
+	t.Log("testing directory:", dir)
+	defer func() {
+		if !t.Failed() {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	db, err := Open(dir + "/data")
+	panicNotNil(err)
+
+	panicNotNil(db.NewTable("journal_testing"))
+	table := db.Table("journal_testing")
+	table.SetCollation(CaseInsensitive)
+	panicNotNil(table.NewIndex("City"))
+
+	jason := Person{Name: "Jason", City: "Sydney", Age: 18}
+	panicNotNil(table.Set("Jason", jason))
+	drew := Person{Name: "Drew", City: "London", Age: 18}
+	panicNotNil(table.Set("Drew", drew))
+
+	// journal records the write of the person as if the process stopped
+	// before its indexes were updated.
+	journal := func(key string, person Person) []byte {
+		var old Person
+		counter, err := table.Get(key, &old)
+		panicNotNil(err)
+
+		oldData, err := table.marshal(old)
+		panicNotNil(err)
+		data, err := table.marshal(person)
+		panicNotNil(err)
+
+		additions, removals, err := table.diffIndexes(key, oldData, data)
+		panicNotNil(err)
+		_, err = table.journalWrite(key, counter, 0, additions, removals)
+		panicNotNil(err)
+
+		return data
+	}
+
+	// Simulate the process stopping before Jason is written.
+	journal("Jason", Person{Name: "Jason", City: "Melbourne", Age: 18})
+
+	// Simulate the process stopping after Drew is written, but before its
+	// indexes are updated.
+	drew.City = "Paris"
+	data := journal("Drew", drew)
+	stored, err := table.encodeValue(data, Meta{})
+	panicNotNil(err)
+	panicNotNil(table.data.Set(table.dataKey("Drew"), stored, 0))
+
+	db.Close()
+
+	db, err = Open(dir + "/data")
+	panicNotNil(err)
+
+	defer db.Close()
+
+	table = db.Table("journal_testing")
+	table.SetCollation(CaseInsensitive)
+
+	r := table.Index("City").GetAll("Sydney")
+	expectPerson("Jason", r, jason)
+	r.Close()
+
+	r = table.Index("City").GetAll("Paris")
+	expectPerson("Drew", r, drew)
+	r.Close()
+
+	for _, city := range []string{"Melbourne", "London"} {
+		n, err := table.Index("City").GetAll(city).Count()
+		panicNotNil(err)
+
+		if n != 0 {
+			t.Fatal("count of", city, "should be 0, but is", n)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package jvzc
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+)
+
+// streamFlushInterval is the number of lines written by StreamJSON between
+// each call to flush.
+const streamFlushInterval = 100
+
+// jsonLine is a line written by StreamJSON.
+type jsonLine struct {
+	Key   string      `json:"key"`
+	Value interface{} `json:"value"`
+}
+
+// StreamJSON writes every document of the table to w as newline delimited
+// JSON, in ascending order by key, with each line being an object with the
+// key of the document as "key" and the document as "value". Documents are
+// decoded like with Get into an interface{}, and documents stored with an
+// empty value are written with a null value.
+//
+// flush is called after every 100 lines and once all of the lines have been
+// written, so that the lines can be sent to a client as they are written,
+// such as with the Flush method of an http.Flusher. It may be nil.
+//
+// You can optionally specify a context, in which case streaming stops and
+// the error of the context is returned once it is cancelled. The lines
+// written before an error remain written.
+func (t *Table) StreamJSON(w io.Writer, flush func(),
+	ctx ...context.Context) error {
+	c := context.Background()
+	if len(ctx) > 0 && ctx[0] != nil {
+		c = ctx[0]
+	}
+
+	r := t.All()
+	defer r.Close()
+
+	enc := json.NewEncoder(w)
+
+	lines := 0
+	for r.Next() {
+		if err := c.Err(); err != nil {
+			return err
+		}
+
+		var value interface{}
+		if err := r.Decode(&value); err != nil && err != ErrEmptyValue {
+			return err
+		}
+
+		if err := enc.Encode(jsonLine{Key: r.Key(), Value: value}); err != nil {
+			return err
+		}
+
+		lines++
+		if flush != nil && lines%streamFlushInterval == 0 {
+			flush()
+		}
+	}
+
+	if r.Error() != ErrEndOfRange {
+		return r.Error()
+	}
+
+	if flush != nil {
+		flush()
+	}
+
+	return nil
+}
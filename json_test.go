@@ -0,0 +1,94 @@
+package jvzc
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"testing"
+)
+
+func TestStreamJSON(t *testing.T) {
+	if testing.Short() {
+		t.Parallel()
+	}
+
+	dir, err := ioutil.TempDir("", "jvzc_")
+	panicNotNil(err)
+
+	t.Log("testing directory:", dir)
+	defer func() {
+		if !t.Failed() {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	db, err := Open(dir + "/data")
+	panicNotNil(err)
+
+	defer db.Close()
+
+	panicNotNil(db.NewTable("json_testing"))
+	table := db.Table("json_testing")
+
+	for i := 0; i < 250; i++ {
+		panicNotNil(table.Set("person"+strconv.Itoa(1000+i), Person{
+			Name: "Person " + strconv.Itoa(i),
+			City: "Sydney",
+			Age:  i,
+		}))
+	}
+
+	buf := new(bytes.Buffer)
+	flushes := 0
+	panicNotNil(table.StreamJSON(buf, func() {
+		flushes++
+	}))
+
+	if flushes != 3 {
+		t.Fatal("flush should be called 3 times, but was called", flushes,
+			"times")
+	}
+
+	scanner := bufio.NewScanner(buf)
+	lines := 0
+	for scanner.Scan() {
+		var line struct {
+			Key   string
+			Value map[string]interface{}
+		}
+		panicNotNil(json.Unmarshal(scanner.Bytes(), &line))
+
+		if line.Key != "person"+strconv.Itoa(1000+lines) {
+			t.Fatal("key should be in order, but isn't")
+		}
+
+		if line.Value["Age"] != float64(lines) ||
+			line.Value["City"] != "Sydney" {
+			t.Fatal("document should be the one written, but isn't")
+		}
+
+		lines++
+	}
+
+	if lines != 250 {
+		t.Fatal("250 lines should be written, but", lines, "were")
+	}
+
+	// Cancelling the context stops streaming.
+	ctx, cancel := context.WithCancel(context.Background())
+	buf.Reset()
+	err = table.StreamJSON(buf, func() {
+		cancel()
+	}, ctx)
+	if err != context.Canceled {
+		t.Fatal("error should be context.Canceled, but is", err)
+	}
+
+	if bytes.Count(buf.Bytes(), []byte("\n")) != 100 {
+		t.Fatal("100 lines should be written, but weren't")
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"os"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/1lann/badger"
@@ -19,12 +20,23 @@ import (
 
 // Common errors that can be returned
 var (
-	ErrAlreadyExists  = errors.New("jvzc: already exists")
-	ErrNotFound       = errors.New("jvzc: not found")
-	ErrBadIdentifier  = errors.New("jvzc: bad identifier")
-	ErrEndOfRange     = errors.New("jvzc: end of range")
-	ErrCounterChanged = errors.New("jvzc: counter changed")
-	ErrIndexError     = errors.New("jvzc: index error")
+	ErrAlreadyExists   = errors.New("jvzc: already exists")
+	ErrNotFound        = errors.New("jvzc: not found")
+	ErrBadIdentifier   = errors.New("jvzc: bad identifier")
+	ErrEndOfRange      = errors.New("jvzc: end of range")
+	ErrCounterChanged  = errors.New("jvzc: counter changed")
+	ErrIndexError      = errors.New("jvzc: index error")
+	ErrNoEncryptionKey = errors.New("jvzc: no encryption key")
+	ErrInUse           = errors.New("jvzc: in use by open ranges")
+	ErrFieldNotFound   = errors.New("jvzc: field not found")
+	ErrNoChange        = errors.New("jvzc: no change")
+	ErrValueTooLarge   = errors.New("jvzc: value too large")
+	ErrNoGCWork        = errors.New("jvzc: no garbage collection work")
+	ErrNilValue        = errors.New("jvzc: value is nil")
+	ErrNotUnique       = errors.New("jvzc: unique index value already exists")
+	ErrEmptyValue      = errors.New("jvzc: stored value is empty")
+	ErrTableChanged    = errors.New("jvzc: table changed since drop plan")
+	ErrClosed          = errors.New("jvzc: database is closed")
 )
 
 // Name represents a table or index identifier.
@@ -37,30 +49,115 @@ func (n Name) Hex() string {
 
 // Index represents an index of a table.
 type Index struct {
-	index *badger.KV
-	table *Table
+	index     *badger.KV
+	table     *Table
+	indexName Name
+	query     string
+	dropped   bool
+	shards    int
+	perKey    bool
+
+	selfHeal bool
+	unique   bool
+	project  []string
+
+	partial bool
+	// predicateMutex guards predicate, which can be set by SetPredicate
+	// while documents are written.
+	predicateMutex *sync.RWMutex
+	predicate      func(doc Document) bool
 }
 
 // Table represents a table in the database.
 type Table struct {
-	indexes map[Name]*Index
-	data    *badger.KV
-	db      *DB
+	tableName Name
+	indexes   map[Name]*Index
+	data      *badger.KV
+	db        *DB
+	dir       string
 
 	compressionLock *sync.RWMutex
 	keyToCompressed map[string]string
 	compressedToKey map[string]string
 	nextKey         string
+
+	compression   Compression
+	metadata      bool
+	arrayEncoding bool
+	maxValueSize  int64
+	keyFunc       func(value interface{}) (string, error)
+	collation     Collation
+
+	changes   *badger.KV
+	changeLog bool
+	// changeMutex serializes the changes written to the change log, so that
+	// they are stored in the order of their sequence numbers.
+	changeMutex *sync.Mutex
+	changeSeq   uint64
+
+	migrators          []Migrator
+	migrationWriteBack bool
+
+	bulkLoads int32
+
+	// keyLocks serialize writes to the same document, see lockKey.
+	keyLocks *[keyLockCount]sync.Mutex
+	// uniqueMutex serializes writes to tables with unique indexes, so that
+	// two documents can't be given the same unique index value at once.
+	uniqueMutex *sync.Mutex
+
+	rangeMutex *sync.Mutex
+	openRanges int
+	dropped    bool
+
+	indexErrorsMutex *sync.Mutex
+	indexErrors      map[string]uint64
+	repairHandler    func(index string, indexKey []byte, key string)
+
+	listenerMutex *sync.RWMutex
+	listeners     map[int]func(key string)
+	nextListener  int
+
+	merges *merger
+
+	ops OpCounts
 }
 
 // DB represents the database.
 type DB struct {
+	// OnWarning is called with non-fatal problems encountered by the
+	// database, such as corrupt indexes. If it is nil, warnings are logged
+	// with the standard logger. It may be called concurrently, and should be
+	// set before the database is used.
+	OnWarning func(Warning)
+
+	// OnProgress is called periodically with the progress of long running
+	// operations, such as building a new index, and once more when the
+	// operation completes. It should be set before the database is used.
+	OnProgress func(Progress)
+
+	// Debug enables additional diagnostics which have a performance cost,
+	// such as reporting ranges which are garbage collected without being
+	// closed as LeakedRange warnings. It should be set before the database
+	// is used.
+	Debug bool
+
 	path        string
+	configPath  string
 	tables      map[Name]*Table
 	config      dbConfig
 	configMutex *sync.Mutex
 	openOptions badger.Options
 	closed      int32
+	operations  int32
+	// idle is signalled once the database is closed and the last operation
+	// in progress is released.
+	idle *sync.Cond
+	// cipher holds the cipher.AEAD set by SetEncryptionKey.
+	cipher    atomic.Value
+	journal   *badger.KV
+	journalID uint64
+	tempDir   string
 }
 
 func exists(path string) (bool, error) {
@@ -236,9 +333,50 @@ func (v Document) QueryAll(query string) []interface{} {
 
 // Decode attempts to decodes the document to an interface using reflection.
 func (v Document) Decode(dst interface{}) error {
-	if v.table != nil && v.table.keyToCompressed != nil {
-		return msgpack.UnmarshalCompressed(v.table.cToKey, v.data, dst)
+	return unmarshal(v.table, v.data, dst)
+}
+
+// unmarshal decodes a document of the table into dst, which may be a pointer
+// to a struct, a map[string]interface{} or an interface{}. Maps with string
+// keys are decoded as map[string]interface{} rather than
+// map[interface{}]interface{}, so that documents can be used without knowing
+// their type. The table may be nil.
+func unmarshal(table *Table, data []byte, dst interface{}) error {
+	if len(data) == 0 {
+		return ErrEmptyValue
+	}
+
+	var dec *msgpack.Decoder
+	if table != nil && table.keyToCompressed != nil {
+		dec = msgpack.NewCompressedDecoder(table.cToKey, bytes.NewReader(data))
+	} else {
+		dec = msgpack.NewDecoder(bytes.NewReader(data))
+	}
+
+	decodeMap := dec.DecodeMapFunc
+	dec.DecodeMapFunc = func(d *msgpack.Decoder) (interface{}, error) {
+		v, err := decodeMap(d)
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := v.(map[interface{}]interface{})
+		if !ok {
+			return v, nil
+		}
+
+		result := make(map[string]interface{}, len(m))
+		for key, value := range m {
+			str, ok := key.(string)
+			if !ok {
+				return m, nil
+			}
+
+			result[str] = value
+		}
+
+		return result, nil
 	}
 
-	return msgpack.Unmarshal(v.data, dst)
+	return dec.Decode(dst)
 }
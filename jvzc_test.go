@@ -4,7 +4,13 @@ import (
 	"io/ioutil"
 	"log"
 	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"github.com/1lann/badger"
 )
 
 func init() {
@@ -83,3 +89,405 @@ func TestBasic(t *testing.T) {
 	db, err = Open(dir + "/data")
 	panicNotNil(err)
 }
+
+func TestSync(t *testing.T) {
+	if testing.Short() {
+		t.Parallel()
+	}
+
+	dir, err := ioutil.TempDir("", "jvzc_")
+	panicNotNil(err)
+
+	t.Log("testing directory:", dir)
+	defer func() {
+		if !t.Failed() {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	db, err := Open(dir + "/data")
+	panicNotNil(err)
+
+	defer db.Close()
+
+	panicNotNil(db.Sync())
+
+	panicNotNil(db.NewTable("sync_testing"))
+	panicNotNil(db.Table("sync_testing").NewIndex("Name"))
+	panicNotNil(db.Table("sync_testing").Set("jason", Person{Name: "Jason"}))
+
+	panicNotNil(db.Sync())
+}
+
+func TestPing(t *testing.T) {
+	if testing.Short() {
+		t.Parallel()
+	}
+
+	dir, err := ioutil.TempDir("", "jvzc_")
+	panicNotNil(err)
+
+	t.Log("testing directory:", dir)
+	defer func() {
+		if !t.Failed() {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	db, err := Open(dir + "/data")
+	panicNotNil(err)
+
+	panicNotNil(db.Ping())
+
+	db.Close()
+
+	if db.Ping() != ErrClosed {
+		t.Fatal("error should be ErrClosed, but isn't")
+	}
+}
+
+func TestClosed(t *testing.T) {
+	if testing.Short() {
+		t.Parallel()
+	}
+
+	dir, err := ioutil.TempDir("", "jvzc_")
+	panicNotNil(err)
+
+	t.Log("testing directory:", dir)
+	defer func() {
+		if !t.Failed() {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	db, err := Open(dir + "/data")
+	panicNotNil(err)
+
+	panicNotNil(db.NewTable("closed_testing"))
+	table := db.Table("closed_testing")
+	panicNotNil(table.NewIndex("City"))
+	index := table.Index("City")
+
+	jason := Person{Name: "Jason", City: "Sydney", Age: 18}
+	panicNotNil(table.Set("jason", jason))
+
+	for n := 0; n < 3*bufferSize; n++ {
+		panicNotNil(table.Set("person"+strconv.Itoa(n), jason))
+	}
+
+	// Ranges which are open when the database is closed stop reading from
+	// it.
+	r := table.All()
+	defer r.Close()
+
+	if !r.Next() {
+		t.Fatal("range should have a document, but doesn't:", r.Error())
+	}
+
+	db.Close()
+
+	for r.Next() {
+	}
+
+	if r.Error() != ErrClosed {
+		t.Fatal("range error should be ErrClosed, but is:", r.Error())
+	}
+
+	operations := map[string]func() error{
+		"Get": func() error {
+			_, err := table.Get("jason", &Person{})
+			return err
+		},
+		"Set":    func() error { return table.Set("jason", jason) },
+		"Insert": func() error { return table.Insert("ben", jason) },
+		"SetIfChanged": func() error {
+			_, err := table.SetIfChanged("jason", jason)
+			return err
+		},
+		"Delete": func() error { return table.Delete("jason") },
+		"Update": func() error {
+			return table.Update("jason", func(p Person) (Person, error) {
+				return p, nil
+			})
+		},
+		"Merge": func() error {
+			return table.Merge("jason", nil,
+				func(existing, operand []byte) []byte {
+					return existing
+				})
+		},
+		"Meta": func() error {
+			_, err := table.Meta("jason")
+			return err
+		},
+		"All": func() error {
+			r := table.All()
+			defer r.Close()
+			r.Next()
+			return r.Error()
+		},
+		"Between": func() error {
+			r := table.Between(MinValue, MaxValue)
+			defer r.Close()
+			r.Next()
+			return r.Error()
+		},
+		"DeleteRange": func() error {
+			_, err := table.DeleteRange(MinValue, MaxValue)
+			return err
+		},
+		"IndexEntriesForKey": func() error {
+			_, err := table.IndexEntriesForKey("jason")
+			return err
+		},
+		"Index.GetAll": func() error {
+			r := index.GetAll("Sydney")
+			defer r.Close()
+			r.Next()
+			return r.Error()
+		},
+		"Index.Between": func() error {
+			r := index.Between(MinValue, MaxValue)
+			defer r.Close()
+			r.Next()
+			return r.Error()
+		},
+		"Index.Drop":   index.Drop,
+		"NewIndex":     func() error { return table.NewIndex("Age") },
+		"NewTable":     func() error { return db.NewTable("other") },
+		"Drop":         func() error { return table.Drop() },
+		"SetMetadata":  func() error { return table.SetMetadata(true) },
+		"SetChangeLog": func() error { return table.SetChangeLog(true) },
+		"Sync":         db.Sync,
+		"RunGC": func() error {
+			_, err := db.RunGC(0.5)
+			return err
+		},
+		"Ping": db.Ping,
+	}
+
+	for name, operation := range operations {
+		if err := operation(); err != ErrClosed {
+			t.Fatal(name+" should return ErrClosed, but returned:", err)
+		}
+	}
+}
+
+func TestCloseInFlight(t *testing.T) {
+	if testing.Short() {
+		t.Parallel()
+	}
+
+	dir, err := ioutil.TempDir("", "jvzc_")
+	panicNotNil(err)
+
+	t.Log("testing directory:", dir)
+	defer func() {
+		if !t.Failed() {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	db, err := Open(dir + "/data")
+	panicNotNil(err)
+
+	panicNotNil(db.NewTable("closed_testing"))
+	table := db.Table("closed_testing")
+	panicNotNil(table.NewIndex("City"))
+
+	errs := make(chan error, 10)
+	for n := 0; n < cap(errs); n++ {
+		go func(n int) {
+			key := "person" + strconv.Itoa(n)
+			for {
+				err := table.Set(key, Person{Name: key, City: "Sydney"})
+				if err == nil {
+					_, err = table.Get(key, &Person{})
+				}
+
+				if err != nil {
+					errs <- err
+					return
+				}
+			}
+		}(n)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	db.Close()
+
+	for n := 0; n < cap(errs); n++ {
+		if err := <-errs; err != ErrClosed {
+			t.Fatal("error should be ErrClosed, but is:", err)
+		}
+	}
+}
+
+func TestCloseDuringScan(t *testing.T) {
+	if testing.Short() {
+		t.Parallel()
+	}
+
+	dir, err := ioutil.TempDir("", "jvzc_")
+	panicNotNil(err)
+
+	t.Log("testing directory:", dir)
+	defer func() {
+		if !t.Failed() {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	db, err := Open(dir + "/data")
+	panicNotNil(err)
+
+	panicNotNil(db.NewTable("closed_testing"))
+	table := db.Table("closed_testing")
+	panicNotNil(table.NewIndex("City"))
+	index := table.Index("City")
+
+	for n := 0; n < 3*bufferSize; n++ {
+		key := "person" + strconv.Itoa(n)
+		panicNotNil(table.Set(key, Person{Name: key,
+			City: "City" + strconv.Itoa(n)}))
+	}
+
+	// Scans which are running when the database is closed are waited for.
+	scanning := make(chan struct{})
+	resume := make(chan struct{})
+	scanErr := make(chan error, 1)
+	go func() {
+		var once sync.Once
+		scanErr <- index.countValues(func(indexKey []byte, count int64) {
+			once.Do(func() {
+				close(scanning)
+				<-resume
+			})
+		})
+	}()
+
+	<-scanning
+
+	closed := make(chan struct{})
+	go func() {
+		db.Close()
+		close(closed)
+	}()
+
+	select {
+	case <-closed:
+		t.Fatal("database should wait for the scan before closing, but didn't")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	if atomic.LoadInt32(&db.operations) != 1 {
+		t.Fatal("scan should be waited for by Close, but isn't")
+	}
+
+	close(resume)
+	<-closed
+
+	if err := <-scanErr; err != nil {
+		t.Fatal("scan error should be nil, but is:", err)
+	}
+
+	// Scans started once the database is closed return ErrClosed.
+	scans := map[string]func() error{
+		"Verify": func() error {
+			_, err := index.Verify()
+			return err
+		},
+		"ApproxCardinality": func() error {
+			_, err := index.ApproxCardinality()
+			return err
+		},
+		"HotValues": func() error {
+			_, err := index.HotValues(1)
+			return err
+		},
+		"countDocuments": func() error {
+			_, err := table.countDocuments()
+			return err
+		},
+	}
+
+	for name, scan := range scans {
+		if err := scan(); err != ErrClosed {
+			t.Fatal(name+" error should be ErrClosed, but is:", err)
+		}
+	}
+}
+
+func TestRunGC(t *testing.T) {
+	if testing.Short() {
+		t.Parallel()
+	}
+
+	dir, err := ioutil.TempDir("", "jvzc_")
+	panicNotNil(err)
+
+	t.Log("testing directory:", dir)
+	defer func() {
+		if !t.Failed() {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	opts := badger.DefaultOptions
+	opts.MaxTableSize = 1 << 20
+	opts.ValueLogFileSize = 16 << 20
+
+	db, err := Open(dir+"/data", opts)
+	panicNotNil(err)
+
+	defer db.Close()
+
+	panicNotNil(db.NewTable("gc_testing"))
+	table := db.Table("gc_testing")
+
+	result, err := db.RunGC(0.5)
+	if err != ErrNoGCWork || result.DidWork() {
+		t.Fatal("error should be ErrNoGCWork, but is", err)
+	}
+
+	if result.Stores != 2 {
+		t.Fatal("2 stores should be collected, but", result.Stores, "were")
+	}
+
+	panicNotNil(table.SetChangeLog(true))
+
+	result, err = db.RunGC(0.5)
+	if err != ErrNoGCWork || result.DidWork() {
+		t.Fatal("error should be ErrNoGCWork, but is", err)
+	}
+
+	if result.Stores != 3 {
+		t.Fatal("3 stores should be collected, but", result.Stores, "were")
+	}
+
+	// Value logs are only rewritten if at least 10MB of them is sampled.
+	data := make([]byte, 100000)
+	for round := 0; round < 3; round++ {
+		for i := 0; i < 200; i++ {
+			panicNotNil(table.Set(strconv.Itoa(i), Person{Data: data}))
+		}
+	}
+
+	for i := 0; i < 10; i++ {
+		result, err = db.RunGC(0.5)
+		if err == ErrNoGCWork {
+			continue
+		}
+		panicNotNil(err)
+
+		if !result.DidWork() || result.Rewritten != 1 {
+			t.Fatal("1 store should be rewritten, but", result.Rewritten,
+				"were")
+		}
+
+		return
+	}
+
+	t.Fatal("garbage collection should rewrite a value log, but didn't")
+}
@@ -0,0 +1,26 @@
+package jvzc
+
+import "github.com/1lann/badger"
+
+// KV returns the underlying badger store of the table's documents, for
+// features which the package doesn't support yet.
+//
+// This is unsafe. Documents are stored in an internal encoding which may be
+// compressed or encrypted, and writes made directly to the store don't
+// update the indexes of the table, notify watchers or respect drops. The
+// store must not be closed, and must not be used after the table is dropped
+// or the database is closed.
+func (t *Table) KV() *badger.KV {
+	return t.data
+}
+
+// KV returns the underlying badger store of the index, for features which
+// the package doesn't support yet.
+//
+// This is unsafe. The layout of the keys and values of the index is internal
+// and depends on the options of the index, and writing to the store will make
+// the index inconsistent with its table. The store must not be closed, and
+// must not be used after the index is dropped or the database is closed.
+func (i *Index) KV() *badger.KV {
+	return i.index
+}
@@ -0,0 +1,171 @@
+package jvzc
+
+import (
+	"sync"
+
+	"github.com/1lann/badger"
+)
+
+// merger coalesces concurrent merges into the same document of a table.
+type merger struct {
+	mutex sync.Mutex
+	// pending holds the batch of operands waiting to be merged into each
+	// document, which further merges join until it is written.
+	pending map[string]*mergeBatch
+	// writing holds a channel for each document with a batch being written,
+	// which is closed when the write completes.
+	writing map[string]chan struct{}
+}
+
+type mergeBatch struct {
+	operands [][]byte
+	merges   []func(existing, operand []byte) []byte
+	done     chan struct{}
+	err      error
+}
+
+func newMerger() *merger {
+	return &merger{
+		pending: make(map[string]*mergeBatch),
+		writing: make(map[string]chan struct{}),
+	}
+}
+
+// Merge merges the operand into the document with the primary key using the
+// merge function, which is called with the marshalled document currently
+// stored (or nil if it doesn't exist) and the operand, and returns the
+// marshalled document to store. The merge function must not modify or retain
+// existing, and must not write to the document, as it is called while the
+// document is locked. This is intended for values such as counters and sets,
+// which are frequently changed by many writers.
+//
+// Concurrent merges into the same document are coalesced into a single write,
+// instead of each retrying with a counter like Update does. Merges are only
+// coalesced within the process, and are retried if the document is written
+// by other means at the same time.
+//
+// The merged document is stored as it is returned, so it must be marshalled
+// with msgpack (without key compression, so the table should have key
+// compression disabled if the document is a map) to be read with Get and
+// ranges. Merges bypass the indexes of the table, which will be stale for
+// merged documents until they are rebuilt.
+func (t *Table) Merge(key string, operand []byte,
+	merge func(existing, operand []byte) []byte) error {
+	if err := t.db.acquire(); err != nil {
+		return err
+	}
+	defer t.db.release()
+
+	if !validKey(key) || !t.validStoreKey(key) {
+		return ErrBadIdentifier
+	}
+
+	m := t.merges
+	m.mutex.Lock()
+
+	if batch, found := m.pending[key]; found {
+		batch.operands = append(batch.operands, operand)
+		batch.merges = append(batch.merges, merge)
+		m.mutex.Unlock()
+
+		<-batch.done
+		return batch.err
+	}
+
+	batch := &mergeBatch{
+		operands: [][]byte{operand},
+		merges:   []func(existing, operand []byte) []byte{merge},
+		done:     make(chan struct{}),
+	}
+	m.pending[key] = batch
+
+	// Merges which arrive while the previous batch is being written join
+	// this batch.
+	for {
+		writing, busy := m.writing[key]
+		if !busy {
+			break
+		}
+
+		m.mutex.Unlock()
+		<-writing
+		m.mutex.Lock()
+	}
+
+	delete(m.pending, key)
+	writing := make(chan struct{})
+	m.writing[key] = writing
+	m.mutex.Unlock()
+
+	batch.err = t.writeMerge(key, batch)
+
+	m.mutex.Lock()
+	delete(m.writing, key)
+	close(writing)
+	m.mutex.Unlock()
+
+	close(batch.done)
+	return batch.err
+}
+
+// writeMerge merges the operands of the batch into the document and writes
+// it, retrying if the document is changed concurrently.
+func (t *Table) writeMerge(key string, batch *mergeBatch) error {
+	for {
+		written, err := t.writeMergeOnce(key, batch)
+		if err != nil {
+			return err
+		}
+
+		if written {
+			t.changed(ChangeSet, key)
+			return nil
+		}
+	}
+}
+
+// writeMergeOnce merges the operands of the batch into the document and
+// writes it, and returns false if the document changed while it was being
+// merged. The document is locked so that conditional writes of it, which
+// check its counter while it is locked, aren't raced.
+func (t *Table) writeMergeOnce(key string, batch *mergeBatch) (bool, error) {
+	defer t.lockKey(key)()
+
+	var item badger.KVItem
+	if err := t.data.Get(t.dataKey(key), &item); err != nil {
+		return false, err
+	}
+
+	itemValue := getItemValue(&item)
+	data, err := t.decodeValue(itemValue)
+	if err != nil {
+		return false, err
+	}
+
+	for i, merge := range batch.merges {
+		data = merge(data, batch.operands[i])
+	}
+
+	stored, err := t.encodeValue(data, t.nextMeta(&item))
+	if err != nil {
+		return false, err
+	}
+
+	done, err := t.journalWrite(key, item.Counter(), ChangeSet, nil, nil)
+	if err != nil {
+		return false, err
+	}
+	defer done()
+
+	if itemValue == nil {
+		err = t.data.SetIfAbsent(t.dataKey(key), stored, 0)
+	} else {
+		err = t.data.CompareAndSet(t.dataKey(key), stored, item.Counter())
+	}
+
+	if err == badger.ErrKeyExists || err == badger.ErrCasMismatch {
+		return false, nil
+	}
+
+	return err == nil, err
+}
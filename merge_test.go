@@ -0,0 +1,124 @@
+package jvzc
+
+import (
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/1lann/msgpack"
+)
+
+func addMerge(existing, operand []byte) []byte {
+	var total, n int64
+	if existing != nil {
+		panicNotNil(msgpack.Unmarshal(existing, &total))
+	}
+	panicNotNil(msgpack.Unmarshal(operand, &n))
+
+	result, err := msgpack.Marshal(total + n)
+	panicNotNil(err)
+	return result
+}
+
+func TestMerge(t *testing.T) {
+	if testing.Short() {
+		t.Parallel()
+	}
+
+	dir, err := ioutil.TempDir("", "jvzc_")
+	panicNotNil(err)
+
+	t.Log("testing directory:", dir)
+	defer func() {
+		if !t.Failed() {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	db, err := Open(dir + "/data")
+	panicNotNil(err)
+
+	defer db.Close()
+
+	panicNotNil(db.NewTable("merge_testing", false))
+	table := db.Table("merge_testing")
+
+	one, err := msgpack.Marshal(int64(1))
+	panicNotNil(err)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				panicNotNil(table.Merge("counter", one, addMerge))
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	var total int64
+	_, err = table.Get("counter", &total)
+	panicNotNil(err)
+
+	if total != 1000 {
+		t.Fatal("total should be 1000, but is", total)
+	}
+
+	panicNotNil(table.Update("counter", func(total int64) (int64, error) {
+		return total * 2, nil
+	}))
+	panicNotNil(table.Merge("counter", one, addMerge))
+
+	_, err = table.Get("counter", &total)
+	panicNotNil(err)
+
+	if total != 2001 {
+		t.Fatal("total should be 2001, but is", total)
+	}
+}
+
+func BenchmarkCounter(b *testing.B) {
+	one, err := msgpack.Marshal(int64(1))
+	panicNotNil(err)
+
+	benchmarks := []struct {
+		name      string
+		increment func(table *Table) error
+	}{
+		{"Merge", func(table *Table) error {
+			return table.Merge("counter", one, addMerge)
+		}},
+		{"Update", func(table *Table) error {
+			return table.Update("counter", func(total int64) (int64, error) {
+				return total + 1, nil
+			})
+		}},
+	}
+
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			dir, err := ioutil.TempDir("", "jvzc_")
+			panicNotNil(err)
+			defer os.RemoveAll(dir)
+
+			db, err := Open(dir + "/data")
+			panicNotNil(err)
+			defer db.Close()
+
+			panicNotNil(db.NewTable("bench", false))
+			table := db.Table("bench")
+			panicNotNil(table.Set("counter", int64(0)))
+
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					panicNotNil(bm.increment(table))
+				}
+			})
+		})
+	}
+}
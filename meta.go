@@ -0,0 +1,121 @@
+package jvzc
+
+import (
+	"encoding/binary"
+	"time"
+
+	"github.com/1lann/badger"
+)
+
+// Meta represents the metadata of a document, which is stored alongside the
+// document if metadata is enabled for its table with SetMetadata.
+type Meta struct {
+	// CreatedAt is when the document was first written.
+	CreatedAt time.Time
+	// UpdatedAt is when the document was last written.
+	UpdatedAt time.Time
+}
+
+// metaSize is the size of encoded metadata, which is the creation and update
+// times as big endian Unix nanoseconds.
+const metaSize = 16
+
+func encodeMeta(meta Meta) []byte {
+	result := make([]byte, metaSize)
+	binary.BigEndian.PutUint64(result, uint64(meta.CreatedAt.UnixNano()))
+	binary.BigEndian.PutUint64(result[8:], uint64(meta.UpdatedAt.UnixNano()))
+	return result
+}
+
+func decodeMeta(data []byte) Meta {
+	return Meta{
+		CreatedAt: time.Unix(0, int64(binary.BigEndian.Uint64(data))),
+		UpdatedAt: time.Unix(0, int64(binary.BigEndian.Uint64(data[8:]))),
+	}
+}
+
+// SetMetadata sets whether the creation and update times of documents written
+// to the table from now on are stored alongside them, which can be read with
+// Meta. The metadata is stored separately from the document, so it is
+// transparent to Get, ranges and indexes. Existing documents are not
+// rewritten.
+func (t *Table) SetMetadata(enabled bool) error {
+	if err := t.db.lockConfig(); err != nil {
+		return err
+	}
+	defer t.db.configMutex.Unlock()
+
+	tableName := t.name()
+	for i, table := range t.db.config.Tables {
+		if table.TableName == tableName {
+			t.db.config.Tables[i].Metadata = enabled
+			if err := t.db.writeConfig(); err != nil {
+				t.db.config.Tables[i].Metadata = t.metadata
+				return err
+			}
+
+			t.metadata = enabled
+			return nil
+		}
+	}
+
+	return ErrNotFound
+}
+
+// Meta returns the metadata of the document with the primary key. ErrNotFound
+// is returned if the document does not exist, and the zero Meta is returned
+// if the document was written without metadata.
+func (t *Table) Meta(key string) (Meta, error) {
+	if err := t.db.acquire(); err != nil {
+		return Meta{}, err
+	}
+	defer t.db.release()
+
+	if !validKey(key) {
+		return Meta{}, ErrBadIdentifier
+	}
+
+	var item badger.KVItem
+	if err := t.data.Get(t.dataKey(key), &item); err != nil {
+		return Meta{}, err
+	}
+
+	itemValue := getItemValue(&item)
+	if itemValue == nil {
+		return Meta{}, ErrNotFound
+	}
+
+	_, meta, _, err := t.decodeValueVersion(itemValue)
+	return meta, err
+}
+
+// ModifiedAt returns when the document with the primary key was last
+// written, which is the UpdatedAt time of its metadata. The underlying stores
+// don't track when values are written, so metadata must be enabled for the
+// table with SetMetadata. ErrNotFound is returned if the document does not
+// exist, and the zero time is returned if the document was written without
+// metadata.
+func (t *Table) ModifiedAt(key string) (time.Time, error) {
+	meta, err := t.Meta(key)
+	return meta.UpdatedAt, err
+}
+
+// nextMeta returns the metadata of a document being written over the item,
+// keeping the creation time of the existing document if it has one.
+func (t *Table) nextMeta(item *badger.KVItem) Meta {
+	now := time.Now()
+	meta := Meta{CreatedAt: now, UpdatedAt: now}
+
+	if !t.metadata {
+		return meta
+	}
+
+	if itemValue := getItemValue(item); itemValue != nil {
+		_, old, _, err := t.decodeValueVersion(itemValue)
+		if err == nil && !old.CreatedAt.IsZero() {
+			meta.CreatedAt = old.CreatedAt
+		}
+	}
+
+	return meta
+}
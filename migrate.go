@@ -0,0 +1,139 @@
+package jvzc
+
+import (
+	"errors"
+
+	"github.com/1lann/badger"
+	"github.com/1lann/msgpack"
+)
+
+// MaxSchemaVersion is the highest schema version of a table, as the schema
+// version is stored in a single byte of each document.
+const MaxSchemaVersion = 255
+
+var errNoMigrator = errors.New("jvzc: no migrator for schema version")
+
+// Migrator upgrades a marshalled document from one schema version of a table
+// to the next. The document is marshalled as plain msgpack, even if the table
+// uses key compression.
+type Migrator func(raw []byte) ([]byte, error)
+
+// SetMigrator registers the migrator which upgrades documents of the table
+// from the schema version fromVersion to fromVersion+1. The schema version of
+// the table is one more than the highest fromVersion registered, and
+// documents written to the table are stored with it. Documents stored before
+// any migrators were registered have a schema version of 0.
+//
+// Documents with an older schema version are upgraded through the chain of
+// migrators whenever they are read, but aren't rewritten unless
+// SetMigrationWriteBack is enabled. Migrators must be registered every time
+// the database is opened, before the table is used, as they are not
+// persisted. Indexes are not updated by migrations, so migrators which change
+// indexed values require the affected indexes to be rebuilt.
+//
+// SetMigrator panics if fromVersion is negative or not less than
+// MaxSchemaVersion.
+func (t *Table) SetMigrator(fromVersion int,
+	fn func(raw []byte) ([]byte, error)) {
+	if fromVersion < 0 || fromVersion >= MaxSchemaVersion {
+		panic("jvzc: migrator schema version out of range")
+	}
+
+	for len(t.migrators) <= fromVersion {
+		t.migrators = append(t.migrators, nil)
+	}
+
+	t.migrators[fromVersion] = fn
+}
+
+// SetMigrationWriteBack sets whether documents upgraded by migrators when
+// they are read with Get are written back to the table, so that they are
+// only migrated once. Documents which are changed between being read and
+// written back are left as they are.
+func (t *Table) SetMigrationWriteBack(enabled bool) {
+	t.migrationWriteBack = enabled
+}
+
+// schemaVersion returns the schema version of documents written to the
+// table.
+func (t *Table) schemaVersion() int {
+	return len(t.migrators)
+}
+
+// migrate upgrades a marshalled document from the schema version to the
+// schema version of the table.
+func (t *Table) migrate(data []byte, version int) ([]byte, error) {
+	if version >= t.schemaVersion() || data == nil {
+		return data, nil
+	}
+
+	var err error
+	if t.keyToCompressed != nil {
+		data, err = t.toPlain(data)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for ; version < t.schemaVersion(); version++ {
+		if t.migrators[version] == nil {
+			return nil, errNoMigrator
+		}
+
+		data, err = t.migrators[version](data)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if t.keyToCompressed != nil {
+		var value interface{}
+		if err = unmarshal(nil, data, &value); err != nil {
+			return nil, err
+		}
+
+		return t.marshal(value)
+	}
+
+	return data, nil
+}
+
+// toPlain re-marshals a document marshalled with key compression as plain
+// msgpack.
+func (t *Table) toPlain(data []byte) ([]byte, error) {
+	var value interface{}
+	if err := unmarshal(t, data, &value); err != nil {
+		return nil, err
+	}
+
+	return msgpack.Marshal(value)
+}
+
+// writeBackMigrated writes a document which was upgraded when it was read
+// back to the table, unless the document was changed since it was read, and
+// returns the counter of the document.
+func (t *Table) writeBackMigrated(key string, data []byte, meta Meta,
+	counter uint64) (uint64, error) {
+	stored, err := t.encodeValue(data, meta)
+	if err != nil {
+		return 0, err
+	}
+
+	// The document is locked so that conditional writes of it, which check
+	// its counter while it is locked, aren't raced.
+	defer t.lockKey(key)()
+
+	err = t.data.CompareAndSet(t.dataKey(key), stored, counter)
+	if err == badger.ErrCasMismatch {
+		return counter, nil
+	} else if err != nil {
+		return 0, err
+	}
+
+	var item badger.KVItem
+	if err = t.data.Get(t.dataKey(key), &item); err != nil {
+		return 0, err
+	}
+
+	return item.Counter(), nil
+}
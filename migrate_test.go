@@ -0,0 +1,126 @@
+package jvzc
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/1lann/badger"
+	"github.com/1lann/msgpack"
+)
+
+func TestMigration(t *testing.T) {
+	if testing.Short() {
+		t.Parallel()
+	}
+
+	testMigration(t, false)
+}
+
+func TestMigrationCompressed(t *testing.T) {
+	if testing.Short() {
+		t.Parallel()
+	}
+
+	testMigration(t, true)
+}
+
+func ageMigrator(fn func(age int64) int64) func(raw []byte) ([]byte, error) {
+	return func(raw []byte) ([]byte, error) {
+		var doc map[string]interface{}
+		if err := msgpack.Unmarshal(raw, &doc); err != nil {
+			return nil, err
+		}
+
+		switch age := doc["Age"].(type) {
+		case int64:
+			doc["Age"] = fn(age)
+		case uint64:
+			doc["Age"] = fn(int64(age))
+		}
+
+		return msgpack.Marshal(doc)
+	}
+}
+
+func storedVersion(table *Table, key string) int {
+	var item badger.KVItem
+	panicNotNil(table.data.Get([]byte(key), &item))
+
+	_, _, version, err := table.decodeValueVersion(getItemValue(&item))
+	panicNotNil(err)
+
+	return version
+}
+
+func testMigration(t *testing.T, compression bool) {
+	dir, err := ioutil.TempDir("", "jvzc_")
+	panicNotNil(err)
+
+	t.Log("testing directory:", dir)
+	defer func() {
+		if !t.Failed() {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	db, err := Open(dir + "/data")
+	panicNotNil(err)
+
+	defer db.Close()
+
+	panicNotNil(db.NewTable("migrate_testing", compression))
+	table := db.Table("migrate_testing")
+
+	panicNotNil(table.Set("jason", Person{Name: "Jason", City: "Sydney", Age: 18}))
+
+	table.SetMigrator(0, ageMigrator(func(age int64) int64 { return age + 1 }))
+
+	var person Person
+	_, err = table.Get("jason", &person)
+	panicNotNil(err)
+
+	if person.Age != 19 {
+		t.Fatal("age should be 19, but isn't")
+	}
+
+	if storedVersion(table, "jason") != 0 {
+		t.Fatal("jason should not be written back, but was")
+	}
+
+	panicNotNil(table.Set("drew", Person{Name: "Drew", City: "London", Age: 18}))
+
+	if storedVersion(table, "drew") != 1 {
+		t.Fatal("drew should be stored with version 1, but isn't")
+	}
+
+	table.SetMigrator(1, ageMigrator(func(age int64) int64 { return age * 10 }))
+
+	r := table.All()
+	expectPerson("drew", r, Person{Name: "Drew", City: "London", Age: 180})
+	expectPerson("jason", r, Person{Name: "Jason", City: "Sydney", Age: 190})
+	r.Close()
+
+	table.SetMigrationWriteBack(true)
+
+	counter, err := table.Get("jason", &person)
+	panicNotNil(err)
+
+	if person.Age != 190 || person.Name != "Jason" {
+		t.Fatal("jason should be migrated, but isn't")
+	}
+
+	if storedVersion(table, "jason") != 2 {
+		t.Fatal("jason should be written back with version 2, but isn't")
+	}
+
+	_, err = table.Get("jason", &person)
+	panicNotNil(err)
+
+	if person.Age != 190 {
+		t.Fatal("jason should only be migrated once, but isn't")
+	}
+
+	person.Age = 20
+	panicNotNil(table.Set("jason", person, counter))
+}
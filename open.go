@@ -2,8 +2,12 @@ package jvzc
 
 import (
 	"errors"
+	"io/ioutil"
 	"log"
 	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -15,6 +19,13 @@ import (
 
 type indexConfig struct {
 	IndexName string
+	Shards    int
+	PerKey    bool
+	SelfHeal  bool
+	Unique    bool
+	Project   []string
+	Field     string
+	Partial   bool
 }
 
 type tableConfig struct {
@@ -23,28 +34,72 @@ type tableConfig struct {
 	UseKeyCompression bool
 	KeyCompression    map[string]string
 	NextKey           string
+	Compression       Compression
+	Metadata          bool
+	Dir               string
+	ArrayEncoding     bool
+	MaxValueSize      int64
+	ChangeLog         bool
 }
 
+// configVersion is the version of the configuration written by this version
+// of the package. It is increased whenever the configuration changes in a
+// way which needs older configurations to be migrated by migrateConfig.
+const configVersion = 1
+
 type dbConfig struct {
-	Tables []tableConfig
+	ConfigVersion int
+	Tables        []tableConfig
 }
 
-func (d *DB) newKV(names ...Name) (*badger.KV, error) {
+// migrateConfig migrates a configuration written by an older version of the
+// package to the current version, filling in defaults for fields which it
+// did not have. The migrated configuration is written the next time the
+// configuration changes.
+func migrateConfig(config *dbConfig) error {
+	if config.ConfigVersion > configVersion {
+		return errors.New("jvzc: database configuration is from a newer " +
+			"version, version " + strconv.Itoa(config.ConfigVersion))
+	}
+
+	if config.ConfigVersion < 1 {
+		// Tables created before key compression was persisted have no
+		// compressed keys.
+		for i, table := range config.Tables {
+			if table.UseKeyCompression && table.KeyCompression == nil {
+				config.Tables[i].KeyCompression = make(map[string]string)
+			}
+		}
+	}
+
+	config.ConfigVersion = configVersion
+	return nil
+}
+
+// kvDir returns the directory of the store of the table or index with the
+// given names.
+func (d *DB) kvDir(names ...Name) string {
 	dir := d.path
 
 	for _, name := range names {
 		dir += "/" + name.Hex()
 	}
 
-	dir += "/data"
+	return dir + "/data"
+}
+
+func (d *DB) newKV(names ...Name) (*badger.KV, error) {
+	return d.openKV(d.kvDir(names...), d.openOptions)
+}
 
+// openKV opens or creates the store in the directory with the options.
+func (d *DB) openKV(dir string, opts badger.Options) (*badger.KV, error) {
 	if found, _ := exists(dir); !found {
 		if err := os.MkdirAll(dir, 0744); err != nil {
 			return nil, err
 		}
 	}
 
-	opts := d.openOptions
 	opts.Dir = dir
 	opts.ValueDir = dir
 
@@ -71,14 +126,28 @@ func (d *DB) newKV(names ...Name) (*badger.KV, error) {
 // Open opens the database at the provided path. It will create a new
 // database if the folder does not exist.
 func Open(path string, opts ...badger.Options) (*DB, error) {
+	return OpenWithConfigPath(path, path+"/config.dat", opts...)
+}
+
+// OpenWithConfigPath opens the database at the provided path like Open, but
+// reads and writes the configuration of the database at configPath instead
+// of in the database's folder. The configuration is rewritten whenever
+// tables or indexes are created or dropped, so it can be placed on faster
+// storage than the documents. The same configPath must be used every time
+// the database is opened.
+func OpenWithConfigPath(path, configPath string,
+	opts ...badger.Options) (*DB, error) {
 	defaultOpts := badger.DefaultOptions
 	defaultOpts.TableLoadingMode = options.MemoryMap
 
 	db := &DB{
 		path:        path,
+		configPath:  configPath,
+		config:      dbConfig{ConfigVersion: configVersion},
 		tables:      make(map[Name]*Table),
 		configMutex: new(sync.Mutex),
 		openOptions: defaultOpts,
+		idle:        sync.NewCond(new(sync.Mutex)),
 	}
 
 	if len(opts) > 0 {
@@ -91,10 +160,26 @@ func Open(path string, opts ...badger.Options) (*DB, error) {
 				err.Error())
 		}
 
+		if err := os.MkdirAll(filepath.Dir(configPath), 0744); err != nil {
+			return nil, errors.New("jvzc: failed to create database: " +
+				err.Error())
+		}
+
+		// Write the empty configuration, so that the database can be opened
+		// again even if no tables are created.
+		if err := db.writeConfig(); err != nil {
+			return nil, errors.New("jvzc: failed to create database: " +
+				err.Error())
+		}
+
+		if err := db.openJournal(); err != nil {
+			return nil, err
+		}
+
 		return db, nil
 	}
 
-	file, err := os.Open(path + "/config.dat")
+	file, err := os.Open(configPath)
 	if err != nil {
 		return nil, errors.New("jvzc: failed to open database configuration. " +
 			"If this is new database, please delete the database folder first: " +
@@ -109,12 +194,19 @@ func Open(path string, opts ...badger.Options) (*DB, error) {
 			err.Error())
 	}
 
+	if err = migrateConfig(&config); err != nil {
+		return nil, err
+	}
+
 	db.config = config
 
 	for _, table := range config.Tables {
-		tb := &Table{indexes: make(map[Name]*Index)}
+		tb := newTable(db, Name(table.TableName))
 		for _, index := range table.Indexes {
-			idx := &Index{}
+			idx := &Index{
+				indexName:      Name(index.IndexName),
+				predicateMutex: new(sync.RWMutex),
+			}
 
 			idx.index, err = db.newKV(Name(table.TableName), Name(index.IndexName))
 			if err != nil {
@@ -123,24 +215,45 @@ func Open(path string, opts ...badger.Options) (*DB, error) {
 					index.IndexName + ": " + err.Error())
 			}
 			idx.table = tb
+			idx.query = index.IndexName
+			if index.Field != "" {
+				idx.query = index.Field
+			}
+			idx.shards = index.Shards
+			idx.perKey = index.PerKey
+			idx.selfHeal = index.SelfHeal
+			idx.unique = index.Unique
+			idx.project = index.Project
+			idx.partial = index.Partial
 
 			tb.indexes[Name(index.IndexName)] = idx
 		}
 
-		tb.data, err = db.newKV(Name(table.TableName))
+		tb.dir = table.Dir
+		if tb.dir == "" {
+			tb.dir = db.kvDir(Name(table.TableName))
+		}
+
+		tb.data, err = db.openKV(tb.dir, db.openOptions)
 		if err != nil {
 			return nil, errors.New("jvzc: failed to open " +
 				table.TableName + ": " + err.Error())
 		}
-		tb.db = db
-
-		if table.UseKeyCompression {
-			if table.KeyCompression != nil {
-				tb.keyToCompressed = table.KeyCompression
-			} else {
-				tb.keyToCompressed = make(map[string]string)
+		tb.compression = table.Compression
+		tb.metadata = table.Metadata
+		tb.arrayEncoding = table.ArrayEncoding
+		tb.maxValueSize = table.MaxValueSize
+		tb.changeLog = table.ChangeLog
+
+		// The change log is kept when it is disabled, so it can still be read.
+		if ex, _ := exists(tb.changeLogDir()); ex || tb.changeLog {
+			if err := tb.openChangeLog(); err != nil {
+				return nil, err
 			}
+		}
 
+		if table.UseKeyCompression {
+			tb.keyToCompressed = table.KeyCompression
 			tb.compressedToKey = make(map[string]string)
 			tb.nextKey = table.NextKey
 			tb.compressionLock = new(sync.RWMutex)
@@ -152,16 +265,177 @@ func Open(path string, opts ...badger.Options) (*DB, error) {
 		db.tables[Name(table.TableName)] = tb
 	}
 
+	if err := db.openJournal(); err != nil {
+		return nil, err
+	}
+
 	return db, nil
 }
 
+// OpenMemory opens a new, empty database in a temporary directory which is
+// deleted when the database is closed. It is intended for tests, which can
+// use the full API without managing a directory of their own. The stores are
+// configured with small tables to limit memory use, and without syncing
+// writes to disk, so it should not be used to store data which must survive
+// a crash.
+func OpenMemory() (*DB, error) {
+	dir, err := ioutil.TempDir("", "jvzc_memory_")
+	if err != nil {
+		return nil, errors.New("jvzc: failed to create database: " +
+			err.Error())
+	}
+
+	opts := badger.DefaultOptions
+	opts.TableLoadingMode = options.LoadToRAM
+	opts.SyncWrites = false
+	opts.MaxTableSize = 1 << 20
+	opts.NumMemtables = 2
+	opts.ValueLogFileSize = 16 << 20
+
+	db, err := Open(dir+"/data", opts)
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+
+	db.tempDir = dir
+	return db, nil
+}
+
+// OpenExisting opens the database at the provided path like Open, and adopts
+// badger stores created by other tools as tables of the database. tables maps
+// the names of the tables to the directories of their stores, which are used
+// in place without being copied. The documents in the stores must be msgpack
+// documents, and the tables are adopted without key compression so that the
+// documents can be read as they are.
+//
+// Every store is opened before the configuration of the database is written,
+// so no tables are adopted if any of them fail to open. Tables which were
+// already adopted from the same directory are left as they are, so
+// OpenExisting can be used every time the database is opened. Dropping an
+// adopted table does not remove its store.
+func OpenExisting(path string, tables map[string]string,
+	opts ...badger.Options) (*DB, error) {
+	db, err := Open(path, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = db.adopt(tables); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// adopt registers the stores in the directories as tables of the database.
+func (d *DB) adopt(tables map[string]string) error {
+	d.configMutex.Lock()
+	defer d.configMutex.Unlock()
+
+	names := make([]string, 0, len(tables))
+	for name := range tables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var configs []tableConfig
+	var kvs []*badger.KV
+
+	closeAll := func() {
+		for _, kv := range kvs {
+			kv.Close()
+		}
+	}
+
+	for _, name := range names {
+		if name == "" || len(name) > 125 {
+			closeAll()
+			return ErrBadIdentifier
+		}
+
+		dir, err := filepath.Abs(tables[name])
+		if err != nil {
+			closeAll()
+			return err
+		}
+
+		if table, found := d.tables[Name(name)]; found {
+			if table.dir == dir {
+				continue
+			}
+
+			closeAll()
+			return ErrAlreadyExists
+		}
+
+		if found, _ := exists(dir); !found {
+			closeAll()
+			return errors.New("jvzc: failed to open " + name + ": " + dir +
+				" does not exist")
+		}
+
+		kv, err := d.openKV(dir, d.openOptions)
+		if err != nil {
+			closeAll()
+			return errors.New("jvzc: failed to open " + name + ": " +
+				err.Error())
+		}
+
+		kvs = append(kvs, kv)
+		configs = append(configs, tableConfig{TableName: name, Dir: dir})
+	}
+
+	if len(configs) == 0 {
+		return nil
+	}
+
+	d.config.Tables = append(d.config.Tables, configs...)
+	if err := d.writeConfig(); err != nil {
+		d.config.Tables = d.config.Tables[:len(d.config.Tables)-len(configs)]
+		closeAll()
+		return err
+	}
+
+	for i, config := range configs {
+		tb := newTable(d, Name(config.TableName))
+		tb.data = kvs[i]
+		tb.dir = config.Dir
+		d.tables[Name(config.TableName)] = tb
+	}
+
+	return nil
+}
+
+// writeConfig writes the configuration to a temporary file which is then
+// renamed over the configuration, so that a crash while writing leaves the
+// previous configuration intact.
 func (d *DB) writeConfig() error {
-	file, err := os.Create(d.path + "/config.dat")
+	tempPath := d.configPath + ".tmp"
+	file, err := os.Create(tempPath)
 	if err != nil {
 		return err
 	}
 
-	defer file.Close()
+	err = msgpack.NewEncoder(file).Encode(d.config)
+	if err == nil {
+		err = file.Sync()
+	}
+
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		os.Remove(tempPath)
+		return err
+	}
+
+	if err := os.Rename(tempPath, d.configPath); err != nil {
+		os.Remove(tempPath)
+		return err
+	}
 
-	return msgpack.NewEncoder(file).Encode(d.config)
+	return syncFile(filepath.Dir(d.configPath))
 }
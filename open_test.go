@@ -0,0 +1,324 @@
+package jvzc
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/1lann/badger"
+	"github.com/1lann/msgpack"
+)
+
+func TestOpenExisting(t *testing.T) {
+	if testing.Short() {
+		t.Parallel()
+	}
+
+	dir, err := ioutil.TempDir("", "jvzc_")
+	panicNotNil(err)
+
+	t.Log("testing directory:", dir)
+	defer func() {
+		if !t.Failed() {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	// Write documents with badger directly, as another tool would.
+	panicNotNil(os.MkdirAll(dir+"/external", 0744))
+	opts := badger.DefaultOptions
+	opts.Dir = dir + "/external"
+	opts.ValueDir = dir + "/external"
+	opts.MaxTableSize = 1 << 20
+	kv, err := badger.NewKV(&opts)
+	panicNotNil(err)
+
+	jason := Person{Name: "Jason", City: "Sydney", Age: 18}
+	data, err := msgpack.Marshal(jason)
+	panicNotNil(err)
+	panicNotNil(kv.Set([]byte("jason"), data, 0))
+	panicNotNil(kv.Close())
+
+	_, err = OpenExisting(dir+"/data", map[string]string{
+		"people":  dir + "/external",
+		"missing": dir + "/missing",
+	})
+	if err == nil {
+		t.Fatal("adopting a missing directory should fail, but didn't")
+	}
+
+	db, err := Open(dir + "/data")
+	panicNotNil(err)
+
+	if len(db.Tables()) != 0 {
+		t.Fatal("no tables should be adopted, but were")
+	}
+
+	db.Close()
+
+	for i := 0; i < 2; i++ {
+		db, err = OpenExisting(dir+"/data", map[string]string{
+			"people": dir + "/external",
+		})
+		panicNotNil(err)
+
+		table := db.Table("people")
+		if table == nil {
+			t.Fatal("people should be adopted, but isn't")
+		}
+
+		if i == 0 {
+			panicNotNil(table.NewIndex("City"))
+		}
+
+		expectPerson("jason", table.Index("City").GetAll("Sydney"), jason)
+
+		db.Close()
+	}
+
+	db, err = Open(dir + "/data")
+	panicNotNil(err)
+
+	defer db.Close()
+
+	table := db.Table("people")
+	if table.Config().Dir == "" || table.DataDir() != dir+"/external" {
+		t.Fatal("people should be stored in the external directory, but isn't")
+	}
+
+	if table.Dir() != dir+"/data/"+Name("people").Hex() {
+		t.Fatal("dir should be the directory of the table, but is",
+			table.Dir())
+	}
+
+	panicNotNil(table.Drop())
+
+	if found, _ := exists(dir + "/external"); !found {
+		t.Fatal("dropping an adopted table should keep its store, but didn't")
+	}
+}
+
+func TestOpenMemory(t *testing.T) {
+	if testing.Short() {
+		t.Parallel()
+	}
+
+	db, err := OpenMemory()
+	panicNotNil(err)
+
+	dir := db.tempDir
+	if ex, _ := exists(dir); !ex {
+		t.Fatal("temporary directory should exist, but doesn't")
+	}
+
+	panicNotNil(db.NewTable("memory_testing"))
+	table := db.Table("memory_testing")
+	panicNotNil(table.NewIndex("City"))
+
+	jason := Person{Name: "Jason", City: "Sydney", Age: 18}
+	drew := Person{Name: "Drew", City: "London", Age: 21}
+	panicNotNil(table.Set("jason", jason))
+	panicNotNil(table.Set("drew", drew))
+
+	r := table.Index("City").GetAll("Sydney")
+	expectPerson("jason", r, jason)
+	r.Close()
+
+	r = table.All()
+	expectPerson("drew", r, drew)
+	expectPerson("jason", r, jason)
+	r.Close()
+
+	db.Close()
+
+	if ex, _ := exists(dir); ex {
+		t.Fatal("temporary directory should be deleted, but isn't")
+	}
+}
+
+func TestOpenWithConfigPath(t *testing.T) {
+	if testing.Short() {
+		t.Parallel()
+	}
+
+	dir, err := ioutil.TempDir("", "jvzc_")
+	panicNotNil(err)
+
+	t.Log("testing directory:", dir)
+	defer func() {
+		if !t.Failed() {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	configPath := dir + "/config/jvzc.dat"
+
+	db, err := OpenWithConfigPath(dir+"/data", configPath)
+	panicNotNil(err)
+
+	panicNotNil(db.NewTable("people"))
+	panicNotNil(db.Table("people").NewIndex("City"))
+	panicNotNil(db.NewTable("dropped"))
+	panicNotNil(db.Table("dropped").Drop())
+
+	jason := Person{Name: "Jason", City: "Sydney", Age: 18}
+	panicNotNil(db.Table("people").Set("jason", jason))
+	db.Close()
+
+	if _, err := os.Stat(dir + "/data/config.dat"); !os.IsNotExist(err) {
+		t.Fatal("config should not be in the data directory, but is")
+	}
+
+	if _, err := os.Stat(configPath); err != nil {
+		t.Fatal("config should be at the config path, but isn't")
+	}
+
+	if _, err := Open(dir + "/data"); err == nil {
+		t.Fatal("opening without the config path should fail, but didn't")
+	}
+
+	db, err = OpenWithConfigPath(dir+"/data", configPath)
+	panicNotNil(err)
+
+	defer db.Close()
+
+	if len(db.Tables()) != 1 {
+		t.Fatal("there should be 1 table, but there are", len(db.Tables()))
+	}
+
+	expectPerson("jason", db.Table("people").Index("City").GetAll("Sydney"),
+		jason)
+}
+
+func TestWriteConfigAtomic(t *testing.T) {
+	if testing.Short() {
+		t.Parallel()
+	}
+
+	dir, err := ioutil.TempDir("", "jvzc_")
+	panicNotNil(err)
+
+	t.Log("testing directory:", dir)
+	defer func() {
+		if !t.Failed() {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	db, err := Open(dir + "/data")
+	panicNotNil(err)
+
+	panicNotNil(db.NewTable("people"))
+
+	// Block the temporary file, so that writing the config fails part way.
+	panicNotNil(os.Mkdir(dir+"/data/config.dat.tmp", 0744))
+
+	if db.NewTable("failed") == nil {
+		t.Fatal("creating a table should fail, but didn't")
+	}
+
+	db.Close()
+
+	// Leave a truncated temporary file, as a crash while writing would.
+	panicNotNil(os.Remove(dir + "/data/config.dat.tmp"))
+	panicNotNil(ioutil.WriteFile(dir+"/data/config.dat.tmp", []byte{0x81},
+		0644))
+
+	db, err = Open(dir + "/data")
+	panicNotNil(err)
+
+	if db.Table("people") == nil {
+		t.Fatal("table people should exist, but doesn't")
+	}
+
+	panicNotNil(db.NewTable("cities"))
+	db.Close()
+
+	if _, err := os.Stat(dir + "/data/config.dat.tmp"); !os.IsNotExist(err) {
+		t.Fatal("temporary config should be removed, but isn't")
+	}
+
+	db, err = Open(dir + "/data")
+	panicNotNil(err)
+
+	defer db.Close()
+
+	if db.Table("cities") == nil {
+		t.Fatal("table cities should exist, but doesn't")
+	}
+}
+
+func TestOpenOldConfig(t *testing.T) {
+	if testing.Short() {
+		t.Parallel()
+	}
+
+	dir, err := ioutil.TempDir("", "jvzc_")
+	panicNotNil(err)
+
+	t.Log("testing directory:", dir)
+	defer func() {
+		if !t.Failed() {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	db, err := Open(dir + "/data")
+	panicNotNil(err)
+
+	panicNotNil(db.NewTable("people"))
+	panicNotNil(db.Table("people").NewIndex("City"))
+	db.Close()
+
+	// Write the config as the first versions of the package did.
+	type oldIndexConfig struct {
+		IndexName string
+	}
+
+	type oldTableConfig struct {
+		TableName         string
+		Indexes           []oldIndexConfig
+		UseKeyCompression bool
+	}
+
+	data, err := msgpack.Marshal(struct {
+		Tables []oldTableConfig
+	}{[]oldTableConfig{{
+		TableName:         "people",
+		Indexes:           []oldIndexConfig{{IndexName: "City"}},
+		UseKeyCompression: true,
+	}}})
+	panicNotNil(err)
+	panicNotNil(ioutil.WriteFile(dir+"/data/config.dat", data, 0644))
+
+	db, err = Open(dir + "/data")
+	panicNotNil(err)
+
+	jason := Person{Name: "Jason", City: "Sydney", Age: 18}
+	panicNotNil(db.Table("people").Set("jason", jason))
+	expectPerson("jason", db.Table("people").Index("City").GetAll("Sydney"),
+		jason)
+
+	panicNotNil(db.NewTable("cities"))
+	db.Close()
+
+	data, err = ioutil.ReadFile(dir + "/data/config.dat")
+	panicNotNil(err)
+
+	var config dbConfig
+	panicNotNil(msgpack.Unmarshal(data, &config))
+
+	if config.ConfigVersion != configVersion {
+		t.Fatal("config version should be", configVersion, "but is",
+			config.ConfigVersion)
+	}
+
+	config.ConfigVersion = configVersion + 1
+	data, err = msgpack.Marshal(config)
+	panicNotNil(err)
+	panicNotNil(ioutil.WriteFile(dir+"/data/config.dat", data, 0644))
+
+	if _, err := Open(dir + "/data"); err == nil {
+		t.Fatal("opening a newer config should fail, but didn't")
+	}
+}
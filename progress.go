@@ -0,0 +1,91 @@
+package jvzc
+
+import (
+	"sync/atomic"
+
+	"github.com/1lann/badger"
+)
+
+// progressInterval is the number of documents processed between each report
+// to DB.OnProgress.
+const progressInterval = 10000
+
+// Progress represents the progress of a long running operation over the
+// documents of a table, such as building a new index.
+type Progress struct {
+	// Operation is the name of the operation, such as "index".
+	Operation string
+	// Name is the name of the table, or "table/index" for an index.
+	Name string
+	// Done is the number of documents processed so far.
+	Done int64
+	// Total is the estimated number of documents which will be processed.
+	Total int64
+}
+
+// progress tracks the progress of an operation, periodically reporting it
+// to DB.OnProgress. It is safe for concurrent use.
+type progress struct {
+	db        *DB
+	operation string
+	name      string
+	done      int64
+	total     int64
+}
+
+// newProgress returns a progress tracker for an operation over the documents
+// stored in the given KV. The total is only estimated if DB.OnProgress is set,
+// as it requires iterating over the keys of the KV.
+func (d *DB) newProgress(operation, name string, kv *badger.KV) *progress {
+	p := &progress{
+		db:        d,
+		operation: operation,
+		name:      name,
+	}
+
+	if d.OnProgress != nil {
+		p.total = int64(countKeys(kv))
+	}
+
+	return p
+}
+
+// add records that a document has been processed.
+func (p *progress) add() {
+	if done := atomic.AddInt64(&p.done, 1); done%progressInterval == 0 {
+		p.send(done)
+	}
+}
+
+// report reports the current progress to DB.OnProgress.
+func (p *progress) report() {
+	p.send(atomic.LoadInt64(&p.done))
+}
+
+func (p *progress) send(done int64) {
+	if p.db.OnProgress == nil {
+		return
+	}
+
+	p.db.OnProgress(Progress{
+		Operation: p.operation,
+		Name:      p.name,
+		Done:      done,
+		Total:     p.total,
+	})
+}
+
+// countKeys returns the number of keys in the KV, without fetching values.
+func countKeys(kv *badger.KV) int {
+	itOpts := badger.DefaultIteratorOptions
+	itOpts.PrefetchValues = false
+	it := kv.NewIterator(itOpts)
+	defer it.Close()
+
+	var count int
+	for it.Rewind(); it.Valid(); it.Next() {
+		count++
+	}
+
+	return count
+}
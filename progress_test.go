@@ -0,0 +1,69 @@
+package jvzc
+
+import (
+	"io/ioutil"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestProgress(t *testing.T) {
+	if testing.Short() {
+		t.Parallel()
+	}
+
+	dir, err := ioutil.TempDir("", "jvzc_")
+	panicNotNil(err)
+
+	t.Log("testing directory:", dir)
+	defer func() {
+		if !t.Failed() {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	db, err := Open(dir + "/data")
+	panicNotNil(err)
+
+	defer db.Close()
+
+	var mutex sync.Mutex
+	var reports []Progress
+	db.OnProgress = func(p Progress) {
+		mutex.Lock()
+		reports = append(reports, p)
+		mutex.Unlock()
+	}
+
+	panicNotNil(db.NewTable("progress_testing"))
+
+	for i := 0; i < progressInterval+10; i++ {
+		panicNotNil(db.Table("progress_testing").Set(strconv.Itoa(i),
+			Person{Name: "Jason", City: "Sydney", Age: i}))
+	}
+
+	panicNotNil(db.Table("progress_testing").NewIndex("Age"))
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if len(reports) != 2 {
+		t.Fatal("there should be 2 progress reports, but there are",
+			len(reports))
+	}
+
+	if reports[0].Done != progressInterval {
+		t.Fatal("first report should be at the progress interval, but is",
+			reports[0].Done)
+	}
+
+	last := reports[1]
+	if last.Operation != "index" || last.Name != "progress_testing/Age" {
+		t.Fatal("report should be for the index, but isn't")
+	}
+
+	if last.Done != progressInterval+10 || last.Total != progressInterval+10 {
+		t.Fatal("report should be complete, but isn't")
+	}
+}
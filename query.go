@@ -0,0 +1,207 @@
+package jvzc
+
+import (
+	"bytes"
+	"errors"
+	"sort"
+	"sync/atomic"
+)
+
+// QueryOptions configures a query made with QueryWithOptions. The zero value
+// is the same as Query.
+type QueryOptions struct {
+	// Limit is the maximum number of documents returned, or 0 for no limit.
+	Limit int
+	// Skip is the number of matching documents skipped before the first
+	// document returned.
+	Skip int
+	// Reverse sorts the documents in descending order by key.
+	Reverse bool
+	// Scan matches conditions without an index against every document found
+	// by the other conditions, or against every document of the table if
+	// none of the conditions have an index, instead of returning an error.
+	// Documents match such a condition if they would be in an index on the
+	// condition with the condition's value.
+	Scan bool
+}
+
+// Query returns a Range of the documents which match all of the given
+// conditions. Each condition maps the name of an index to the index value
+// that matching documents must have. The primary keys of each condition are
+// looked up through their index and intersected, so every condition must have
+// a corresponding index. The range is sorted in ascending order by key.
+//
+// The intersection starts from the condition with the fewest matching
+// primary keys.
+//
+// An error naming the index will be returned if a condition does not have an
+// index.
+func (t *Table) Query(conditions map[string]interface{}) (*Range, error) {
+	return t.QueryWithOptions(conditions, QueryOptions{})
+}
+
+// QueryWithOptions returns a Range of the documents which match all of the
+// given conditions like Query, configured by the options, which can paginate
+// the documents and match conditions which have no index.
+func (t *Table) QueryWithOptions(conditions map[string]interface{},
+	opts QueryOptions) (*Range, error) {
+	names := make([]string, 0, len(conditions))
+	var residual []string
+	for name := range conditions {
+		if t.Index(name) != nil {
+			names = append(names, name)
+		} else if opts.Scan {
+			residual = append(residual, name)
+		} else {
+			return nil, errors.New("jvzc: no index for query condition \"" +
+				name + "\"")
+		}
+	}
+
+	if len(names) == 0 {
+		return paginate(t.filterConditions(t.All(opts.Reverse), conditions,
+			residual), opts), nil
+	}
+
+	atomic.AddUint64(&t.ops.Ranges, 1)
+
+	sort.Strings(names)
+
+	// The primary keys of every condition are looked up first, so that the
+	// intersection can start from the shortest list.
+	lists := make([][]string, 0, len(names))
+	for _, name := range names {
+		indexKeys, err := t.Index(name).getKeys(valueToBytes(conditions[name]))
+		if err != nil {
+			return nil, err
+		}
+
+		if len(indexKeys) == 0 {
+			lists = [][]string{nil}
+			break
+		}
+
+		lists = append(lists, indexKeys)
+	}
+
+	sort.SliceStable(lists, func(a, b int) bool {
+		return len(lists[a]) < len(lists[b])
+	})
+
+	keys := lists[0]
+	for _, indexKeys := range lists[1:] {
+		keys = intersectKeys(indexKeys, keys)
+		if len(keys) == 0 {
+			break
+		}
+	}
+
+	keys = uniqueKeys(keys)
+	sort.Strings(keys)
+
+	if opts.Reverse {
+		for l, r := 0, len(keys)-1; l < r; l, r = l+1, r-1 {
+			keys[l], keys[r] = keys[r], keys[l]
+		}
+	}
+
+	if len(residual) > 0 {
+		return paginate(t.filterConditions(t.keysRange(keys), conditions,
+			residual), opts), nil
+	}
+
+	// Without conditions to filter by, the keys can be paginated before any
+	// documents are read.
+	if opts.Skip > 0 {
+		if opts.Skip >= len(keys) {
+			keys = nil
+		} else {
+			keys = keys[opts.Skip:]
+		}
+	}
+
+	if opts.Limit > 0 && opts.Limit < len(keys) {
+		keys = keys[:opts.Limit]
+	}
+
+	return t.keysRange(keys), nil
+}
+
+// filterConditions filters the range to the documents which match the
+// conditions with the given names, which have no index.
+func (t *Table) filterConditions(r *Range, conditions map[string]interface{},
+	names []string) *Range {
+	if len(names) == 0 {
+		return r
+	}
+
+	sort.Strings(names)
+	idx := &Index{table: t}
+
+	return r.Filter(func(doc Document) (bool, error) {
+		for _, name := range names {
+			results, err := idx.indexQuery(doc.data, name)
+			if err != nil {
+				return false, nil
+			}
+
+			expected := valueToBytes(conditions[name])
+
+			found := false
+			for _, result := range results {
+				if bytes.Equal(valueToBytes(result), expected) {
+					found = true
+					break
+				}
+			}
+
+			if !found {
+				return false, nil
+			}
+		}
+
+		return true, nil
+	})
+}
+
+// paginate skips and limits the range by the options.
+func paginate(r *Range, opts QueryOptions) *Range {
+	if opts.Skip > 0 {
+		r = r.Skip(opts.Skip)
+	}
+
+	if opts.Limit > 0 {
+		r = r.Limit(int64(opts.Limit))
+	}
+
+	return r
+}
+
+func intersectKeys(a, b []string) []string {
+	inB := make(map[string]bool, len(b))
+	for _, key := range b {
+		inB[key] = true
+	}
+
+	var results []string
+	for _, key := range a {
+		if inB[key] {
+			results = append(results, key)
+		}
+	}
+
+	return results
+}
+
+func uniqueKeys(keys []string) []string {
+	seen := make(map[string]bool, len(keys))
+	results := keys[:0]
+	for _, key := range keys {
+		if !seen[key] {
+			seen[key] = true
+			results = append(results, key)
+		}
+	}
+
+	return results
+}
@@ -1,6 +1,9 @@
 package jvzc
 
 import (
+	"io/ioutil"
+	"os"
+	"strings"
 	"testing"
 	"time"
 
@@ -99,3 +102,244 @@ func TestQuery(t *testing.T) {
 		t.Fatal("query should be nil, but isn't")
 	}
 }
+
+func TestTableQuery(t *testing.T) {
+	if testing.Short() {
+		t.Parallel()
+	}
+
+	people := map[string]Person{
+		"ben": {
+			Name: "Ben",
+			City: "Melbourne",
+			Age:  19,
+		},
+		"drew": {
+			Name: "Drew",
+			City: "London",
+			Age:  18,
+		},
+		"jason": {
+			Name: "Jason",
+			City: "Sydney",
+			Age:  18,
+		},
+		"matheus": {
+			Name: "Matheus",
+			City: "Sydney",
+			Age:  18,
+		},
+	}
+
+	dir, err := ioutil.TempDir("", "jvzc_")
+	panicNotNil(err)
+
+	t.Log("testing directory:", dir)
+	defer func() {
+		if !t.Failed() {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	db, err := Open(dir + "/data")
+	panicNotNil(err)
+
+	defer db.Close()
+
+	panicNotNil(db.NewTable("query_testing"))
+	panicNotNil(db.Table("query_testing").NewIndex("Age"))
+	panicNotNil(db.Table("query_testing").NewIndex("City"))
+
+	for name, person := range people {
+		panicNotNil(db.Table("query_testing").Set(name, person))
+	}
+
+	n, err := db.Table("query_testing").Index("City").ApproxCardinality()
+	panicNotNil(err)
+
+	if n != 3 {
+		t.Fatal("cardinality should be 3, but is", n)
+	}
+
+	n, err = db.Table("query_testing").Index("Age").ApproxCardinality()
+	panicNotNil(err)
+
+	if n != 2 {
+		t.Fatal("cardinality should be 2, but is", n)
+	}
+
+	r, err := db.Table("query_testing").Query(map[string]interface{}{
+		"Age":  18,
+		"City": "Sydney",
+	})
+	panicNotNil(err)
+
+	expectPerson("jason", r, people["jason"])
+	expectPerson("matheus", r, people["matheus"])
+
+	if r.Next() || r.Error() != ErrEndOfRange {
+		t.Fatal("error should be ErrEndOfRange, but isn't")
+	}
+
+	r, err = db.Table("query_testing").Query(map[string]interface{}{
+		"Age":  19,
+		"City": "Sydney",
+	})
+	panicNotNil(err)
+
+	if r.Next() || r.Error() != ErrEndOfRange {
+		t.Fatal("error should be ErrEndOfRange, but isn't")
+	}
+
+	_, err = db.Table("query_testing").Query(map[string]interface{}{
+		"Age":  18,
+		"Name": "Jason",
+	})
+	if err == nil || err.Error() != "jvzc: no index for query condition \"Name\"" {
+		t.Fatal("error should name the missing index, but doesn't")
+	}
+}
+
+func TestTableQueryOptions(t *testing.T) {
+	if testing.Short() {
+		t.Parallel()
+	}
+
+	dir, err := ioutil.TempDir("", "jvzc_")
+	panicNotNil(err)
+
+	t.Log("testing directory:", dir)
+	defer func() {
+		if !t.Failed() {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	db, err := Open(dir + "/data")
+	panicNotNil(err)
+
+	defer db.Close()
+
+	panicNotNil(db.NewTable("query_testing"))
+	table := db.Table("query_testing")
+	panicNotNil(table.NewIndex("City"))
+
+	keys := []string{"a", "b", "c", "d", "e", "f"}
+	for i, key := range keys {
+		city := "Sydney"
+		if i == 2 {
+			city = "Perth"
+		}
+
+		panicNotNil(table.Set(key, Person{Name: "Person", City: city,
+			Age: 18 + i%2}))
+	}
+
+	expectKeys := func(r *Range, err error, expected string) {
+		panicNotNil(err)
+		defer r.Close()
+
+		var found []string
+		for r.Next() {
+			found = append(found, r.Key())
+		}
+
+		if r.Error() != ErrEndOfRange {
+			t.Fatal("error should be ErrEndOfRange, but is", r.Error())
+		}
+
+		if strings.Join(found, ",") != expected {
+			t.Fatal("keys should be", expected, "but are", found)
+		}
+	}
+
+	sydney := map[string]interface{}{"City": "Sydney"}
+
+	r, err := table.QueryWithOptions(sydney, QueryOptions{Skip: 1, Limit: 2})
+	expectKeys(r, err, "b,d")
+
+	r, err = table.QueryWithOptions(sydney, QueryOptions{Reverse: true,
+		Limit: 3})
+	expectKeys(r, err, "f,e,d")
+
+	r, err = table.QueryWithOptions(sydney, QueryOptions{Skip: 10})
+	expectKeys(r, err, "")
+
+	conditions := map[string]interface{}{"City": "Sydney", "Age": 19}
+
+	if _, err = table.QueryWithOptions(conditions, QueryOptions{}); err == nil {
+		t.Fatal("querying an unindexed condition should fail, but didn't")
+	}
+
+	r, err = table.QueryWithOptions(conditions, QueryOptions{Scan: true})
+	expectKeys(r, err, "b,d,f")
+
+	r, err = table.QueryWithOptions(conditions, QueryOptions{Scan: true,
+		Reverse: true, Skip: 1})
+	expectKeys(r, err, "d,b")
+
+	r, err = table.QueryWithOptions(map[string]interface{}{"Age": 18},
+		QueryOptions{Scan: true, Limit: 2})
+	expectKeys(r, err, "a,c")
+}
+
+func TestTopN(t *testing.T) {
+	if testing.Short() {
+		t.Parallel()
+	}
+
+	dir, err := ioutil.TempDir("", "jvzc_")
+	panicNotNil(err)
+
+	t.Log("testing directory:", dir)
+	defer func() {
+		if !t.Failed() {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	db, err := Open(dir + "/data")
+	panicNotNil(err)
+
+	defer db.Close()
+
+	panicNotNil(db.NewTable("top_testing"))
+	table := db.Table("top_testing")
+
+	ages := map[string]int{
+		"ben": 30, "drew": 25, "jason": 30, "kevin": -5, "lily": 12,
+		"mark": 19,
+	}
+	for name, age := range ages {
+		panicNotNil(table.Set(name, Person{Name: name, Age: age}))
+	}
+
+	panicNotNil(table.Set("nobody", map[string]interface{}{"Name": "nobody"}))
+
+	docs, err := table.TopN(3, "Age")
+	panicNotNil(err)
+
+	expected := []string{"ben", "jason", "drew"}
+	if len(docs) != len(expected) {
+		t.Fatal("there should be 3 documents, but there are", len(docs))
+	}
+
+	for i, doc := range docs {
+		if doc.QueryString("Name") != expected[i] {
+			t.Fatal("document", i, "should be", expected[i], "but is",
+				doc.QueryString("Name"))
+		}
+	}
+
+	docs, err = table.TopN(10, "Age")
+	panicNotNil(err)
+
+	if len(docs) != len(ages) {
+		t.Fatal("every document with an age should be returned, but",
+			len(docs), "are")
+	}
+
+	if docs[len(docs)-1].QueryString("Name") != "kevin" {
+		t.Fatal("last document should be kevin, but isn't")
+	}
+}
@@ -3,10 +3,10 @@ package jvzc
 import (
 	"errors"
 	"reflect"
+	"runtime"
+	"runtime/debug"
 	"sync"
 	"sync/atomic"
-
-	"github.com/1lann/msgpack"
 )
 
 const bufferSize = 100
@@ -18,17 +18,91 @@ type bufferEntry struct {
 	err     error
 }
 
-// Range represents a result with multiple values in it and is usually sorted
-// by index/key.
-type Range struct {
+// cursor holds the state of a range which is shared with the goroutine
+// filling its buffer. It is kept separate from Range so that an abandoned
+// Range can still be garbage collected while the goroutine is blocked.
+type cursor struct {
 	buffer chan bufferEntry
 	next   func() (string, []byte, uint64, error)
 	close  func()
 	closed int32
 
+	// requests is set for unbuffered ranges, for which the goroutine only
+	// reads the next entry when it is received, and done is closed when the
+	// range is closed so that the waiting goroutine stops.
+	requests chan struct{}
+	done     chan struct{}
+}
+
+// Range represents a result with multiple values in it and is usually sorted
+// by index/key.
+type Range struct {
+	*cursor
+
 	lastEntry bufferEntry
+	// peeked is the next entry of the range if it has been read by Peek.
+	peeked *bufferEntry
+
+	table  *Table
+	reopen func() *Range
+	seek   func(key string) *Range
 
-	table *Table
+	// lower, upper and reverse are the bounds the range was created with by
+	// Between, returned by Bounds.
+	lower, upper interface{}
+	reverse      bool
+}
+
+// Bounds returns the bounds and direction the range was created with by the
+// Between, BetweenWithOptions or All methods of a table or index, which still
+// apply after the range is reset or seeked. Other ranges, including ranges
+// derived from them such as by Filter or Limit, return nil bounds.
+func (r *Range) Bounds() (lower, upper interface{}, reverse bool) {
+	return r.lower, r.upper, r.reverse
+}
+
+// Peek decodes the next item in the range into dst without advancing the
+// range, so the following call to Next retrieves the same item, and returns
+// its key and counter. dst may be nil to only read the key and counter.
+// ErrEndOfRange is returned if there are no more items. For ranges with the
+// NoCopy option, peeking invalidates the value of the current item.
+func (r *Range) Peek(dst interface{}) (string, uint64, error) {
+	if r.lastEntry.err != nil {
+		return "", 0, r.lastEntry.err
+	}
+
+	if r.peeked == nil {
+		entry, more := r.cursor.receive()
+		if !more {
+			entry = bufferEntry{err: ErrEndOfRange}
+		}
+
+		r.peeked = &entry
+	}
+
+	if r.peeked.err != nil {
+		return "", 0, r.peeked.err
+	}
+
+	if dst != nil {
+		if err := unmarshal(r.table, r.peeked.data, dst); err != nil {
+			return "", 0, err
+		}
+	}
+
+	return r.peeked.key, r.peeked.counter, nil
+}
+
+// receive returns the next entry of the range, which is the entry read by
+// Peek if there is one.
+func (r *Range) receive() (bufferEntry, bool) {
+	if r.peeked != nil {
+		entry := *r.peeked
+		r.peeked = nil
+		return entry, true
+	}
+
+	return r.cursor.receive()
 }
 
 // Next retrieves the next item in the range, and returns true if the
@@ -38,7 +112,7 @@ func (r *Range) Next() bool {
 		return false
 	}
 
-	entry, more := <-r.buffer
+	entry, more := r.receive()
 	if !more {
 		r.lastEntry.err = ErrEndOfRange
 		return false
@@ -61,14 +135,11 @@ func (r *Range) Document() Document {
 	}
 }
 
-// Decode decodes the current item into a pointer.
+// Decode decodes the current item into a pointer. ErrEmptyValue is returned if
+// the item is stored with an empty value, in which case the item can be
+// skipped.
 func (r *Range) Decode(dst interface{}) error {
-	if r.table != nil && r.table.keyToCompressed != nil {
-		return msgpack.UnmarshalCompressed(r.table.cToKey, r.lastEntry.data,
-			dst)
-	}
-
-	return msgpack.Unmarshal(r.lastEntry.data, dst)
+	return unmarshal(r.table, r.lastEntry.data, dst)
 }
 
 // Counter returns the counter of the current item.
@@ -101,7 +172,6 @@ func (r *Range) All(dst interface{}) error {
 	sliceValue = sliceValue.Slice(0, sliceValue.Cap())
 	elemType := sliceValue.Type().Elem()
 	i := 0
-	compressed := r.table != nil && r.table.keyToCompressed != nil
 
 	defer func() {
 		slicePtr.Elem().Set(sliceValue.Slice(0, i))
@@ -109,7 +179,7 @@ func (r *Range) All(dst interface{}) error {
 
 	var err error
 	for {
-		entry, more := <-r.buffer
+		entry, more := r.receive()
 		if !more {
 			return nil
 		}
@@ -123,12 +193,7 @@ func (r *Range) All(dst interface{}) error {
 		if sliceValue.Len() == i {
 			thisElem := reflect.New(elemType)
 
-			if compressed {
-				err = msgpack.UnmarshalCompressed(r.table.cToKey, entry.data,
-					thisElem.Interface())
-			} else {
-				err = msgpack.Unmarshal(entry.data, thisElem.Interface())
-			}
+			err = unmarshal(r.table, entry.data, thisElem.Interface())
 			if err != nil {
 				return err
 			}
@@ -136,13 +201,8 @@ func (r *Range) All(dst interface{}) error {
 			sliceValue = reflect.Append(sliceValue, thisElem.Elem())
 			sliceValue = sliceValue.Slice(0, sliceValue.Cap())
 		} else {
-			if compressed {
-				err = msgpack.UnmarshalCompressed(r.table.cToKey, entry.data,
-					sliceValue.Index(i).Addr().Interface())
-			} else {
-				err = msgpack.Unmarshal(entry.data,
-					sliceValue.Index(i).Addr().Interface())
-			}
+			err = unmarshal(r.table, entry.data,
+				sliceValue.Index(i).Addr().Interface())
 			if err != nil {
 				return err
 			}
@@ -155,7 +215,7 @@ func (r *Range) All(dst interface{}) error {
 // When this limit is reached, ErrEndOfRange will be returned.
 func (r *Range) Limit(n int64) *Range {
 	return newRange(func() (string, []byte, uint64, error) {
-		entry := <-r.buffer
+		entry, _ := r.receive()
 
 		if n <= 0 {
 			return "", nil, 0, ErrEndOfRange
@@ -169,30 +229,130 @@ func (r *Range) Limit(n int64) *Range {
 // Close closes the range. The range will automatically close upon the
 // first encountered error.
 func (r *Range) Close() {
-	if atomic.CompareAndSwapInt32(&r.closed, 0, 1) {
-		r.close()
+	r.cursor.Close()
+}
+
+// Reset closes the range and reopens it from its original position with the
+// same bounds, so that it can be iterated over again. Only ranges returned
+// directly by Between, All and GetAll can be reset, ranges derived from them
+// such as with Filter or Limit cannot.
+func (r *Range) Reset() error {
+	if r.reopen == nil {
+		return errors.New("jvzc: range cannot be reset")
 	}
+
+	r.replace(r.reopen())
+	return nil
+}
+
+// Seek repositions the range to continue from the document with the primary
+// key, or the next document after it in the direction of the range if it
+// doesn't exist, such as to resume iterating from the last processed key.
+// The bounds of the range still apply, so seeking outside of them exhausts
+// the range. Only ranges returned directly by Table.Between and Table.All
+// can be seeked.
+func (r *Range) Seek(key string) error {
+	if r.seek == nil {
+		return errors.New("jvzc: range cannot be seeked")
+	}
+
+	r.replace(r.seek(key))
+	return nil
+}
+
+// replace closes the range and continues it from another range instead.
+func (r *Range) replace(other *Range) {
+	r.Close()
+
+	runtime.SetFinalizer(other, nil)
+
+	r.cursor = other.cursor
+	r.lastEntry = bufferEntry{}
+	r.peeked = nil
+}
+
+// resettable sets the function used by Reset to reopen the range.
+func resettable(r *Range, reopen func() *Range) *Range {
+	r.reopen = reopen
+	return r
+}
+
+func (c *cursor) Close() {
+	if atomic.CompareAndSwapInt32(&c.closed, 0, 1) {
+		c.close()
+
+		if c.done != nil {
+			close(c.done)
+		}
+	}
+}
+
+// receive returns the next entry of the range, and false if there are no
+// more entries.
+func (c *cursor) receive() (bufferEntry, bool) {
+	if c.requests != nil {
+		select {
+		case c.requests <- struct{}{}:
+		default:
+		}
+	}
+
+	entry, more := <-c.buffer
+	return entry, more
 }
 
 func newRange(next func() (string, []byte, uint64, error), closer func(),
 	table *Table) *Range {
-	r := &Range{
+	return startRange(&cursor{
 		buffer: make(chan bufferEntry, bufferSize),
 		next:   next,
 		close:  closer,
+	}, table)
+}
+
+// newUnbufferedRange returns a range which only reads the next entry when it
+// is received, so that the previous entry remains valid until then.
+func newUnbufferedRange(next func() (string, []byte, uint64, error),
+	closer func(), table *Table) *Range {
+	return startRange(&cursor{
+		buffer:   make(chan bufferEntry),
+		next:     next,
+		close:    closer,
+		requests: make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}, table)
+}
+
+func startRange(c *cursor, table *Table) *Range {
+
+	r := &Range{
+		cursor: c,
 		table:  table,
 	}
 
+	if table != nil && table.db.Debug {
+		setLeakFinalizer(r)
+	}
+
 	go func() {
 		for {
-			key, data, counter, err := r.next()
-			// r.Close before sending to channel to prevent race condition
+			if c.requests != nil {
+				select {
+				case <-c.requests:
+				case <-c.done:
+					close(c.buffer)
+					return
+				}
+			}
+
+			key, data, counter, err := c.next()
+			// c.Close before sending to channel to prevent race condition
 			if err != nil {
-				r.Close()
+				c.Close()
 			}
-			r.buffer <- bufferEntry{key, data, counter, err}
+			c.buffer <- bufferEntry{key, data, counter, err}
 			if err != nil {
-				close(r.buffer)
+				close(c.buffer)
 				return
 			}
 		}
@@ -201,6 +361,56 @@ func newRange(next func() (string, []byte, uint64, error), closer func(),
 	return r
 }
 
+// guardIterator wraps the next and close functions of a range which reads
+// from an iterator of the database, so that the iterator cannot be closed
+// while the goroutine filling the range's buffer is reading from it. Once
+// closed, next returns ErrEndOfRange, and once the database is closed, it
+// returns ErrClosed. Each call to next is an operation of the database, so
+// that Close waits for it instead of closing the store it reads from.
+func guardIterator(d *DB, next func() (string, []byte, uint64, error),
+	closer func()) (func() (string, []byte, uint64, error), func()) {
+	var mutex sync.Mutex
+	closed := false
+
+	return func() (string, []byte, uint64, error) {
+			mutex.Lock()
+			defer mutex.Unlock()
+
+			if closed {
+				return "", nil, 0, ErrEndOfRange
+			}
+
+			if err := d.acquire(); err != nil {
+				return "", nil, 0, err
+			}
+			defer d.release()
+
+			return next()
+		}, func() {
+			mutex.Lock()
+			defer mutex.Unlock()
+
+			closed = true
+			closer()
+		}
+}
+
+// setLeakFinalizer reports a LeakedRange warning if the range is garbage
+// collected without being closed, along with the stack trace of where the
+// range was created.
+func setLeakFinalizer(r *Range) {
+	stack := string(debug.Stack())
+	runtime.SetFinalizer(r, func(r *Range) {
+		if atomic.LoadInt32(&r.closed) == 0 {
+			r.table.db.warn(Warning{
+				Code: LeakedRange,
+				Name: r.table.name(),
+				Err:  errors.New("range created at:\n" + stack),
+			})
+		}
+	})
+}
+
 // Filter applies a filter onto the range, skipping values where the provided
 // filter returns false. If the filter returns a non-nil error, the range
 // will be stopped, and the error will be returned.
@@ -230,7 +440,7 @@ func (r *Range) Filter(filter func(doc Document) (bool, error),
 		sendToWorker := 0
 
 		for {
-			entry, more := <-r.buffer
+			entry, more := r.receive()
 			if !more {
 				break
 			}
@@ -331,7 +541,7 @@ func (r *Range) Do(operation func(key string, counter uint64, doc Document) erro
 		sendToWorker := 0
 
 		for {
-			entry, more := <-r.buffer
+			entry, more := r.receive()
 			if !more {
 				break
 			}
@@ -410,7 +620,7 @@ func doWorker(wg *sync.WaitGroup, operation func(key string, counter uint64,
 func (r *Range) Skip(n int) *Range {
 	var entry bufferEntry
 	for i := 0; i < n; i++ {
-		entry = <-r.buffer
+		entry, _ = r.receive()
 		if entry.err != nil {
 			return newRange(func() (string, []byte, uint64, error) {
 				return "", nil, 0, entry.err
@@ -430,7 +640,7 @@ func (r *Range) Count() (int64, error) {
 	var entry bufferEntry
 
 	for {
-		entry = <-r.buffer
+		entry, _ = r.receive()
 		if entry.err != nil {
 			if entry.err == ErrEndOfRange {
 				return count, nil
@@ -452,7 +662,7 @@ func (r *Range) Unique() *Range {
 
 	return newRange(func() (string, []byte, uint64, error) {
 		for {
-			entry = <-r.buffer
+			entry, _ = r.receive()
 
 			if entry.err != nil {
 				return entry.key, entry.data, entry.counter, entry.err
@@ -0,0 +1,512 @@
+package jvzc
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/1lann/msgpack"
+)
+
+func TestRangeReset(t *testing.T) {
+	if testing.Short() {
+		t.Parallel()
+	}
+
+	dir, err := ioutil.TempDir("", "jvzc_")
+	panicNotNil(err)
+
+	t.Log("testing directory:", dir)
+	defer func() {
+		if !t.Failed() {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	db, err := Open(dir + "/data")
+	panicNotNil(err)
+
+	defer db.Close()
+
+	panicNotNil(db.NewTable("reset_testing"))
+	table := db.Table("reset_testing")
+	panicNotNil(table.NewIndex("Age"))
+
+	for i := 0; i < 10; i++ {
+		panicNotNil(table.Set(strconv.Itoa(i),
+			Person{Name: "Jason", City: "Sydney", Age: i}))
+	}
+
+	ranges := map[string]*Range{
+		"table":   table.Between("2", "6"),
+		"index":   table.Index("Age").Between(2, 6),
+		"get all": table.Index("Age").GetAll(4),
+	}
+
+	for name, r := range ranges {
+		first, err := r.Count()
+		panicNotNil(err)
+
+		panicNotNil(r.Reset())
+
+		if !r.Next() {
+			t.Fatal(name, "range should have a value after reset, but doesn't")
+		}
+
+		second, err := r.Count()
+		panicNotNil(err)
+
+		if second+1 != first {
+			t.Fatal(name, "count should be", first-1, "but is", second)
+		}
+
+		r.Close()
+	}
+
+	r := table.All().Limit(2)
+	defer r.Close()
+
+	if r.Reset() == nil {
+		t.Fatal("limited range reset should have an error, but doesn't")
+	}
+}
+
+func TestRangeSeek(t *testing.T) {
+	if testing.Short() {
+		t.Parallel()
+	}
+
+	dir, err := ioutil.TempDir("", "jvzc_")
+	panicNotNil(err)
+
+	t.Log("testing directory:", dir)
+	defer func() {
+		if !t.Failed() {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	db, err := Open(dir + "/data")
+	panicNotNil(err)
+
+	defer db.Close()
+
+	panicNotNil(db.NewTable("seek_testing"))
+	table := db.Table("seek_testing")
+	panicNotNil(table.NewIndex("Age"))
+
+	for i := 0; i < 10; i++ {
+		panicNotNil(table.Set(strconv.Itoa(i),
+			Person{Name: "Jason", City: "Sydney", Age: i}))
+	}
+
+	expectKeys := func(r *Range, keys string) {
+		var result string
+		for r.Next() {
+			result += r.Key()
+		}
+
+		if r.Error() != ErrEndOfRange {
+			t.Fatal("error should be ErrEndOfRange, but is", r.Error())
+		}
+
+		if result != keys {
+			t.Fatal("keys should be", keys, "but are", result)
+		}
+	}
+
+	r := table.Between("2", "7")
+	r.Next()
+	panicNotNil(r.Seek("5"))
+	expectKeys(r, "567")
+
+	r = table.Between("2", "7", true)
+	r.Next()
+	panicNotNil(r.Seek("4"))
+	expectKeys(r, "432")
+
+	r = table.All()
+	panicNotNil(r.Seek("75"))
+	expectKeys(r, "89")
+
+	r = table.Between("2", "7")
+	panicNotNil(r.Seek("0"))
+	expectKeys(r, "234567")
+
+	r = table.Between("2", "7")
+	panicNotNil(r.Seek("8"))
+	expectKeys(r, "")
+
+	panicNotNil(r.Reset())
+	expectKeys(r, "234567")
+
+	r = table.Index("Age").All()
+	defer r.Close()
+
+	if r.Seek("5") == nil {
+		t.Fatal("index range seek should have an error, but doesn't")
+	}
+}
+
+func TestRangeNoCopy(t *testing.T) {
+	if testing.Short() {
+		t.Parallel()
+	}
+
+	dir, err := ioutil.TempDir("", "jvzc_")
+	panicNotNil(err)
+
+	t.Log("testing directory:", dir)
+	defer func() {
+		if !t.Failed() {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	db, err := Open(dir + "/data")
+	panicNotNil(err)
+
+	defer db.Close()
+
+	panicNotNil(db.NewTable("nocopy_testing"))
+	table := db.Table("nocopy_testing")
+
+	people := make(map[string]Person)
+	for i := 0; i < 300; i++ {
+		key := fmt.Sprintf("%03d", i)
+		people[key] = Person{
+			Name: strings.Repeat(key, i%20+1),
+			City: "Sydney",
+			Age:  i,
+		}
+		panicNotNil(table.Set(key, people[key]))
+	}
+
+	r := table.BetweenWithOptions(MinValue, MaxValue,
+		RangeOptions{NoCopy: true})
+	count := 0
+	for r.Next() {
+		var person Person
+		panicNotNil(r.Decode(&person))
+
+		if !person.IsSame(people[r.Key()]) {
+			t.Fatal("person should be", r.Key(), "but isn't")
+		}
+
+		count++
+	}
+
+	if r.Error() != ErrEndOfRange || count != 300 {
+		t.Fatal("range should have 300 documents, but has", count, r.Error())
+	}
+
+	r = table.BetweenWithOptions("100", "200", RangeOptions{
+		Reverse: true,
+		NoCopy:  true,
+	})
+	panicNotNil(r.Seek("150"))
+	expectPerson("150", r, people["150"])
+	expectPerson("149", r, people["149"])
+
+	panicNotNil(r.Reset())
+	expectPerson("200", r, people["200"])
+
+	r.Close()
+
+	if r.Next() {
+		t.Fatal("closed range should not have a next document, but does")
+	}
+}
+
+func TestRangePeek(t *testing.T) {
+	if testing.Short() {
+		t.Parallel()
+	}
+
+	dir, err := ioutil.TempDir("", "jvzc_")
+	panicNotNil(err)
+
+	t.Log("testing directory:", dir)
+	defer func() {
+		if !t.Failed() {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	db, err := Open(dir + "/data")
+	panicNotNil(err)
+
+	defer db.Close()
+
+	panicNotNil(db.NewTable("peek_testing"))
+	table := db.Table("peek_testing")
+
+	people := map[string]Person{
+		"ben":   {Name: "Ben", City: "Melbourne", Age: 19},
+		"drew":  {Name: "Drew", City: "London", Age: 18},
+		"jason": {Name: "Jason", City: "Sydney", Age: 18},
+	}
+
+	for key, person := range people {
+		panicNotNil(table.Set(key, person))
+	}
+
+	r := table.All()
+
+	for i := 0; i < 2; i++ {
+		var person Person
+		key, counter, err := r.Peek(&person)
+		panicNotNil(err)
+
+		if key != "ben" || counter == 0 || !person.IsSame(people["ben"]) {
+			t.Fatal("peeked document should be ben, but isn't")
+		}
+	}
+
+	expectPerson("ben", r, people["ben"])
+
+	key, _, err := r.Peek(nil)
+	panicNotNil(err)
+
+	if key != "drew" {
+		t.Fatal("peeked key should be drew, but is", key)
+	}
+
+	n, err := r.Count()
+	panicNotNil(err)
+
+	if n != 2 {
+		t.Fatal("count should include the peeked document, but doesn't")
+	}
+
+	r = table.Between("jason", MaxValue)
+	expectPerson("jason", r, people["jason"])
+
+	if _, _, err = r.Peek(nil); err != ErrEndOfRange {
+		t.Fatal("error should be ErrEndOfRange, but is", err)
+	}
+
+	if r.Next() {
+		t.Fatal("range should not have a next document, but does")
+	}
+}
+
+func TestRawRange(t *testing.T) {
+	if testing.Short() {
+		t.Parallel()
+	}
+
+	dir, err := ioutil.TempDir("", "jvzc_")
+	panicNotNil(err)
+
+	t.Log("testing directory:", dir)
+	defer func() {
+		if !t.Failed() {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	db, err := Open(dir + "/data")
+	panicNotNil(err)
+
+	defer db.Close()
+
+	panicNotNil(db.NewTable("raw_testing", false))
+	table := db.Table("raw_testing")
+	panicNotNil(table.SetCompression(FlateCompression))
+
+	people := []Person{
+		{Name: "Drew", City: "London", Age: 21},
+		{Name: "Jason", City: "Sydney", Age: 18},
+	}
+	for _, person := range people {
+		panicNotNil(table.Set(strings.ToLower(person.Name), person))
+	}
+
+	r := table.RawAll()
+	var values [][]byte
+	for r.Next() {
+		counter, err := table.Get(r.Key(), nil)
+		panicNotNil(err)
+
+		if r.Counter() != counter {
+			t.Fatal("counter should be", counter, "but is", r.Counter())
+		}
+
+		values = append(values, r.Value())
+	}
+	r.Close()
+
+	if r.Error() != ErrEndOfRange {
+		t.Fatal("error should be ErrEndOfRange, but is", r.Error())
+	}
+
+	if len(values) != len(people) {
+		t.Fatal("there should be", len(people), "values, but there are",
+			len(values))
+	}
+
+	for i, value := range values {
+		var person Person
+		panicNotNil(msgpack.Unmarshal(value, &person))
+
+		if !person.IsSame(people[i]) {
+			t.Fatal("person should be", people[i].Name, "but isn't")
+		}
+	}
+
+	var person Person
+	value, counter, err := table.GetRawAndDecode("drew", &person)
+	panicNotNil(err)
+
+	if !person.IsSame(people[0]) {
+		t.Fatal("person should be Drew, but isn't")
+	}
+
+	if !bytes.Equal(value, values[0]) {
+		t.Fatal("value should be the same as the raw value, but isn't")
+	}
+
+	expectedCounter, err := table.Get("drew", nil)
+	panicNotNil(err)
+
+	if counter != expectedCounter {
+		t.Fatal("counter should be", expectedCounter, "but is", counter)
+	}
+
+	_, _, err = table.GetRawAndDecode("nobody", &person)
+	if err != ErrNotFound {
+		t.Fatal("error should be ErrNotFound, but is", err)
+	}
+}
+
+func TestRangeBounds(t *testing.T) {
+	if testing.Short() {
+		t.Parallel()
+	}
+
+	dir, err := ioutil.TempDir("", "jvzc_")
+	panicNotNil(err)
+
+	t.Log("testing directory:", dir)
+	defer func() {
+		if !t.Failed() {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	db, err := Open(dir + "/data")
+	panicNotNil(err)
+
+	defer db.Close()
+
+	panicNotNil(db.NewTable("bounds_testing"))
+	table := db.Table("bounds_testing")
+	panicNotNil(table.NewIndex("Age"))
+
+	for i := 0; i < 10; i++ {
+		panicNotNil(table.Set(strconv.Itoa(i),
+			Person{Name: "Jason", City: "Sydney", Age: i}))
+	}
+
+	ranges := []struct {
+		r       *Range
+		lower   interface{}
+		upper   interface{}
+		reverse bool
+	}{
+		{table.Between("2", "6"), "2", "6", false},
+		{table.All(true), MinValue, MaxValue, true},
+		{table.BetweenWithOptions("3", MaxValue,
+			RangeOptions{Reverse: true}), "3", MaxValue, true},
+		{table.Index("Age").Between(2, 6, true), 2, 6, true},
+		{table.Index("Age").All(), MinValue, MaxValue, false},
+		{table.Index("Age").GetAll(4), nil, nil, false},
+		{table.All().Limit(2), nil, nil, false},
+	}
+
+	for i, test := range ranges {
+		lower, upper, reverse := test.r.Bounds()
+		if lower != test.lower || upper != test.upper ||
+			reverse != test.reverse {
+			t.Fatal("range", i, "bounds should be", test.lower, test.upper,
+				test.reverse, "but are", lower, upper, reverse)
+		}
+
+		test.r.Close()
+	}
+
+	r := table.Between("2", "6")
+	defer r.Close()
+
+	panicNotNil(r.Seek("4"))
+	panicNotNil(r.Reset())
+
+	if lower, upper, _ := r.Bounds(); lower != "2" || upper != "6" {
+		t.Fatal("bounds should be kept after seeking, but aren't")
+	}
+}
+
+func TestRangeEmptyValue(t *testing.T) {
+	if testing.Short() {
+		t.Parallel()
+	}
+
+	dir, err := ioutil.TempDir("", "jvzc_")
+	panicNotNil(err)
+
+	t.Log("testing directory:", dir)
+	defer func() {
+		if !t.Failed() {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	db, err := Open(dir + "/data")
+	panicNotNil(err)
+
+	defer db.Close()
+
+	panicNotNil(db.NewTable("empty_testing", false))
+	table := db.Table("empty_testing")
+
+	jason := Person{Name: "Jason", City: "Sydney", Age: 18}
+	panicNotNil(table.Set("a", jason))
+	panicNotNil(table.Set("b", jason))
+	panicNotNil(table.data.Set(table.dataKey("c"), []byte{}, 0))
+	panicNotNil(table.Set("d", jason))
+	panicNotNil(table.Delete("b"))
+
+	var keys []string
+	var empty []string
+
+	r := table.All()
+	for r.Next() {
+		var person Person
+		err := r.Decode(&person)
+		if err == ErrEmptyValue {
+			empty = append(empty, r.Key())
+			continue
+		}
+		panicNotNil(err)
+
+		keys = append(keys, r.Key())
+	}
+	r.Close()
+
+	if r.Error() != ErrEndOfRange {
+		t.Fatal("error should be ErrEndOfRange, but is", r.Error())
+	}
+
+	if strings.Join(keys, ",") != "a,d" {
+		t.Fatal("keys should be a,d, but are", keys)
+	}
+
+	if len(empty) != 1 || empty[0] != "c" {
+		t.Fatal("empty keys should be c, but are", empty)
+	}
+}
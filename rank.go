@@ -0,0 +1,120 @@
+package jvzc
+
+import (
+	"container/heap"
+	"sort"
+)
+
+// TopN returns the n documents of the table with the highest numeric value of
+// the score field, in descending order of score. Documents with the same
+// score are ordered by their primary key in ascending order, and documents
+// without a numeric score are skipped. The score field is a Query, like the
+// name of an index.
+//
+// Every document of the table is scanned, but only the best n documents are
+// held in memory at a time. Indexes are not used, as index values of
+// negative floating point numbers are not ordered by value.
+func (t *Table) TopN(n int, scoreField string) ([]Document, error) {
+	if n <= 0 {
+		return nil, nil
+	}
+
+	r := t.All()
+	defer r.Close()
+
+	h := &scoreHeap{}
+	for r.Next() {
+		doc := r.Document()
+
+		score, ok := numericValue(doc.QueryOne(scoreField))
+		if !ok {
+			continue
+		}
+
+		entry := scoredDocument{key: r.Key(), score: score, doc: doc}
+		if h.Len() < n {
+			heap.Push(h, entry)
+		} else if entry.before((*h)[0]) {
+			(*h)[0] = entry
+			heap.Fix(h, 0)
+		}
+	}
+
+	if r.Error() != ErrEndOfRange {
+		return nil, r.Error()
+	}
+
+	sort.Slice(*h, func(a, b int) bool {
+		return (*h)[a].before((*h)[b])
+	})
+
+	results := make([]Document, h.Len())
+	for i, entry := range *h {
+		results[i] = entry.doc
+	}
+
+	return results, nil
+}
+
+// numericValue returns the value of a decoded number as a float64, and
+// whether the value is a number.
+func numericValue(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int8:
+		return float64(v), true
+	case int16:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint8:
+		return float64(v), true
+	case uint16:
+		return float64(v), true
+	case uint32:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case float32:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+
+	return 0, false
+}
+
+type scoredDocument struct {
+	key   string
+	score float64
+	doc   Document
+}
+
+// before returns whether the document is ranked before the other document.
+func (s scoredDocument) before(other scoredDocument) bool {
+	if s.score != other.score {
+		return s.score > other.score
+	}
+
+	return s.key < other.key
+}
+
+// scoreHeap is a heap of scored documents with the lowest ranked document
+// at the top, so that it can be replaced by better documents.
+type scoreHeap []scoredDocument
+
+func (h scoreHeap) Len() int           { return len(h) }
+func (h scoreHeap) Less(a, b int) bool { return h[b].before(h[a]) }
+func (h scoreHeap) Swap(a, b int)      { h[a], h[b] = h[b], h[a] }
+
+func (h *scoreHeap) Push(x interface{}) {
+	*h = append(*h, x.(scoredDocument))
+}
+
+func (h *scoreHeap) Pop() interface{} {
+	old := *h
+	entry := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return entry
+}
@@ -0,0 +1,69 @@
+package jvzc
+
+// RawRange is a range over the documents of a table which returns their
+// marshalled values without decoding them.
+type RawRange struct {
+	r *Range
+}
+
+// RawAll returns a RawRange of all the documents in the table, sorted in
+// ascending order by key, or descending order if reverse is true.
+func (t *Table) RawAll(reverse ...bool) *RawRange {
+	return &RawRange{r: t.All(reverse...)}
+}
+
+// Next retrieves the next document in the range, and returns true if the
+// next document is successfully retrieved.
+func (r *RawRange) Next() bool {
+	return r.r.Next()
+}
+
+// Key returns the key of the current document.
+func (r *RawRange) Key() string {
+	return r.r.Key()
+}
+
+// Value returns the msgpack value of the current document. Values are
+// decompressed and decrypted, but otherwise returned as they are stored, so
+// the field names of documents in tables with key compression are
+// compressed. Each value is a copy owned by the caller, which remains valid
+// after the range moves on.
+func (r *RawRange) Value() []byte {
+	return r.r.lastEntry.data
+}
+
+// Counter returns the counter of the current document.
+func (r *RawRange) Counter() uint64 {
+	return r.r.Counter()
+}
+
+// Error returns the last error causing Next to return false. It will be
+// ErrEndOfRange once every document has been read.
+func (r *RawRange) Error() error {
+	return r.r.Error()
+}
+
+// Close closes the range.
+func (r *RawRange) Close() {
+	r.r.Close()
+}
+
+// GetRawAndDecode retrieves the document with the primary key like Get,
+// returning its msgpack value along with its counter. The value is returned
+// like the values of a RawRange, so it can be passed on without being
+// marshalled again. dst may be nil if only the value is needed.
+func (t *Table) GetRawAndDecode(key string, dst interface{}) ([]byte,
+	uint64, error) {
+	itemValue, counter, err := t.getRaw(key)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if dst != nil {
+		if err := unmarshal(t, itemValue, dst); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	return itemValue, counter, nil
+}
@@ -0,0 +1,181 @@
+package jvzc
+
+import (
+	"hash/fnv"
+	"sync"
+)
+
+// defaultReindexWorkers is the number of workers used to index the documents
+// of a table when an index is created or rebuilt.
+const defaultReindexWorkers = 20
+
+// reindexEntry is an entry of an index computed from a document.
+type reindexEntry struct {
+	indexKey   []byte
+	key        string
+	projection []byte
+}
+
+// Reindex clears the index and indexes every document of the table again.
+// The table is read by a single iterator, while the index entries of the
+// documents are computed and written by a pool of workers. Writes to the
+// same index value are always made by the same worker in the order of the
+// documents, so the index is the same regardless of the number of workers.
+//
+// You can optionally specify the number of workers. By default the number
+// of workers is 20. Documents written to the table while it is reindexed
+// may be missing from the index, and can be checked with Verify.
+func (i *Index) Reindex(workers ...int) error {
+	numWorkers := defaultReindexWorkers
+	if len(workers) > 0 && workers[0] > 0 {
+		numWorkers = workers[0]
+	}
+
+	return i.rebuild(numWorkers)
+}
+
+// indexValues adds every document of the table to the index with the
+// number of workers.
+func (i *Index) indexValues(workers int) error {
+	p := i.table.db.newProgress("index", i.name(), i.table.data)
+
+	r := i.table.between(MinValue, MaxValue, RangeOptions{})
+	defer r.Close()
+
+	wg := new(sync.WaitGroup)
+	wg.Add(workers)
+
+	inboxes := make([]chan bufferEntry, workers)
+	outboxes := make([]chan []reindexEntry, workers)
+	writers := make([]chan reindexEntry, workers)
+	for n := range inboxes {
+		inboxes[n] = make(chan bufferEntry)
+		outboxes[n] = make(chan []reindexEntry)
+		writers[n] = make(chan reindexEntry, 100)
+		go i.reindexWorker(inboxes[n], outboxes[n])
+		go i.reindexWriter(wg, writers[n])
+	}
+
+	var rangeErr error
+
+	go func() {
+		sendToWorker := 0
+
+		for r.Next() {
+			inboxes[sendToWorker] <- r.lastEntry
+			sendToWorker = (sendToWorker + 1) % workers
+		}
+
+		rangeErr = r.Error()
+
+		for _, inbox := range inboxes {
+			close(inbox)
+		}
+	}()
+
+	// The entries are read from the workers in the order the documents were
+	// sent to them, and are sent to the writer of their index value.
+	readFromWorker := 0
+	for {
+		entries, more := <-outboxes[readFromWorker]
+		if !more {
+			break
+		}
+		readFromWorker = (readFromWorker + 1) % workers
+
+		p.add()
+
+		for _, entry := range entries {
+			h := fnv.New32a()
+			h.Write(entry.indexKey)
+			writers[h.Sum32()%uint32(workers)] <- entry
+		}
+	}
+
+	for _, writer := range writers {
+		close(writer)
+	}
+
+	wg.Wait()
+	p.report()
+
+	if rangeErr != ErrEndOfRange {
+		return rangeErr
+	}
+
+	return nil
+}
+
+// reindexWorker computes the index entries of the documents from inbox.
+func (i *Index) reindexWorker(inbox chan bufferEntry,
+	outbox chan []reindexEntry) {
+	defer close(outbox)
+
+	for entry := range inbox {
+		outbox <- i.entriesOf(entry.key, entry.data)
+	}
+}
+
+// entriesOf returns the index entries of the document with the key.
+func (i *Index) entriesOf(key string, data []byte) []reindexEntry {
+	if i.partial {
+		predicate := i.getPredicate()
+		if predicate == nil ||
+			!predicate(Document{data: data, table: i.table}) {
+			return nil
+		}
+	}
+
+	results, err := i.indexQuery(data, i.query)
+	if err != nil {
+		if !isMapDocument(data) {
+			i.table.db.warn(Warning{
+				Code: UnindexableDocument,
+				Name: i.name(),
+				Key:  key,
+				Err:  err,
+			})
+		}
+
+		return nil
+	}
+
+	projection, err := i.projectionOf(data)
+	if err != nil {
+		i.table.db.warn(Warning{
+			Code: IndexUpdateFailed,
+			Name: i.name(),
+			Key:  key,
+			Err:  err,
+		})
+		return nil
+	}
+
+	entries := make([]reindexEntry, len(results))
+	for n, result := range results {
+		entries[n] = reindexEntry{
+			indexKey:   valueToBytes(result),
+			key:        key,
+			projection: projection,
+		}
+	}
+
+	return entries
+}
+
+// reindexWriter adds the entries from inbox to the index.
+func (i *Index) reindexWriter(wg *sync.WaitGroup, inbox chan reindexEntry) {
+	defer wg.Done()
+
+	for entry := range inbox {
+		err := i.addToIndex(entry.indexKey, entry.key, entry.projection)
+		if err != nil {
+			i.table.db.warn(Warning{
+				Code: IndexUpdateFailed,
+				Name: i.name(),
+				Key:  entry.key,
+				Err:  err,
+			})
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package jvzc
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/1lann/badger"
+)
+
+// indexEntries returns every entry of the index.
+func indexEntries(idx *Index) map[string][]byte {
+	it := idx.index.NewIterator(badger.DefaultIteratorOptions)
+	defer it.Close()
+
+	entries := make(map[string][]byte)
+	for it.Rewind(); it.Valid(); it.Next() {
+		entries[string(it.Item().Key())] = append([]byte(nil),
+			getItemValue(it.Item())...)
+	}
+
+	return entries
+}
+
+func TestIndexReindex(t *testing.T) {
+	if testing.Short() {
+		t.Parallel()
+	}
+
+	dir, err := ioutil.TempDir("", "jvzc_")
+	panicNotNil(err)
+
+	t.Log("testing directory:", dir)
+	defer func() {
+		if !t.Failed() {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	db, err := Open(dir + "/data")
+	panicNotNil(err)
+
+	defer db.Close()
+
+	panicNotNil(db.NewTable("reindex_testing"))
+	table := db.Table("reindex_testing")
+	panicNotNil(table.NewIndex("City"))
+	panicNotNil(table.NewIndex("Likes"))
+	panicNotNil(table.NewIndex("Age", IndexOptions{Shards: 4}))
+
+	cities := []string{"Sydney", "Melbourne", "Brisbane", "Perth"}
+	for n := 0; n < 500; n++ {
+		panicNotNil(table.Set("person"+strconv.Itoa(n), Person{
+			Name:  "Person " + strconv.Itoa(n),
+			City:  cities[n%len(cities)],
+			Age:   n % 7,
+			Likes: []string{cities[n%3], cities[n%2]},
+		}))
+	}
+
+	for _, name := range table.Indexes() {
+		idx := table.Index(name)
+
+		panicNotNil(idx.Reindex(1))
+		serial := indexEntries(idx)
+		if len(serial) == 0 {
+			t.Fatal("index " + name + " should have entries, but doesn't")
+		}
+
+		panicNotNil(idx.Reindex(8))
+		parallel := indexEntries(idx)
+
+		if len(parallel) != len(serial) {
+			t.Fatal("parallel reindex of " + name + " should have " +
+				"the same number of entries, but doesn't")
+		}
+
+		for key, value := range serial {
+			if !bytes.Equal(parallel[key], value) {
+				t.Fatal("parallel reindex of " + name + " should have " +
+					"the same entries, but doesn't")
+			}
+		}
+	}
+
+	var results []Person
+	panicNotNil(table.Index("City").GetAll("Perth").All(&results))
+	if len(results) != 125 {
+		t.Fatal("length of results should be 125, but isn't")
+	}
+
+	for _, person := range results {
+		if person.City != "Perth" {
+			t.Fatal("person should be from Perth, but isn't")
+		}
+	}
+}
@@ -3,14 +3,20 @@ package jvzc
 import (
 	"bytes"
 	"errors"
+	"fmt"
+	"hash/fnv"
 	"log"
+	"math/rand"
 	"os"
 	"reflect"
-	"runtime/debug"
+	"sort"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/1lann/badger"
 	"github.com/1lann/msgpack"
+	"github.com/1lann/msgpack/codes"
 )
 
 // NewTable creates a new table in the database. You can optionally specify
@@ -28,7 +34,9 @@ func (d *DB) NewTable(name string, keyCompression ...bool) error {
 		useKeyCompression = keyCompression[0]
 	}
 
-	d.configMutex.Lock()
+	if err := d.lockConfig(); err != nil {
+		return err
+	}
 	defer d.configMutex.Unlock()
 
 	for _, table := range d.config.Tables {
@@ -50,11 +58,9 @@ func (d *DB) NewTable(name string, keyCompression ...bool) error {
 		return err
 	}
 
-	tb := &Table{
-		indexes: make(map[Name]*Index),
-		data:    kv,
-		db:      d,
-	}
+	tb := newTable(d, Name(name))
+	tb.data = kv
+	tb.dir = d.kvDir(Name(name))
 
 	if useKeyCompression {
 		tb.compressionLock = new(sync.RWMutex)
@@ -68,22 +74,132 @@ func (d *DB) NewTable(name string, keyCompression ...bool) error {
 	return nil
 }
 
-// Drop drops the table from the database.
-func (t *Table) Drop() error {
-	t.db.configMutex.Lock()
+func newTable(d *DB, name Name) *Table {
+	return &Table{
+		tableName:  name,
+		indexes:    make(map[Name]*Index),
+		db:         d,
+		keyLocks:   new([keyLockCount]sync.Mutex),
+		rangeMutex: new(sync.Mutex),
+
+		uniqueMutex: new(sync.Mutex),
+		changeMutex: new(sync.Mutex),
+
+		indexErrorsMutex: new(sync.Mutex),
+		indexErrors:      make(map[string]uint64),
+
+		listenerMutex: new(sync.RWMutex),
+		listeners:     make(map[int]func(key string)),
+
+		merges: newMerger(),
+	}
+}
+
+// DropPlan describes what would be deleted by dropping a table.
+type DropPlan struct {
+	// Dir is the directory which is removed when the table is dropped.
+	Dir string
+	// Documents is the number of documents in the table.
+	Documents int64
+	// Indexes is the names of the indexes of the table, sorted by name.
+	Indexes []string
+	// Counter is the greatest counter of the documents in the table, which
+	// changes whenever a document is written.
+	Counter uint64
+}
+
+// DropPlan returns what would be deleted by dropping the table, without
+// deleting anything, so that it can be confirmed before calling Drop. It
+// reads every document of the table.
+func (t *Table) DropPlan() (DropPlan, error) {
+	if err := t.db.lockConfig(); err != nil {
+		return DropPlan{}, err
+	}
 	defer t.db.configMutex.Unlock()
 
-	var tableName Name
-	for name, table := range t.db.tables {
-		if t == table {
-			tableName = name
+	if t.db.tables[t.tableName] != t {
+		return DropPlan{}, ErrNotFound
+	}
+
+	return t.dropPlan()
+}
+
+func (t *Table) dropPlan() (DropPlan, error) {
+	plan := DropPlan{
+		Dir:     t.db.path + "/" + t.tableName.Hex(),
+		Indexes: t.Indexes(),
+	}
+
+	r := t.All()
+	defer r.Close()
+
+	for r.Next() {
+		plan.Documents++
+		if r.Counter() > plan.Counter {
+			plan.Counter = r.Counter()
+		}
+	}
+
+	if r.Error() != ErrEndOfRange {
+		return DropPlan{}, r.Error()
+	}
+
+	return plan, nil
+}
+
+// equal returns whether the plans are the same.
+func (p DropPlan) equal(other DropPlan) bool {
+	if p.Dir != other.Dir || p.Documents != other.Documents ||
+		p.Counter != other.Counter || len(p.Indexes) != len(other.Indexes) {
+		return false
+	}
+
+	for i, index := range p.Indexes {
+		if other.Indexes[i] != index {
+			return false
 		}
 	}
 
-	if string(tableName) == "" {
+	return true
+}
+
+// Drop drops the table from the database. ErrInUse will be returned if
+// there are ranges over the table or its indexes which have not been closed
+// yet, as their underlying iterators would be closed from under them.
+//
+// You can optionally specify a plan returned by DropPlan, in which case
+// ErrTableChanged is returned without dropping the table if the table no
+// longer matches the plan, such as if a document was written since.
+func (t *Table) Drop(plan ...DropPlan) error {
+	if err := t.db.lockConfig(); err != nil {
+		return err
+	}
+	defer t.db.configMutex.Unlock()
+
+	tableName := t.tableName
+	if t.db.tables[tableName] != t {
 		return ErrNotFound
 	}
 
+	if len(plan) > 0 {
+		current, err := t.dropPlan()
+		if err != nil {
+			return err
+		}
+
+		if !current.equal(plan[0]) {
+			return ErrTableChanged
+		}
+	}
+
+	t.rangeMutex.Lock()
+	if t.openRanges > 0 {
+		t.rangeMutex.Unlock()
+		return ErrInUse
+	}
+	t.dropped = true
+	t.rangeMutex.Unlock()
+
 	// Remove table from configuration
 	for i, table := range t.db.config.Tables {
 		if table.TableName == string(tableName) {
@@ -94,6 +210,9 @@ func (t *Table) Drop() error {
 	}
 
 	if err := t.db.writeConfig(); err != nil {
+		t.rangeMutex.Lock()
+		t.dropped = false
+		t.rangeMutex.Unlock()
 		return err
 	}
 
@@ -103,74 +222,403 @@ func (t *Table) Drop() error {
 	}
 	t.data.Close()
 
+	if t.changes != nil {
+		t.changes.Close()
+	}
+
 	delete(t.db.tables, tableName)
 
 	return os.RemoveAll(t.db.path + "/" + tableName.Hex())
 }
 
+// MaxKeyLength is the maximum length of a primary key in bytes. The
+// underlying storage can only read back keys of up to 32767 bytes, and
+// primary keys are also stored with their sort keys in collated tables and
+// with index values in the entries of per key indexes, so the limit leaves
+// room for them. Writes to collated tables also return ErrBadIdentifier if
+// the key stored, including its sort key, is too long.
+const MaxKeyLength = 1 << 14
+
+// maxStoreKeyLength is the maximum length of a key of the underlying storage
+// which can be read back.
+const maxStoreKeyLength = 1<<15 - 1
+
+// validKey returns whether the key is a valid primary key. Primary keys may be
+// any non-empty sequence of bytes which is at most MaxKeyLength bytes long.
+func validKey(key string) bool {
+	return key != "" && len(key) <= MaxKeyLength
+}
+
+// validStoreKey returns whether the key a valid primary key is stored under
+// is short enough for the underlying storage, which only depends on the sort
+// key of collated tables.
+func (t *Table) validStoreKey(key string) bool {
+	return t.collation == nil || len(t.dataKey(key)) <= maxStoreKeyLength
+}
+
 // Get retrieves a value from a table with its primary key. dst must either be
 // a pointer or nil if you only want to get the counter or check for existence.
+// dst may point to a struct, or to a map[string]interface{} or interface{}
+// to read documents without knowing their type, in which case maps are
+// decoded as map[string]interface{}.
 func (t *Table) Get(key string, dst interface{}) (uint64, error) {
-	var item badger.KVItem
-	err := t.data.Get([]byte(key), &item)
+	itemValue, counter, err := t.getRaw(key)
 	if err != nil {
 		return 0, err
 	}
 
-	itemValue := getItemValue(&item)
-	if itemValue == nil {
-		return 0, ErrNotFound
+	if dst == nil {
+		return counter, nil
 	}
 
-	if dst == nil {
-		return item.Counter(), nil
+	return counter, unmarshal(t, itemValue, dst)
+}
+
+// GetExists retrieves a value from a table like Get, but returns whether the
+// document exists instead of returning ErrNotFound if it doesn't. Documents
+// written with Set are never empty, as even an empty struct is marshalled to
+// an empty msgpack map, but a document stored with an empty value, such as
+// in a store adopted with OpenExisting, would be reported as not found by
+// Get. GetExists reports such a document as found, along with ErrEmptyValue
+// if dst isn't nil, as there is no value to decode into it.
+func (t *Table) GetExists(key string, dst interface{}) (bool, uint64, error) {
+	counter, err := t.Get(key, dst)
+	if err == nil {
+		return true, counter, nil
+	} else if err != ErrNotFound {
+		return false, 0, err
 	}
 
-	if t.keyToCompressed != nil {
-		return item.Counter(), msgpack.UnmarshalCompressed(t.cToKey,
-			itemValue, dst)
+	if err := t.db.acquire(); err != nil {
+		return false, 0, err
+	}
+	defer t.db.release()
+
+	// Missing documents and empty values are both read as nil values, so
+	// empty values are found by whether their key exists.
+	var item badger.KVItem
+	if err := t.data.Get(t.dataKey(key), &item); err != nil {
+		return false, 0, err
+	}
+
+	if len(getItemValue(&item)) > 0 {
+		return false, 0, nil
+	}
+
+	found, err := t.data.Exists(t.dataKey(key))
+	if err != nil || !found {
+		return false, 0, err
+	}
+
+	if dst != nil {
+		return true, item.Counter(), ErrEmptyValue
+	}
+
+	return true, item.Counter(), nil
+}
+
+// GetMap retrieves the documents with the primary keys, and returns a map of
+// the keys which were found to their documents. Each document is decoded into
+// a new value of the same type as template, so passing Person{} returns
+// Person values, and passing &Person{} returns *Person values. Keys which
+// don't exist are left out of the map, rather than returning ErrNotFound.
+func (t *Table) GetMap(keys []string,
+	template interface{}) (map[string]interface{}, error) {
+	docType := reflect.TypeOf(template)
+	if docType == nil {
+		return nil, errors.New("jvzc: template must not be nil")
+	}
+
+	result := make(map[string]interface{}, len(keys))
+
+	for _, key := range keys {
+		itemValue, _, err := t.getRaw(key)
+		if err == ErrNotFound {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		doc := reflect.New(docType)
+		if err = unmarshal(t, itemValue, doc.Interface()); err != nil {
+			return nil, err
+		}
+
+		result[key] = doc.Elem().Interface()
+	}
+
+	return result, nil
+}
+
+// getRaw returns the marshalled document with the primary key, migrated to
+// the schema version of the table, and its counter.
+func (t *Table) getRaw(key string) ([]byte, uint64, error) {
+	if err := t.db.acquire(); err != nil {
+		return nil, 0, err
+	}
+	defer t.db.release()
+
+	if !validKey(key) {
+		return nil, 0, ErrBadIdentifier
+	}
+
+	atomic.AddUint64(&t.ops.Gets, 1)
+
+	var item badger.KVItem
+	err := t.data.Get(t.dataKey(key), &item)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	itemValue, meta, version, err := t.decodeValueVersion(getItemValue(&item))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if itemValue == nil {
+		return nil, 0, ErrNotFound
+	}
+
+	counter := item.Counter()
+
+	if version < t.schemaVersion() {
+		itemValue, err = t.migrate(itemValue, version)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		if t.migrationWriteBack {
+			counter, err = t.writeBackMigrated(key, itemValue, meta, counter)
+			if err != nil {
+				return nil, 0, err
+			}
+		}
 	}
 
-	return item.Counter(), msgpack.Unmarshal(itemValue, dst)
+	return itemValue, counter, nil
+}
+
+// keysRange returns a Range over the documents with the given primary keys,
+// in the order of the keys provided. Keys which no longer exist are skipped.
+func (t *Table) keysRange(keys []string, missing ...func(key string)) *Range {
+	c := 0
+	var value []byte
+	var item badger.KVItem
+
+	return newRange(func() (string, []byte, uint64, error) {
+		for {
+			if c >= len(keys) {
+				return "", nil, 0, ErrEndOfRange
+			}
+
+			err := t.data.Get(t.dataKey(keys[c]), &item)
+			if err != nil {
+				return "", nil, 0, err
+			}
+
+			itemValue, err := t.itemData(&item)
+			if err != nil {
+				return "", nil, 0, err
+			}
+
+			if itemValue == nil {
+				for _, fn := range missing {
+					fn(keys[c])
+				}
+
+				c++
+				continue
+			}
+
+			value = make([]byte, len(itemValue))
+			copy(value, itemValue)
+
+			c++
+			return keys[c-1], value, item.Counter(), nil
+		}
+	}, func() {}, t)
 }
 
 // Set sets a value in the table. An optional counter value can be provided
 // to only set the value if the counter value is the same. A counter value
-// of 0 is valid and represents a key that doesn't exist.
+// of 0 is valid and represents a key that doesn't exist, so the value is only
+// created. A non-zero counter value never creates a value, and
+// ErrCounterChanged is returned if the key doesn't exist.
+// ErrBadIdentifier will be returned if the key is empty or longer than
+// MaxKeyLength. ErrNilValue is returned if the value is nil or a nil pointer,
+// as a nil document couldn't be told apart from a deleted one; use Delete to
+// remove documents instead. If the value is written but the indexes of the
+// table fail to update, an error wrapping ErrIndexError is returned, and the
+// indexes may be stale.
 func (t *Table) Set(key string, value interface{}, counter ...uint64) error {
+	return t.set(key, value, false, counter...)
+}
+
+// Insert sets a value in the table only if the key doesn't already exist,
+// otherwise ErrAlreadyExists is returned. Like with Set with a counter of 0,
+// keys of deleted documents are considered to not exist, but an existing key
+// returns ErrAlreadyExists rather than ErrCounterChanged.
+func (t *Table) Insert(key string, value interface{}) error {
+	return t.set(key, value, true)
+}
+
+func (t *Table) set(key string, value interface{}, insert bool,
+	counter ...uint64) error {
+	if !validKey(key) {
+		return ErrBadIdentifier
+	}
+
+	data, err := t.marshal(value)
+	if err != nil {
+		return err
+	}
+
+	if isNilDocument(data) {
+		return ErrNilValue
+	}
+
+	return t.setData(key, data, insert, counter...)
+}
+
+// setData writes a marshalled document to the table, as described by Set and
+// Insert.
+func (t *Table) setData(key string, data []byte, insert bool,
+	counter ...uint64) error {
+	return t.writeData(key, data, insert, nil, counter...)
+}
+
+// writeData writes a marshalled document to the table like setData, and if
+// newCounter isn't nil, stores the counter of the document written in it.
+func (t *Table) writeData(key string, data []byte, insert bool,
+	newCounter *uint64, counter ...uint64) error {
+	if err := t.db.acquire(); err != nil {
+		return err
+	}
+	defer t.db.release()
+
+	if !t.validStoreKey(key) {
+		return ErrBadIdentifier
+	}
+
+	// Unconditional writes to tables without indexes (or which are being
+	// bulk loaded), metadata or a change log don't depend on the old
+	// document, so they skip reading it.
+	if !insert && len(counter) == 0 && !t.metadata && !t.changeLog &&
+		newCounter == nil && (len(t.indexes) == 0 || t.deferIndexes()) {
+		return t.setUnread(key, data)
+	}
+
+	for {
+		err := t.setRead(key, data, insert, newCounter, counter...)
+		if err != errSetRaced {
+			return err
+		}
+	}
+}
+
+// errSetRaced is returned by setRead if an unconditional write raced with
+// another write to the document, in which case the document is read again.
+var errSetRaced = errors.New("jvzc: document changed while being set")
+
+// setRead reads the document replaced by a write, and writes the marshalled
+// document only if the document read is still the one stored, so that the
+// index diff is computed against the document the write replaces. If
+// newCounter isn't nil, the counter of the document written is stored in it.
+func (t *Table) setRead(key string, data []byte, insert bool,
+	newCounter *uint64, counter ...uint64) error {
+	// Listeners are notified once the document is unlocked, as they may
+	// write to it.
+	var written bool
+	defer func() {
+		if written {
+			t.changed(ChangeSet, key)
+		}
+	}()
+	defer t.lockKey(key)()
+
+	if t.hasUniqueIndex() && !t.deferIndexes() {
+		t.uniqueMutex.Lock()
+		defer t.uniqueMutex.Unlock()
+	}
+
 	var item badger.KVItem
-	err := t.data.Get([]byte(key), &item)
+	err := t.data.Get(t.dataKey(key), &item)
 	if err != nil {
 		return err
 	}
 
+	itemValue := getItemValue(&item)
+
+	if insert && itemValue != nil {
+		return ErrAlreadyExists
+	}
+
 	if len(counter) > 0 {
-		if item.Counter() != counter[0] {
+		// Deleted keys keep the counter of their deletion, but are treated
+		// as keys that don't exist so that an update can't recreate them.
+		current := item.Counter()
+		if itemValue == nil {
+			current = 0
+		}
+
+		if current != counter[0] {
 			return ErrCounterChanged
 		}
 	}
 
-	var data []byte
-	if t.keyToCompressed != nil {
-		data, err = msgpack.MarshalCompressed(t.keyToC, value)
-	} else {
-		data, err = msgpack.Marshal(value)
+	stored, err := t.encodeValue(data, t.nextMeta(&item))
+	if err != nil {
+		return err
 	}
+
+	// The old document is only needed to update the indexes, so tables
+	// without indexes skip decoding it.
+	var old []byte
+	if len(t.indexes) > 0 && !t.deferIndexes() && itemValue != nil {
+		old, err = t.decodeValue(itemValue)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err = t.checkPredicates(); err != nil {
+		return err
+	}
+
+	additions, removals, diffErr := t.diffIndexes(key, old, data)
+	if err = t.checkUnique(key, additions); err != nil {
+		return err
+	}
+
+	done, err := t.journalWrite(key, item.Counter(), ChangeSet,
+		additions, removals)
 	if err != nil {
 		return err
 	}
+	defer done()
 
-	if len(counter) > 0 {
+	if insert {
+		err = t.data.SetIfAbsent(t.dataKey(key), stored, 0)
+		if err == badger.ErrKeyExists {
+			return ErrAlreadyExists
+		}
+	} else if len(counter) > 0 {
 		if counter[0] == 0 {
-			err = t.data.SetIfAbsent([]byte(key), data, 0)
+			err = t.data.SetIfAbsent(t.dataKey(key), stored, 0)
 		} else {
-			err = t.data.CompareAndSet([]byte(key), data, counter[0])
+			err = t.data.CompareAndSet(t.dataKey(key), stored, counter[0])
 		}
+	} else if item.Counter() == 0 {
+		err = t.data.SetIfAbsent(t.dataKey(key), stored, 0)
 	} else {
-		err = t.data.Set([]byte(key), data, 0)
+		err = t.data.CompareAndSet(t.dataKey(key), stored, item.Counter())
 	}
 
 	if err == badger.ErrCasMismatch || err == badger.ErrKeyExists {
+		if !insert && len(counter) == 0 {
+			return errSetRaced
+		}
+
 		return ErrCounterChanged
 	}
 
@@ -178,119 +626,759 @@ func (t *Table) Set(key string, value interface{}, counter ...uint64) error {
 		return err
 	}
 
-	t.updateIndex(key, getItemValue(&item), data)
+	err = t.applyIndexDiffs(key, additions, removals, false)
+	written = true
 
-	return nil
+	if newCounter != nil {
+		// The document is still locked, so it is the one written.
+		var stored badger.KVItem
+		if getErr := t.data.Get(t.dataKey(key), &stored); getErr != nil {
+			return getErr
+		}
+
+		*newCounter = stored.Counter()
+	}
+
+	if err == nil {
+		err = diffErr
+	}
+
+	return err
 }
 
-type diffEntry struct {
-	indexName string
-	indexKey  []byte
+// setUnread unconditionally writes a marshalled document without updating
+// indexes, and without reading the document it replaces.
+func (t *Table) setUnread(key string, data []byte) error {
+	stored, err := t.encodeValue(data, Meta{})
+	if err != nil {
+		return err
+	}
+
+	// The document is locked so that conditional writes of it, which check
+	// its counter while it is locked, aren't raced.
+	unlock := t.lockKey(key)
+	err = t.data.Set(t.dataKey(key), stored, 0)
+	unlock()
+
+	if err != nil {
+		return err
+	}
+
+	t.changed(ChangeSet, key)
+	return nil
 }
 
-func (t *Table) diffIndexes(old, new []byte) ([]diffEntry, []diffEntry) {
-	var removals []diffEntry
-	var additions []diffEntry
+// CompareAndSetMulti writes the values of writes, a map of primary keys to
+// values, only if the counter of every key in expected is still the counter
+// given for it, so that several documents can be updated only if none of
+// them changed since they were read. Like with Set, a counter of 0 expects
+// the document to not exist. Keys may be in expected without being written,
+// to also check documents which were read but aren't changed, and keys which
+// are written without being in expected are written whatever their counter.
+//
+// The counters are checked and the documents written while the documents
+// are locked, and the documents are written in a single batch. If a counter
+// doesn't match, nothing is written, and an error wrapping ErrCounterChanged
+// which names the first key that doesn't match is returned. Use errors.Is to
+// check for it. Documents imported with ImportFrom or RestoreBackup aren't
+// locked, so if they're written concurrently to the same keys, those keys
+// fail to be written with ErrCounterChanged while the other documents of the
+// batch are still written, and have their indexes updated.
+func (t *Table) CompareAndSetMulti(writes map[string]interface{},
+	expected map[string]uint64) error {
+	if err := t.db.acquire(); err != nil {
+		return err
+	}
+	defer t.db.release()
 
-	for indexName, index := range t.indexes {
-		oldRawValues, _ := index.indexQuery(old, string(indexName))
-		newRawValues, _ := index.indexQuery(new, string(indexName))
+	keys := make([]string, 0, len(writes)+len(expected))
+	data := make(map[string][]byte, len(writes))
+	for key, value := range writes {
+		if !validKey(key) || !t.validStoreKey(key) {
+			return ErrBadIdentifier
+		}
 
-		if oldRawValues == nil || len(old) == 0 {
-			oldRawValues = []interface{}{}
+		marshalled, err := t.marshal(value)
+		if err != nil {
+			return err
 		}
 
-		if newRawValues == nil || len(new) == 0 {
-			newRawValues = []interface{}{}
+		if isNilDocument(marshalled) {
+			return ErrNilValue
 		}
 
-		oldValues := make([][]byte, len(oldRawValues))
-		newValues := make([][]byte, len(newRawValues))
+		keys = append(keys, key)
+		data[key] = marshalled
+	}
 
-		for i, oldRawValue := range oldRawValues {
-			oldValues[i] = valueToBytes(oldRawValue)
+	for key := range expected {
+		if !validKey(key) {
+			return ErrBadIdentifier
 		}
 
-		for i, newRawValue := range newRawValues {
-			newValues[i] = valueToBytes(newRawValue)
+		if _, found := data[key]; !found {
+			keys = append(keys, key)
 		}
+	}
 
-		additions = append(additions, getOneWayDiffs(string(indexName),
-			newValues, oldValues)...)
+	sort.Strings(keys)
 
-		removals = append(removals, getOneWayDiffs(string(indexName),
-			oldValues, newValues)...)
-	}
+	// Listeners are notified once the documents are unlocked, as they may
+	// write to them.
+	var written []string
+	defer func() {
+		for _, key := range written {
+			t.changed(ChangeSet, key)
+		}
+	}()
+	defer t.lockKeys(keys)()
 
-	return additions, removals
-}
+	if t.hasUniqueIndex() && !t.deferIndexes() {
+		t.uniqueMutex.Lock()
+		defer t.uniqueMutex.Unlock()
+	}
 
-func getOneWayDiffs(indexName string, a, b [][]byte) []diffEntry {
-	var results []diffEntry
+	if err := t.checkPredicates(); err != nil {
+		return err
+	}
 
-	for _, aa := range a {
-		found := false
-		for _, bb := range b {
-			if bytes.Equal(bb, aa) {
-				found = true
-				break
-			}
+	items := make(map[string]*badger.KVItem, len(keys))
+	for _, key := range keys {
+		item := new(badger.KVItem)
+		if err := t.data.Get(t.dataKey(key), item); err != nil {
+			return err
 		}
+		items[key] = item
 
+		counter, found := expected[key]
 		if !found {
-			results = append(results, diffEntry{indexName, aa})
+			continue
+		}
+
+		// Deleted keys keep the counter of their deletion, but are treated
+		// as keys that don't exist like with Set.
+		current := item.Counter()
+		if getItemValue(item) == nil {
+			current = 0
+		}
+
+		if current != counter {
+			return fmt.Errorf("%w: %s", ErrCounterChanged, key)
 		}
 	}
 
-	return results
-}
+	var entries []*badger.Entry
+	var entryKeys []string
+	var diffs [][2][]diffEntry
+	var indexErr error
 
-func (t *Table) updateIndex(key string, old, new []byte) error {
-	additions, removals := t.diffIndexes(old, new)
+	// The unique index values added by the batch, as they aren't in the
+	// indexes until the batch is written.
+	added := make(map[string]string)
 
-	var lastError error
+	for _, key := range keys {
+		if _, found := data[key]; !found {
+			continue
+		}
 
-	for _, removal := range removals {
-		err := t.Index(removal.indexName).deleteFromIndex(removal.indexKey, key)
+		item := items[key]
+		old, err := t.itemData(item)
 		if err != nil {
-			log.Println("jvzc: error while updating index \""+
-				removal.indexName+"\", index likely corrupt:", err)
-			lastError = err
+			return err
 		}
-	}
 
-	for _, addition := range additions {
-		err := t.Index(addition.indexName).addToIndex(addition.indexKey, key)
+		stored, err := t.encodeValue(data[key], t.nextMeta(item))
 		if err != nil {
-			log.Println("jvzc: error while updating index \""+
-				addition.indexName+"\", index likely corrupt:", err)
-			lastError = err
+			return err
 		}
-	}
+
+		additions, removals, diffErr := t.diffIndexes(key, old, data[key])
+		keepIndexError(&indexErr, diffErr)
+
+		if err := t.checkUnique(key, additions); err != nil {
+			return err
+		}
+
+		for _, addition := range additions {
+			index := t.indexes[Name(addition.IndexName)]
+			if !index.unique {
+				continue
+			}
+
+			value := addition.IndexName + "\x00" + string(addition.IndexKey)
+			if other, found := added[value]; found && other != key {
+				return fmt.Errorf("%w: %s", ErrNotUnique, index.name())
+			}
+
+			added[value] = key
+		}
+
+		done, err := t.journalWrite(key, item.Counter(), ChangeSet,
+			additions, removals)
+		if err != nil {
+			return err
+		}
+		defer done()
+
+		entries = append(entries, &badger.Entry{
+			Key:             t.dataKey(key),
+			Value:           stored,
+			CASCounterCheck: item.Counter(),
+		})
+		entryKeys = append(entryKeys, key)
+		diffs = append(diffs, [2][]diffEntry{additions, removals})
+	}
+
+	if len(entries) == 0 {
+		return nil
+	}
+
+	if err := t.data.BatchSet(entries); err != nil {
+		return err
+	}
+
+	// Each entry of the batch is checked and written separately, so every
+	// entry which was written has its indexes updated, even if an entry
+	// before it failed.
+	var entryErr error
+	for i, entry := range entries {
+		if entry.Error != nil {
+			if entryErr != nil {
+				continue
+			}
+
+			entryErr = entry.Error
+			if entry.Error == badger.ErrCasMismatch {
+				entryErr = fmt.Errorf("%w: %s", ErrCounterChanged,
+					entryKeys[i])
+			}
+
+			continue
+		}
+
+		keepIndexError(&indexErr, t.applyIndexDiffs(entryKeys[i],
+			diffs[i][0], diffs[i][1], false))
+		written = append(written, entryKeys[i])
+	}
+
+	if entryErr != nil {
+		return entryErr
+	}
+
+	return indexErr
+}
+
+// SetIfChanged sets a value in the table only if it differs from the value
+// currently stored, and returns whether the value was written. If the
+// marshalled value is identical, the write and index updates are skipped.
+// Note that the keys of maps are marshalled in a random order, so values
+// containing maps with more than one key may be written even if unchanged.
+func (t *Table) SetIfChanged(key string, value interface{}) (bool, error) {
+	if err := t.db.acquire(); err != nil {
+		return false, err
+	}
+	defer t.db.release()
+
+	if !validKey(key) {
+		return false, ErrBadIdentifier
+	}
+
+	data, err := t.marshal(value)
+	if err != nil {
+		return false, err
+	}
+
+	for {
+		var item badger.KVItem
+		if err := t.data.Get(t.dataKey(key), &item); err != nil {
+			return false, err
+		}
+
+		old, err := t.itemData(&item)
+		if err != nil {
+			return false, err
+		}
+
+		if old != nil && bytes.Equal(old, data) {
+			return false, nil
+		}
+
+		err = t.Set(key, value, item.Counter())
+		if err == ErrCounterChanged {
+			continue
+		} else if errors.Is(err, ErrIndexError) {
+			return true, err
+		} else if err != nil {
+			return false, err
+		}
+
+		return true, nil
+	}
+}
+
+// SetKeyFunc sets the function used by Put to derive the primary key of a
+// document from the document itself, such as a hash of its contents. The key
+// function is not persisted, and must be set every time the database is
+// opened.
+func (t *Table) SetKeyFunc(fn func(value interface{}) (string, error)) {
+	t.keyFunc = fn
+}
+
+// Put sets a value in the table under the primary key computed by the key
+// function set with SetKeyFunc, and returns the key. ErrBadIdentifier will be
+// returned if the key function returns an invalid key.
+func (t *Table) Put(value interface{}) (string, error) {
+	if t.keyFunc == nil {
+		return "", errors.New("jvzc: no key function set")
+	}
+
+	key, err := t.keyFunc(value)
+	if err != nil {
+		return "", err
+	}
+
+	if !validKey(key) {
+		return "", ErrBadIdentifier
+	}
+
+	return key, t.Set(key, value)
+}
+
+// isNilDocument returns whether a marshalled document is nil.
+func isNilDocument(data []byte) bool {
+	return len(data) == 1 && data[0] == codes.Nil
+}
+
+// marshal marshals a value with the key compression or array encoding of the
+// table.
+func (t *Table) marshal(value interface{}) ([]byte, error) {
+	if t.keyToCompressed != nil {
+		return msgpack.MarshalCompressed(t.keyToC, value)
+	}
+
+	if t.arrayEncoding {
+		var buf bytes.Buffer
+		err := msgpack.NewEncoder(&buf).StructAsArray(true).Encode(value)
+		return buf.Bytes(), err
+	}
+
+	return msgpack.Marshal(value)
+}
+
+type diffEntry struct {
+	IndexName string
+	IndexKey  []byte
+	// Projection is the projection of the document stored with additions
+	// to covering indexes.
+	Projection []byte
+}
+
+// diffIndexes returns the index entries which must be added and removed when
+// a document changes from old to new. Writes are rejected by checkPredicates
+// before they are diffed if a partial index has no predicate, but if its
+// predicate is removed in between, it can't be updated, which is reported as
+// a warning and returned as an error wrapping ErrIndexError, without
+// stopping the other indexes from updating.
+func (t *Table) diffIndexes(key string, old, new []byte) ([]diffEntry,
+	[]diffEntry, error) {
+	if len(t.indexes) == 0 || t.deferIndexes() {
+		return nil, nil, nil
+	}
+
+	var removals []diffEntry
+	var additions []diffEntry
+	var lastError error
+
+	for indexName, index := range t.indexes {
+		if index.partial && index.getPredicate() == nil {
+			t.db.warn(Warning{
+				Code: IndexUpdateFailed,
+				Name: t.name() + "/" + string(indexName),
+				Err:  errNoPredicate,
+			})
+			t.addIndexError(string(indexName))
+			lastError = fmt.Errorf("%w: %s/%s: %w", ErrIndexError, t.name(),
+				indexName, errNoPredicate)
+			continue
+		}
+
+		// The old document was reported when it was written if it couldn't
+		// be queried, in which case it has no index entries to remove.
+		oldValues, _ := index.valuesOf(old)
+		newValues, err := index.valuesOf(new)
+		if err != nil {
+			t.db.warn(Warning{
+				Code: UnindexableDocument,
+				Name: t.name() + "/" + string(indexName),
+				Key:  key,
+				Err:  err,
+			})
+			t.addIndexError(string(indexName))
+			lastError = fmt.Errorf("%w: %s/%s: %w", ErrIndexError, t.name(),
+				indexName, err)
+		}
+
+		if len(index.project) > 0 {
+			indexAdditions, err := index.projectedAdditions(old, new,
+				oldValues, newValues)
+			if err != nil {
+				t.addIndexError(string(indexName))
+				lastError = fmt.Errorf("%w: %s/%s: %w", ErrIndexError, t.name(),
+					indexName, err)
+			}
+
+			additions = append(additions, indexAdditions...)
+		} else {
+			additions = append(additions, getOneWayDiffs(string(indexName),
+				newValues, oldValues)...)
+		}
+
+		removals = append(removals, getOneWayDiffs(string(indexName),
+			oldValues, newValues)...)
+	}
+
+	return additions, removals, lastError
+}
+
+// valuesOf returns the unique index keys of the document under the index. No
+// keys are returned if the document is empty or doesn't match the predicate of
+// a partial index, which must be set. An error is returned if the document
+// isn't a map, as its fields can't be queried.
+func (i *Index) valuesOf(data []byte) ([][]byte, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+
+	if i.partial {
+		predicate := i.getPredicate()
+		if predicate == nil || !predicate(Document{data, i.table}) {
+			return nil, nil
+		}
+	}
+
+	rawValues, err := i.indexQuery(data, i.query)
+	if err != nil && !isMapDocument(data) {
+		return nil, err
+	}
+
+	values := make([][]byte, len(rawValues))
+	for j, rawValue := range rawValues {
+		values[j] = valueToBytes(rawValue)
+	}
+
+	// Multi-value fields may contain the same element more than once,
+	// which must only be added to or removed from the index once.
+	return uniqueValues(values), nil
+}
+
+// isMapDocument returns whether a marshalled document is a map. Queries of
+// fields of maps only fail if the field has a different type than queried,
+// such as a wildcard query of a nil slice, which has no values.
+func isMapDocument(data []byte) bool {
+	return codes.IsFixedMap(data[0]) || data[0] == codes.Map16 ||
+		data[0] == codes.Map32
+}
+
+func uniqueValues(values [][]byte) [][]byte {
+	var results [][]byte
+
+	for _, value := range values {
+		found := false
+		for _, result := range results {
+			if bytes.Equal(result, value) {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			results = append(results, value)
+		}
+	}
+
+	return results
+}
+
+func getOneWayDiffs(indexName string, a, b [][]byte) []diffEntry {
+	var results []diffEntry
+
+	for _, aa := range a {
+		found := false
+		for _, bb := range b {
+			if bytes.Equal(bb, aa) {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			results = append(results, diffEntry{IndexName: indexName, IndexKey: aa})
+		}
+	}
+
+	return results
+}
+
+// applyIndexDiffs adds and removes the key from the indexes of the table,
+// after the document with the key was written. Failures are reported as
+// warnings, and the last one is returned wrapped with ErrIndexError. If
+// replay is true, the diffs may have already been partially applied, so
+// removals of keys which are not in the index are skipped.
+func (t *Table) applyIndexDiffs(key string, additions, removals []diffEntry,
+	replay bool) error {
+	var lastError error
+
+	for _, removal := range removals {
+		index := t.Index(removal.IndexName)
+		if replay && (index == nil || !index.hasKey(removal.IndexKey, key)) {
+			continue
+		}
+
+		err := index.deleteFromIndex(removal.IndexKey, key)
+		if err != nil {
+			t.db.warn(Warning{
+				Code: IndexUpdateFailed,
+				Name: t.name() + "/" + removal.IndexName,
+				Key:  key,
+				Err:  err,
+			})
+			t.addIndexError(removal.IndexName)
+			lastError = fmt.Errorf("%w: %s/%s: %w", ErrIndexError, t.name(),
+				removal.IndexName, err)
+		}
+	}
+
+	for _, addition := range additions {
+		index := t.Index(addition.IndexName)
+		if replay && index == nil {
+			continue
+		}
+
+		err := index.addToIndex(addition.IndexKey, key, addition.Projection)
+		if err != nil {
+			t.db.warn(Warning{
+				Code: IndexUpdateFailed,
+				Name: t.name() + "/" + addition.IndexName,
+				Key:  key,
+				Err:  err,
+			})
+			t.addIndexError(addition.IndexName)
+			lastError = fmt.Errorf("%w: %s/%s: %w", ErrIndexError, t.name(),
+				addition.IndexName, err)
+		}
+	}
 
 	return lastError
 }
 
+// hasUniqueIndex returns whether the table has an index with the Unique
+// option.
+func (t *Table) hasUniqueIndex() bool {
+	for _, index := range t.indexes {
+		if index.unique {
+			return true
+		}
+	}
+
+	return false
+}
+
+// checkUnique returns an error wrapping ErrNotUnique if a document other than
+// the document with the primary key has an index value which is being added
+// to a unique index.
+func (t *Table) checkUnique(key string, additions []diffEntry) error {
+	for _, addition := range additions {
+		index := t.indexes[Name(addition.IndexName)]
+		if !index.unique {
+			continue
+		}
+
+		keys, err := index.getKeys(addition.IndexKey)
+		if err != nil {
+			return err
+		}
+
+		for _, other := range keys {
+			if other == key {
+				continue
+			}
+
+			// Stale entries of documents which no longer have the value
+			// don't count.
+			data, err := t.getData(other)
+			if err != nil {
+				return err
+			}
+
+			values, _ := index.valuesOf(data)
+			if containsValue(values, addition.IndexKey) {
+				return fmt.Errorf("%w: %s", ErrNotUnique, index.name())
+			}
+		}
+	}
+
+	return nil
+}
+
+// keyLockCount is the number of locks shared by the primary keys of a table.
+const keyLockCount = 64
+
+// lockKey locks the writes of the document with the primary key, and returns
+// the function to unlock them. Without it, the index updates of concurrent
+// writes to a document could be applied in a different order than the writes,
+// leaving the index with the values of a replaced document.
+func (t *Table) lockKey(key string) func() {
+	lock := &t.keyLocks[keyLockOf(key)]
+	lock.Lock()
+
+	return lock.Unlock
+}
+
+// lockKeys locks the writes of the documents with the primary keys like
+// lockKey. The locks are taken in order, so that concurrent calls with the
+// same keys can't deadlock.
+func (t *Table) lockKeys(keys []string) func() {
+	var locked [keyLockCount]bool
+	for _, key := range keys {
+		locked[keyLockOf(key)] = true
+	}
+
+	for i := range locked {
+		if locked[i] {
+			t.keyLocks[i].Lock()
+		}
+	}
+
+	return func() {
+		for i := range locked {
+			if locked[i] {
+				t.keyLocks[i].Unlock()
+			}
+		}
+	}
+}
+
+// keyLockOf returns the lock shared by the primary key.
+func keyLockOf(key string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+
+	return h.Sum32() % keyLockCount
+}
+
+func (t *Table) addIndexError(indexName string) {
+	t.indexErrorsMutex.Lock()
+	t.indexErrors[indexName]++
+	t.indexErrorsMutex.Unlock()
+}
+
+// IndexErrorCount returns the number of times each index of the table has
+// failed to be updated after a document was written or deleted since the
+// database was opened. Indexes which have never failed are not included.
+// A growing count indicates that an index is likely corrupt.
+func (t *Table) IndexErrorCount() map[string]uint64 {
+	t.indexErrorsMutex.Lock()
+	defer t.indexErrorsMutex.Unlock()
+
+	counts := make(map[string]uint64, len(t.indexErrors))
+	for name, count := range t.indexErrors {
+		counts[name] = count
+	}
+
+	return counts
+}
+
+// OpCounts is the number of operations on a table since the database was
+// opened, as returned by Table.OpCounts.
+type OpCounts struct {
+	// Gets is the number of documents read by their key, such as with Get
+	// and Update, including reads of documents which don't exist.
+	Gets uint64
+	// Sets is the number of documents written.
+	Sets uint64
+	// Deletes is the number of documents deleted.
+	Deletes uint64
+	// Ranges is the number of ranges over the table and its indexes which
+	// have been created, such as with Between, All, GetAll, Page and Query.
+	Ranges uint64
+}
+
+// OpCounts returns the number of operations on the table since the database
+// was opened, such as to see how traffic is distributed across tables.
+// Only operations which succeeded are counted, except for gets and ranges.
+func (t *Table) OpCounts() OpCounts {
+	return OpCounts{
+		Gets:    atomic.LoadUint64(&t.ops.Gets),
+		Sets:    atomic.LoadUint64(&t.ops.Sets),
+		Deletes: atomic.LoadUint64(&t.ops.Deletes),
+		Ranges:  atomic.LoadUint64(&t.ops.Ranges),
+	}
+}
+
+// SetRepairHandler sets a function which is called when an index of the
+// table is found to be corrupt while it is being updated, with the name of
+// the index, the index value which is corrupt (encoded as a key of the
+// index), and the primary key of the document being written. By default,
+// corruption is only reported as a CorruptIndex warning and the update
+// continues. The handler is called during the write, so it should only queue
+// a repair such as reindexing the documents with the value, rather than
+// writing to the table itself.
+func (t *Table) SetRepairHandler(handler func(index string, indexKey []byte,
+	key string)) {
+	t.repairHandler = handler
+}
+
+// corrupt reports that the entry of the index for the index key and primary
+// key is corrupt.
+func (i *Index) corrupt(indexKey []byte, key string) {
+	i.table.db.warn(Warning{Code: CorruptIndex, Name: i.name(), Key: key})
+
+	if handler := i.table.repairHandler; handler != nil {
+		handler(string(i.indexName), indexKey, key)
+	}
+}
+
 func (i *Index) deleteFromIndex(indexKey []byte, key string) error {
+	found, err := i.removeFromIndex(indexKey, key)
+	if err == nil && !found {
+		i.corrupt(indexKey, key)
+	}
+
+	return err
+}
+
+// removeFromIndex removes the primary key from the index key, and returns
+// whether it was found. Lists of primary keys which can't be decoded are
+// reported as corrupt.
+func (i *Index) removeFromIndex(indexKey []byte, key string) (bool, error) {
 	var item badger.KVItem
+	entryKey := i.entryKey(indexKey, key)
+
+	if i.perKey {
+		exists, err := i.index.Exists(entryKey)
+		if err != nil || !exists {
+			return exists, err
+		}
+
+		return true, i.index.Delete(entryKey)
+	}
 
 	for {
-		err := i.index.Get(indexKey, &item)
+		err := i.index.Get(entryKey, &item)
 		if err != nil {
-			return err
+			return false, err
 		}
 
 		itemValue := getItemValue(&item)
 		if itemValue == nil {
-			log.Println("jvzc: warning: corrupt index detected:", i.name())
-			return nil
+			return false, nil
 		}
 
 		var list []string
 		err = msgpack.Unmarshal(itemValue, &list)
 		if err != nil {
-			log.Println("jvzc: warning: corrupt index detected:", i.name())
-			return err
+			i.corrupt(indexKey, key)
+			return false, err
 		}
 
 		found := false
@@ -304,126 +1392,398 @@ func (i *Index) deleteFromIndex(indexKey []byte, key string) error {
 		}
 
 		if !found {
-			log.Println("jvzc: warning: corrupt index detected:", i.name())
-			return nil
+			return false, nil
 		}
 
 		if len(list) == 0 {
-			err = i.index.CompareAndDelete(indexKey, item.Counter())
+			err = i.index.CompareAndDelete(entryKey, item.Counter())
 			if err == badger.ErrCasMismatch {
 				continue
 			}
 
-			return err
+			return true, err
+		}
+
+		data, err := msgpack.Marshal(list)
+		if err != nil {
+			log.Fatal("jvzc: marshal should never fail: ", err)
+		}
+
+		err = i.index.CompareAndSet(entryKey, data, item.Counter())
+		if err == badger.ErrCasMismatch {
+			continue
+		}
+
+		return true, err
+	}
+}
+
+// addToIndex adds the primary key to the index key. The projection of the
+// document is stored with the key if the index is a covering index.
+func (i *Index) addToIndex(indexKey []byte, key string,
+	projection []byte) error {
+	var item badger.KVItem
+	entryKey := i.entryKey(indexKey, key)
+
+	if i.perKey {
+		// The entry is stored as a list of one key, so that it can be read
+		// in the same way as the lists of other indexes. The projection of
+		// a covering index follows the list, which is ignored when the list
+		// is decoded.
+		data, err := msgpack.Marshal([]string{key})
+		if err != nil {
+			log.Fatal("jvzc: marshal should never fail: ", err)
+		}
+
+		return i.index.Set(entryKey, append(data, projection...), 0)
+	}
+
+	for {
+		err := i.index.Get(entryKey, &item)
+		if err != nil {
+			return err
+		}
+
+		var list []string
+
+		itemValue := getItemValue(&item)
+		if itemValue != nil {
+			err = msgpack.Unmarshal(itemValue, &list)
+			if err != nil {
+				i.corrupt(indexKey, key)
+				return err
+			}
+		}
+
+		for _, item := range list {
+			// Already exists, no need to add.
+			if item == key {
+				return nil
+			}
+		}
+
+		list = append(list, key)
+
+		data, err := msgpack.Marshal(list)
+		if err != nil {
+			log.Fatal("jvzc: marshal should never fail: ", err)
+		}
+
+		if itemValue == nil {
+			err = i.index.SetIfAbsent(entryKey, data, 0)
+			if err == badger.ErrKeyExists {
+				continue
+			}
+		} else {
+			err = i.index.CompareAndSet(entryKey, data, item.Counter())
+			if err == badger.ErrCasMismatch {
+				continue
+			}
+		}
+
+		return err
+	}
+}
+
+// name returns the name of the index in the form "table/index".
+func (i *Index) name() string {
+	return i.table.name() + "/" + string(i.indexName)
+}
+
+// Delete deletes the key from the table. An optional counter value can be
+// provided to only delete the document if the counter value is the same.
+// Like with Set, an error wrapping ErrIndexError is returned if the document
+// is deleted but the indexes of the table fail to update.
+func (t *Table) Delete(key string, counter ...uint64) error {
+	if err := t.db.acquire(); err != nil {
+		return err
+	}
+	defer t.db.release()
+
+	if !validKey(key) {
+		return ErrBadIdentifier
+	}
+
+	var deleted bool
+	defer func() {
+		if deleted {
+			t.changed(ChangeDelete, key)
+		}
+	}()
+	defer t.lockKey(key)()
+
+	var item badger.KVItem
+	err := t.data.Get(t.dataKey(key), &item)
+	if err != nil {
+		return err
+	}
+
+	itemValue, err := t.itemData(&item)
+	if err != nil {
+		return err
+	}
+
+	if itemValue == nil {
+		return nil
+	}
+
+	if len(counter) > 0 && item.Counter() != counter[0] {
+		return ErrCounterChanged
+	}
+
+	if err = t.checkPredicates(); err != nil {
+		return err
+	}
+
+	additions, removals, diffErr := t.diffIndexes(key, itemValue, nil)
+	done, err := t.journalWrite(key, item.Counter(), ChangeDelete,
+		additions, removals)
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	if len(counter) > 0 {
+		err = t.data.CompareAndDelete(t.dataKey(key), counter[0])
+	} else {
+		err = t.data.Delete(t.dataKey(key))
+	}
+
+	if err == badger.ErrCasMismatch {
+		return ErrCounterChanged
+	}
+
+	if err != nil {
+		return err
+	}
+
+	err = t.applyIndexDiffs(key, additions, removals, false)
+	deleted = true
+
+	if err == nil {
+		err = diffErr
+	}
+
+	return err
+}
+
+// Move moves the document with oldKey to newKey, updating the indexes of the
+// table. ErrAlreadyExists is returned if newKey already exists, unless
+// overwrite is specified as true, in which case its document is replaced.
+// ErrNotFound is returned if oldKey doesn't exist.
+//
+// The document is written under newKey before oldKey is deleted, so the
+// document may briefly be read under both keys. If the document changes
+// during the move, its latest version replaces the copy under newKey. If
+// another document is written under newKey meanwhile, it isn't overwritten
+// unless overwrite is specified, and ErrAlreadyExists is returned with the
+// document kept under oldKey. If it is deleted during the
+// move, the copy under newKey is kept and ErrNotFound is returned. Like with
+// Set, an error wrapping ErrIndexError is returned if the document is moved
+// but the indexes of the table fail to update.
+func (t *Table) Move(oldKey, newKey string, overwrite ...bool) error {
+	if !validKey(oldKey) || !validKey(newKey) {
+		return ErrBadIdentifier
+	}
+
+	if oldKey == newKey {
+		_, _, err := t.getRaw(oldKey)
+		return err
+	}
+
+	insert := len(overwrite) == 0 || !overwrite[0]
+	var indexErr error
+	var copied uint64
+
+	for {
+		data, counter, err := t.getRaw(oldKey)
+		if err != nil {
+			return err
+		}
+
+		if copied == 0 {
+			err = t.writeData(newKey, data, insert, &copied)
+		} else {
+			// The copy is only replaced if it is still the one this move
+			// wrote, so that a document written under newKey meanwhile
+			// isn't overwritten.
+			err = t.writeData(newKey, data, false, &copied, copied)
+			if err == ErrCounterChanged && insert {
+				return ErrAlreadyExists
+			} else if err == ErrCounterChanged {
+				err = t.writeData(newKey, data, false, &copied)
+			}
+		}
+
+		if err = keepIndexError(&indexErr, err); err != nil {
+			return err
+		}
+
+		err = t.Delete(oldKey, counter)
+		if err == ErrCounterChanged {
+			// The document changed since it was copied, so its latest
+			// version replaces the copy.
+			continue
+		}
+
+		if err = keepIndexError(&indexErr, err); err != nil {
+			return err
+		}
+
+		return indexErr
+	}
+}
+
+// deleteBatchSize is the number of documents deleted in a single batch by
+// DeleteRange.
+const deleteBatchSize = 1000
+
+// DeleteRange deletes every document whose key is within the given inclusive
+// bounds, and returns the number of documents deleted. Lower and upper must
+// be strings or Bounds, like with Between. Documents are deleted in batches,
+// and the indexes of the table are updated as each document is deleted. Like
+// with Delete, an error wrapping ErrIndexError is returned if documents are
+// deleted but the indexes of the table fail to update.
+func (t *Table) DeleteRange(lower, upper interface{}) (int, error) {
+	return t.deleteRange(lower, upper, false)
+}
+
+// deleteRange deletes the documents within the bounds, excluding the document
+// with the upper key if exclusive is set.
+func (t *Table) deleteRange(lower, upper interface{},
+	exclusive bool) (int, error) {
+	var deleted int
+	var indexErr error
+
+	for {
+		r := t.Between(lower, upper)
+		var keys []string
+		for len(keys) < deleteBatchSize && r.Next() {
+			if exclusive && r.Key() == upper {
+				break
+			}
+
+			keys = append(keys, r.Key())
 		}
+		r.Close()
 
-		data, err := msgpack.Marshal(list)
-		if err != nil {
-			log.Fatal("jvzc: marshal should never fail: ", err)
+		if r.Error() != nil && r.Error() != ErrEndOfRange {
+			return deleted, r.Error()
 		}
 
-		err = i.index.CompareAndSet(indexKey, data, item.Counter())
-		if err == badger.ErrCasMismatch {
-			continue
+		if len(keys) == 0 {
+			return deleted, indexErr
 		}
 
-		return err
+		if err := t.deleteBatch(keys, &indexErr); err != nil {
+			return deleted, err
+		}
+
+		deleted += len(keys)
 	}
 }
 
-func (i *Index) addToIndex(indexKey []byte, key string) error {
-	var item badger.KVItem
+// DeleteWhere deletes every document for which the predicate returns true,
+// and returns the number of documents deleted. The predicate is called with
+// the key and msgpack value of each document, like those of RawRange. The
+// table is scanned in batches, and the matching documents of each batch are
+// deleted like with DeleteRange before the scan continues, so the predicate
+// may be called more than once for a document which isn't deleted. If the
+// predicate returns an error, the scan stops and the error is returned
+// along with the number of documents already deleted.
+func (t *Table) DeleteWhere(predicate func(key string,
+	raw []byte) (bool, error)) (int, error) {
+	var deleted int
+	var indexErr error
+	var lower interface{} = MinValue
 
 	for {
-		err := i.index.Get(indexKey, &item)
-		if err != nil {
-			return err
-		}
+		r := t.Between(lower, MaxValue)
+		var keys []string
+		var last string
+		for len(keys) < deleteBatchSize && r.Next() {
+			if r.Key() == lower {
+				continue
+			}
 
-		var list []string
+			last = r.Key()
 
-		itemValue := getItemValue(&item)
-		if itemValue != nil {
-			err = msgpack.Unmarshal(itemValue, &list)
+			match, err := predicate(r.Key(), r.lastEntry.data)
 			if err != nil {
-				log.Println("jvzc: warning: corrupt index detected:", i.name())
-				return err
+				r.Close()
+				return deleted, err
 			}
-		}
 
-		for _, item := range list {
-			// Already exists, no need to add.
-			if item == key {
-				return nil
+			if match {
+				keys = append(keys, r.Key())
 			}
 		}
+		r.Close()
 
-		list = append(list, key)
-
-		data, err := msgpack.Marshal(list)
-		if err != nil {
-			log.Fatal("jvzc: marshal should never fail: ", err)
+		if r.Error() != nil && r.Error() != ErrEndOfRange {
+			return deleted, r.Error()
 		}
 
-		if itemValue == nil {
-			err = i.index.SetIfAbsent(indexKey, data, 0)
-			if err == badger.ErrKeyExists {
-				continue
-			}
-		} else {
-			err = i.index.CompareAndSet(indexKey, data, item.Counter())
-			if err == badger.ErrCasMismatch {
-				continue
+		if len(keys) > 0 {
+			if err := t.deleteBatch(keys, &indexErr); err != nil {
+				return deleted, err
 			}
 		}
 
-		return err
-	}
-}
+		deleted += len(keys)
 
-func (i *Index) name() string {
-	for indexName, index := range i.table.indexes {
-		if index == i {
-			return i.table.name() + "/" + string(indexName)
+		if r.Error() == ErrEndOfRange {
+			return deleted, indexErr
 		}
-	}
 
-	return i.table.name() + "/__unknown_index"
+		lower = last
+	}
 }
 
-// Delete deletes the key from the table. An optional counter value can be
-// provided to only delete the document if the counter value is the same.
-func (t *Table) Delete(key string, counter ...uint64) error {
-	var item badger.KVItem
-	err := t.data.Get([]byte(key), &item)
-	if err != nil {
+// deleteBatch deletes the documents with the keys. Tables without indexes or
+// a change log delete them in a single write, otherwise they are deleted one
+// at a time to update the indexes and log the changes. The first index error
+// is stored in indexErr.
+func (t *Table) deleteBatch(keys []string, indexErr *error) error {
+	if err := t.db.acquire(); err != nil {
 		return err
 	}
+	defer t.db.release()
 
-	itemValue := getItemValue(&item)
-	if itemValue == nil {
-		return nil
-	}
-
-	if len(counter) > 0 {
-		if item.Counter() != counter[0] {
-			return ErrCounterChanged
+	if (len(t.indexes) > 0 && !t.deferIndexes()) || t.changeLog {
+		for _, key := range keys {
+			if err := keepIndexError(indexErr, t.Delete(key)); err != nil {
+				return err
+			}
 		}
 
-		err = t.data.CompareAndDelete([]byte(key), counter[0])
-	} else {
-		err = t.data.Delete([]byte(key))
+		return nil
 	}
 
-	if err == badger.ErrCasMismatch {
-		return ErrCounterChanged
+	var entries []*badger.Entry
+	for _, key := range keys {
+		entries = badger.EntriesDelete(entries, t.dataKey(key))
 	}
 
+	// The documents are locked so that conditional writes of them, which
+	// check their counters while they are locked, aren't raced.
+	unlock := t.lockKeys(keys)
+	err := t.data.BatchSet(entries)
+	unlock()
+
 	if err != nil {
 		return err
 	}
 
-	t.updateIndex(key, itemValue, nil)
+	for _, entry := range entries {
+		if entry.Error != nil {
+			return entry.Error
+		}
+	}
+
+	for _, key := range keys {
+		t.changed(ChangeDelete, key)
+	}
 
 	return nil
 }
@@ -441,63 +1801,260 @@ func (t *Table) Index(index string) *Index {
 // whether or not the update should be aborted, and will be returned back from
 // Update.
 //
-// ErrNotFound will be returned if the document does not exist.
+// The modifier function can return ErrNoChange to abort the update without
+// writing the document, in which case Update returns nil.
+//
+// ErrNotFound will be returned if the document does not exist, and
+// ErrNilValue if the modifier function returns a nil document.
 //
 // The modifier function will be continuously called until the counter at the
 // beginning of handler matches the counter when the document is updated.
 // This allows for safe updates on a single document, such as incrementing a
 // value.
 func (t *Table) Update(key string, handler interface{}) error {
+	return t.UpdateWithOptions(key, handler, UpdateOptions{})
+}
+
+// UpdateOptions configures how UpdateWithOptions retries when the document
+// is changed concurrently. The zero value retries immediately without limit,
+// which is the behaviour of Update.
+type UpdateOptions struct {
+	// MaxAttempts is the maximum number of times the modifier function will
+	// be called. 0 means unlimited.
+	MaxAttempts int
+	// MinBackoff is the delay before the first retry. It is doubled for each
+	// further retry, with a random jitter of up to half the delay either way.
+	// 0 means no delay.
+	MinBackoff time.Duration
+	// MaxBackoff caps the delay between retries, including the jitter. 0
+	// means no cap.
+	MaxBackoff time.Duration
+}
+
+// UpdateWithOptions is like Update, but sleeps with exponential backoff
+// between retries and gives up after a maximum number of attempts, as
+// configured by opts. An error wrapping ErrCounterChanged will be returned
+// if the maximum number of attempts is reached.
+func (t *Table) UpdateWithOptions(key string, handler interface{},
+	opts UpdateOptions) error {
+	_, _, err := t.update(key, handler, opts)
+	return err
+}
+
+// UpdateReturning is like Update, but also returns the marshalled document
+// which was replaced and the marshalled document which was written, as read
+// and written by the same attempt, such as for audit logs. The documents are
+// marshalled as plain msgpack, even if the table uses key compression. The
+// documents are nil if the update fails, but are returned along with the
+// error if the document is written and only its indexes fail to update. If
+// the modifier function returns ErrNoChange, both documents are the unchanged
+// document.
+func (t *Table) UpdateReturning(key string,
+	handler interface{}) (oldRaw, newRaw []byte, err error) {
+	old, new, err := t.update(key, handler, UpdateOptions{})
+	if old == nil {
+		return nil, nil, err
+	}
+
+	oldRaw, newRaw, plainErr := t.plainPair(old, new)
+	if plainErr != nil {
+		return nil, nil, plainErr
+	}
+
+	return oldRaw, newRaw, err
+}
+
+// UpdateMany updates each of the documents with the primary keys like Update,
+// with the same modifier function, which is only validated once. The errors
+// of the keys which failed to update are returned, mapped by key, so keys
+// which don't exist are mapped to ErrNotFound without stopping the other
+// updates. Keys which were updated are not in the map. If the modifier
+// function is invalid, every key is mapped to the error.
+func (t *Table) UpdateMany(keys []string, handler interface{}) map[string]error {
+	errs := make(map[string]error)
+
+	u, err := t.Updater(handler)
+	if err != nil {
+		for _, key := range keys {
+			errs[key] = err
+		}
+
+		return errs
+	}
+
+	for _, key := range keys {
+		if err := u.Apply(key); err != nil {
+			errs[key] = err
+		}
+	}
+
+	return errs
+}
+
+// Updater applies a modifier function of Update to documents, which is only
+// validated once when the Updater is created.
+type Updater struct {
+	table   *Table
+	handler updateHandler
+}
+
+// Updater returns an Updater of the table with the modifier function, which
+// must be valid for Update. It avoids validating the modifier function for
+// every document when many documents are updated with it.
+func (t *Table) Updater(handler interface{}) (*Updater, error) {
+	h, err := newUpdateHandler(handler)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Updater{table: t, handler: h}, nil
+}
+
+// Apply updates the document with the primary key with the modifier function
+// of the Updater, like Update.
+func (u *Updater) Apply(key string) error {
+	_, _, err := u.table.updateWith(key, u.handler, UpdateOptions{})
+	return err
+}
+
+// updateHandler is a modifier function of Update which has been validated.
+type updateHandler struct {
+	fn      reflect.Value
+	docType reflect.Type
+}
+
+func newUpdateHandler(handler interface{}) (updateHandler, error) {
 	handlerType := reflect.TypeOf(handler)
 	if handlerType == nil || handlerType.Kind() != reflect.Func {
-		return errors.New("jvzc: handler must be a function")
+		return updateHandler{}, errors.New("jvzc: handler must be a function")
 	}
 
 	if handlerType.NumIn() != 1 {
-		return errors.New("jvzc: handler must have 1 input argument")
+		return updateHandler{},
+			errors.New("jvzc: handler must have 1 input argument")
 	}
 
 	if handlerType.NumOut() != 2 {
-		return errors.New("jvzc: handler must have 2 return values")
+		return updateHandler{},
+			errors.New("jvzc: handler must have 2 return values")
 	}
 
 	if !handlerType.Out(1).Implements(reflect.TypeOf((*error)(nil)).
 		Elem()) {
-		return errors.New("jvzc: handler must have error as last return value")
+		return updateHandler{},
+			errors.New("jvzc: handler must have error as last return value")
 	}
 
-	for {
-		doc := reflect.New(handlerType.In(0))
-		counter, err := t.Get(key, doc.Interface())
+	return updateHandler{
+		fn:      reflect.ValueOf(handler),
+		docType: handlerType.In(0),
+	}, nil
+}
+
+// update updates the document with the key, and returns the marshalled
+// documents which were replaced and written by the same attempt, as described
+// by UpdateReturning, but marshalled like the documents of the table.
+func (t *Table) update(key string, handler interface{},
+	opts UpdateOptions) ([]byte, []byte, error) {
+	h, err := newUpdateHandler(handler)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return t.updateWith(key, h, opts)
+}
+
+func (t *Table) updateWith(key string, h updateHandler,
+	opts UpdateOptions) ([]byte, []byte, error) {
+	backoff := opts.MinBackoff
+
+	for attempt := 1; ; attempt++ {
+		old, counter, err := t.getRaw(key)
 		if err != nil {
-			return err
+			return nil, nil, err
+		}
+
+		// The document may be owned by the store, so it is copied before
+		// being returned.
+		old = append([]byte(nil), old...)
+
+		doc := reflect.New(h.docType)
+		if err = unmarshal(t, old, doc.Interface()); err != nil {
+			return nil, nil, err
 		}
 
-		result := reflect.ValueOf(handler).Call([]reflect.Value{doc.Elem()})
+		result := h.fn.Call([]reflect.Value{doc.Elem()})
 		if result[1].Interface() != nil {
-			return result[1].Interface().(error)
+			err = result[1].Interface().(error)
+			if errors.Is(err, ErrNoChange) {
+				return old, old, nil
+			}
+
+			return nil, nil, err
 		}
 
-		err = t.Set(key, result[0].Interface(), counter, 0)
-		if err == ErrCounterChanged {
-			continue
+		data, err := t.marshal(result[0].Interface())
+		if err != nil {
+			return nil, nil, err
 		}
 
-		return err
+		if isNilDocument(data) {
+			return nil, nil, ErrNilValue
+		}
+
+		err = t.setData(key, data, false, counter)
+		if err == nil || errors.Is(err, ErrIndexError) {
+			return old, data, err
+		}
+
+		if err != ErrCounterChanged {
+			return nil, nil, err
+		}
+
+		if opts.MaxAttempts > 0 && attempt >= opts.MaxAttempts {
+			return nil, nil, fmt.Errorf(
+				"jvzc: update failed after %d attempts: %w", attempt, err)
+		}
+
+		if backoff > 0 {
+			delay := backoff/2 + time.Duration(rand.Int63n(int64(backoff)))
+			if opts.MaxBackoff > 0 && delay > opts.MaxBackoff {
+				delay = opts.MaxBackoff
+			}
+			time.Sleep(delay)
+
+			backoff *= 2
+			if opts.MaxBackoff > 0 && backoff > opts.MaxBackoff {
+				backoff = opts.MaxBackoff
+			}
+		}
 	}
 }
 
-func (t *Table) name() string {
-	foundTable := "__unknown_table"
+// plainPair returns the marshalled documents as plain msgpack.
+func (t *Table) plainPair(old, new []byte) ([]byte, []byte, error) {
+	if t.keyToCompressed == nil {
+		return old, new, nil
+	}
 
-	for tableName, table := range t.db.tables {
-		if table == t {
-			foundTable = string(tableName)
-			break
-		}
+	old, err := t.toPlain(old)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	return foundTable
+	new, err = t.toPlain(new)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return old, new, nil
+}
+
+// name returns the name of the table. It is stored on the table when it is
+// created, so it can be read concurrently with tables being created and
+// dropped.
+func (t *Table) name() string {
+	return string(t.tableName)
 }
 
 // Between returns a Range of documents between the lower and upper key values
@@ -509,18 +2066,74 @@ func (t *Table) name() string {
 // bound values.
 func (t *Table) Between(lower interface{}, upper interface{},
 	reverse ...bool) *Range {
+	return t.BetweenWithOptions(lower, upper, RangeOptions{
+		Reverse: len(reverse) > 0 && reverse[0],
+	})
+}
+
+// RangeOptions configures a range returned by BetweenWithOptions. The zero
+// value is the same as the range returned by Between.
+type RangeOptions struct {
+	// Reverse sorts the range in descending order by key.
+	Reverse bool
+	// NoCopy returns the values of documents in the range without copying
+	// them out of the underlying store, which avoids an allocation for
+	// every document. The values are only valid until the next call to
+	// Next, so the range is read one document at a time instead of being
+	// buffered. The values must not be modified or retained, so only Next,
+	// Decode, Document, Key and Counter may be used on the range, and not
+	// methods which derive a new range such as Filter or Limit.
+	NoCopy bool
+}
+
+// BetweenWithOptions is like Between, but configured by opts.
+func (t *Table) BetweenWithOptions(lower interface{}, upper interface{},
+	opts RangeOptions) *Range {
+	atomic.AddUint64(&t.ops.Ranges, 1)
+
+	r := resettable(t.between(lower, upper, opts), func() *Range {
+		return t.between(lower, upper, opts)
+	})
+
+	r.seek = func(key string) *Range {
+		return t.betweenFrom(key, lower, upper, opts)
+	}
+
+	r.lower, r.upper, r.reverse = lower, upper, opts.Reverse
+
+	return r
+}
+
+// betweenFrom returns the part of the range between the lower and upper
+// bounds which starts from the key, in the direction of the range.
+func (t *Table) betweenFrom(key string, lower, upper interface{},
+	opts RangeOptions) *Range {
+	if opts.Reverse {
+		upperString, isString := upper.(string)
+		if (isString && t.sortKey(key) < t.sortKey(upperString)) ||
+			upper == MaxValue {
+			upper = key
+		}
+	} else {
+		lowerString, isString := lower.(string)
+		if (isString && t.sortKey(key) > t.sortKey(lowerString)) ||
+			lower == MinValue {
+			lower = key
+		}
+	}
+
+	return t.between(lower, upper, opts)
+}
+
+func (t *Table) between(lower interface{}, upper interface{},
+	opts RangeOptions) *Range {
 	if lower == MaxValue || upper == MinValue {
 		return newRange(func() (string, []byte, uint64, error) {
 			return "", nil, 0, ErrEndOfRange
 		}, func() {}, nil)
 	}
 
-	shouldReverse := (len(reverse) > 0) && reverse[0]
-
-	itOpts := badger.DefaultIteratorOptions
-	itOpts.PrefetchSize = prefetchSize
-	itOpts.Reverse = shouldReverse
-	it := t.data.NewIterator(itOpts)
+	shouldReverse := opts.Reverse
 
 	upperString, upperIsString := upper.(string)
 	_, upperIsBounds := upper.(Bounds)
@@ -528,16 +2141,25 @@ func (t *Table) Between(lower interface{}, upper interface{},
 	_, lowerIsBounds := lower.(Bounds)
 	if (!upperIsString && !upperIsBounds) ||
 		(!lowerIsString && !lowerIsBounds) {
-		log.Println("jvzc: warning: lower and upper bounds of " +
-			"table.Between must be a string or Bounds. An empty range has " +
-			"been returned instead")
+		t.db.warn(Warning{Code: InvalidBounds, Name: t.name()})
 		return newRange(func() (string, []byte, uint64, error) {
 			return "", nil, 0, ErrEndOfRange
 		}, func() {}, nil)
 	}
 
-	upperBytes := []byte(upperString)
-	lowerBytes := []byte(lowerString)
+	if err := t.acquireRange(nil); err != nil {
+		return newRange(func() (string, []byte, uint64, error) {
+			return "", nil, 0, err
+		}, func() {}, nil)
+	}
+
+	itOpts := badger.DefaultIteratorOptions
+	itOpts.PrefetchSize = prefetchSize
+	itOpts.Reverse = shouldReverse
+	it := t.data.NewIterator(itOpts)
+
+	upperBytes := t.boundKey(upperString, true)
+	lowerBytes := t.boundKey(lowerString, false)
 
 	if !shouldReverse {
 		if lower == MinValue {
@@ -556,8 +2178,17 @@ func (t *Table) Between(lower interface{}, upper interface{},
 	var key string
 	var counter uint64
 	var value []byte
+	var advance bool
+
+	next, closer := guardIterator(t.db, func() (string, []byte, uint64, error) {
+		// The value of an item is reused once the iterator moves past it, so
+		// without copying, the iterator only advances when the next value is
+		// requested.
+		if advance {
+			it.Next()
+			advance = false
+		}
 
-	return newRange(func() (string, []byte, uint64, error) {
 		for it.Valid() {
 			if !shouldReverse && upper != MaxValue &&
 				bytes.Compare(it.Item().Key(), upperBytes) > 0 {
@@ -567,9 +2198,35 @@ func (t *Table) Between(lower interface{}, upper interface{},
 				return "", nil, 0, ErrEndOfRange
 			}
 
-			key = string(it.Item().Key())
+			key = t.userKey(it.Item().Key())
 			counter = it.Item().Counter()
-			itemValue := getItemValue(it.Item())
+			itemValue, err := t.itemData(it.Item())
+			if err != nil {
+				return "", nil, 0, err
+			}
+
+			if len(itemValue) == 0 {
+				exists, err := t.data.Exists(it.Item().Key())
+				if err != nil {
+					return "", nil, 0, err
+				}
+
+				if !exists {
+					// The document was deleted while it was being iterated over.
+					it.Next()
+					continue
+				}
+
+				// The document is stored with an empty value, which is
+				// returned so that decoding it reports ErrEmptyValue.
+				itemValue = []byte{}
+			}
+
+			if opts.NoCopy {
+				advance = true
+				return key, itemValue, counter, nil
+			}
+
 			value = make([]byte, len(itemValue))
 			copy(value, itemValue)
 			it.Next()
@@ -577,7 +2234,67 @@ func (t *Table) Between(lower interface{}, upper interface{},
 		}
 
 		return "", nil, 0, ErrEndOfRange
-	}, it.Close, t)
+	}, func() {
+		it.Close()
+		t.releaseRange()
+	})
+
+	if opts.NoCopy {
+		return newUnbufferedRange(next, closer, t)
+	}
+
+	return newRange(next, closer, t)
+}
+
+// acquireRange registers a range which holds an iterator over the table, or
+// over the given index if it isn't nil. The table cannot be dropped until
+// the range is released. ErrClosed is returned if the database is closed.
+func (t *Table) acquireRange(index *Index) error {
+	if atomic.LoadInt32(&t.db.closed) != 0 {
+		return ErrClosed
+	}
+
+	t.rangeMutex.Lock()
+	defer t.rangeMutex.Unlock()
+
+	if t.dropped || (index != nil && index.dropped) {
+		return ErrNotFound
+	}
+
+	t.openRanges++
+	return nil
+}
+
+func (t *Table) releaseRange() {
+	t.rangeMutex.Lock()
+	t.openRanges--
+	t.rangeMutex.Unlock()
+}
+
+// addListener registers a function which will be called with the key of every
+// document that is written to or deleted from the table, after the write has
+// completed. The returned function removes the listener.
+func (t *Table) addListener(fn func(key string)) func() {
+	t.listenerMutex.Lock()
+	id := t.nextListener
+	t.nextListener++
+	t.listeners[id] = fn
+	t.listenerMutex.Unlock()
+
+	return func() {
+		t.listenerMutex.Lock()
+		delete(t.listeners, id)
+		t.listenerMutex.Unlock()
+	}
+}
+
+func (t *Table) notify(key string) {
+	t.listenerMutex.RLock()
+	defer t.listenerMutex.RUnlock()
+
+	for _, fn := range t.listeners {
+		fn(key)
+	}
 }
 
 // CountBetween returns the number of documents whose key values are
@@ -588,31 +2305,38 @@ func (t *Table) CountBetween(lower, upper interface{}) int64 {
 		return 0
 	}
 
-	itOpts := badger.DefaultIteratorOptions
-	itOpts.PrefetchSize = prefetchSize
-	itOpts.PrefetchValues = false
-	it := t.data.NewIterator(itOpts)
-
 	upperString, isString := upper.(string)
 	_, isBounds := upper.(Bounds)
 	if !isString && !isBounds {
-		log.Println("jvzc: warning: lower and upper bounds of " +
-			"table.CountBetween must be a string or Bounds. A count of 0 has " +
-			"been returned instead")
+		t.db.warn(Warning{Code: InvalidBounds, Name: t.name()})
 		return 0
 	}
 
 	lowerString, isString := lower.(string)
 	_, isBounds = lower.(Bounds)
 	if !isString && !isBounds {
-		log.Println("jvzc: warning: lower and upper bounds of " +
-			"table.CountBetween must be a string or Bounds. A count of 0 has " +
-			"been returned instead")
+		t.db.warn(Warning{Code: InvalidBounds, Name: t.name()})
+		return 0
+	}
+
+	if t.db.acquire() != nil {
+		return 0
+	}
+	defer t.db.release()
+
+	if t.acquireRange(nil) != nil {
 		return 0
 	}
+	defer t.releaseRange()
 
-	upperBytes := []byte(upperString)
-	lowerBytes := []byte(lowerString)
+	itOpts := badger.DefaultIteratorOptions
+	itOpts.PrefetchSize = prefetchSize
+	itOpts.PrefetchValues = false
+	it := t.data.NewIterator(itOpts)
+	defer it.Close()
+
+	upperBytes := t.boundKey(upperString, true)
+	lowerBytes := t.boundKey(lowerString, false)
 
 	if lower == MinValue {
 		it.Rewind()
@@ -642,16 +2366,109 @@ func (t *Table) All(reverse ...bool) *Range {
 	return t.Between(MinValue, MaxValue, reverse...)
 }
 
-// Indexes returns the list of indexes in the table.
+// Dir returns the directory of the table, which is named after the
+// hexadecimal representation of the table name in the directory of the
+// database. It contains the stores of the documents, indexes and change log
+// of the table, unless the table was adopted from another directory, in
+// which case its documents are stored in DataDir.
+func (t *Table) Dir() string {
+	return t.db.path + "/" + t.tableName.Hex()
+}
+
+// DataDir returns the directory of the store of the documents of the table,
+// which is the "data" directory of Dir unless the table was adopted from
+// another directory.
+func (t *Table) DataDir() string {
+	return t.dir
+}
+
+// Indexes returns the list of indexes in the table, sorted by name.
 func (t *Table) Indexes() []string {
 	var indexes []string
 	for name := range t.indexes {
 		indexes = append(indexes, string(name))
 	}
 
+	sort.Strings(indexes)
 	return indexes
 }
 
+// TableConfig represents the persisted configuration of a table.
+type TableConfig struct {
+	Name           string
+	Indexes        []IndexConfig
+	KeyCompression bool
+	Compression    Compression
+	Metadata       bool
+	ArrayEncoding  bool
+	MaxValueSize   int64
+	ChangeLog      bool
+	// Dir is the directory of the store of a table adopted with
+	// OpenExisting, or empty if the table is stored in the database.
+	Dir string
+}
+
+// IndexConfig represents the persisted configuration of an index.
+type IndexConfig struct {
+	Name string
+	// Field is the Query of the index, which is the same as its name unless
+	// it was created with NewPartialIndex or NewUniqueMultiIndex.
+	Field   string
+	Partial bool
+	Options IndexOptions
+}
+
+// Config returns a copy of the persisted configuration of the table, for
+// introspection. Modifying it has no effect on the table. The zero value is
+// returned if the table has been dropped.
+func (t *Table) Config() TableConfig {
+	tableName := t.name()
+
+	t.db.configMutex.Lock()
+	defer t.db.configMutex.Unlock()
+
+	for _, table := range t.db.config.Tables {
+		if table.TableName != tableName {
+			continue
+		}
+
+		config := TableConfig{
+			Name:           table.TableName,
+			Indexes:        make([]IndexConfig, len(table.Indexes)),
+			KeyCompression: table.UseKeyCompression,
+			Compression:    table.Compression,
+			Metadata:       table.Metadata,
+			ArrayEncoding:  table.ArrayEncoding,
+			MaxValueSize:   table.MaxValueSize,
+			ChangeLog:      table.ChangeLog,
+			Dir:            table.Dir,
+		}
+
+		for i, index := range table.Indexes {
+			config.Indexes[i] = IndexConfig{
+				Name:    index.IndexName,
+				Field:   index.IndexName,
+				Partial: index.Partial,
+				Options: IndexOptions{
+					Shards:   index.Shards,
+					PerKey:   index.PerKey,
+					SelfHeal: index.SelfHeal,
+					Unique:   index.Unique,
+					Project:  index.Project,
+				},
+			}
+
+			if index.Field != "" {
+				config.Indexes[i].Field = index.Field
+			}
+		}
+
+		return config
+	}
+
+	return TableConfig{}
+}
+
 func incrementKey(key string) string {
 	byteKey := []byte(key)
 	for i, letter := range byteKey {
@@ -729,9 +2546,11 @@ func (t *Table) cToKey(compressed string) string {
 
 	value, found := t.compressedToKey[compressed]
 	if !found {
-		log.Println("jvzc: warning: failed to decompress non-existent "+
-			"compressed key:", compressed)
-		log.Println(string(debug.Stack()))
+		t.db.warn(Warning{
+			Code: MissingCompressedKey,
+			Name: t.name(),
+			Err:  errors.New("jvzc: compressed key \"" + compressed + "\" not found"),
+		})
 		return compressed
 	}
 
@@ -1,11 +1,17 @@
 package jvzc
 
 import (
+	"errors"
 	"io/ioutil"
 	"log"
 	"os"
+	"runtime"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
+
+	"github.com/1lann/badger"
 )
 
 func expectPerson(key string, r *Range, person Person) {
@@ -567,3 +573,1515 @@ func TestInvalidTypes(t *testing.T) {
 	panicNotNil(db.Table("types_testing").Set("valid", "just some data"))
 
 }
+
+func TestTableDropInUse(t *testing.T) {
+	if testing.Short() {
+		t.Parallel()
+	}
+
+	dir, err := ioutil.TempDir("", "jvzc_")
+	panicNotNil(err)
+
+	t.Log("testing directory:", dir)
+	defer func() {
+		if !t.Failed() {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	db, err := Open(dir + "/data")
+	panicNotNil(err)
+
+	defer db.Close()
+
+	panicNotNil(db.NewTable("drop_testing"))
+	panicNotNil(db.Table("drop_testing").NewIndex("City"))
+
+	for i := 0; i < 100; i++ {
+		panicNotNil(db.Table("drop_testing").Set(strconv.Itoa(i),
+			Person{Name: "Jason", City: "Sydney", Age: i}))
+	}
+
+	table := db.Table("drop_testing")
+
+	r := table.Index("City").All()
+	if table.Index("City").Drop() != ErrInUse {
+		t.Fatal("error should be ErrInUse, but isn't")
+	}
+
+	if table.Drop() != ErrInUse {
+		t.Fatal("error should be ErrInUse, but isn't")
+	}
+
+	r.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				r := table.All()
+				r.Next()
+				r.Close()
+			}
+		}()
+	}
+
+	for {
+		err := table.Drop()
+		if err == nil {
+			break
+		} else if err != ErrInUse {
+			panicNotNil(err)
+		}
+
+		runtime.Gosched()
+	}
+
+	wg.Wait()
+
+	if db.Table("drop_testing") != nil {
+		t.Fatal("table should be nil, but isn't")
+	}
+
+	r = table.All()
+	if r.Next() || r.Error() != ErrNotFound {
+		t.Fatal("error should be ErrNotFound, but isn't")
+	}
+}
+
+func TestTableDropPlan(t *testing.T) {
+	if testing.Short() {
+		t.Parallel()
+	}
+
+	dir, err := ioutil.TempDir("", "jvzc_")
+	panicNotNil(err)
+
+	t.Log("testing directory:", dir)
+	defer func() {
+		if !t.Failed() {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	db, err := Open(dir + "/data")
+	panicNotNil(err)
+
+	defer db.Close()
+
+	panicNotNil(db.NewTable("plan_testing"))
+	table := db.Table("plan_testing")
+	panicNotNil(table.NewIndex("City"))
+	panicNotNil(table.NewIndex("Age"))
+
+	for i := 0; i < 10; i++ {
+		panicNotNil(table.Set(strconv.Itoa(i),
+			Person{Name: "Jason", City: "Sydney", Age: i}))
+	}
+
+	plan, err := table.DropPlan()
+	panicNotNil(err)
+
+	if plan.Documents != 10 {
+		t.Fatal("documents should be 10, but is", plan.Documents)
+	}
+
+	if strings.Join(plan.Indexes, ",") != "Age,City" {
+		t.Fatal("indexes should be Age,City, but are", plan.Indexes)
+	}
+
+	if plan.Dir != dir+"/data/"+Name("plan_testing").Hex() {
+		t.Fatal("dir should be the table's directory, but is", plan.Dir)
+	}
+
+	if db.Table("plan_testing") == nil {
+		t.Fatal("table should not be dropped, but is")
+	}
+
+	panicNotNil(table.Set("3", Person{Name: "Ben", City: "Perth", Age: 3}))
+
+	if table.Drop(plan) != ErrTableChanged {
+		t.Fatal("error should be ErrTableChanged, but isn't")
+	}
+
+	if db.Table("plan_testing") == nil {
+		t.Fatal("table should not be dropped, but is")
+	}
+
+	plan, err = table.DropPlan()
+	panicNotNil(err)
+	panicNotNil(table.Drop(plan))
+
+	if db.Table("plan_testing") != nil {
+		t.Fatal("table should be nil, but isn't")
+	}
+
+	if _, err := os.Stat(plan.Dir); !os.IsNotExist(err) {
+		t.Fatal("dir should be removed, but isn't")
+	}
+
+	if _, err := table.DropPlan(); err != ErrNotFound {
+		t.Fatal("error should be ErrNotFound, but isn't")
+	}
+}
+
+func TestTableMove(t *testing.T) {
+	if testing.Short() {
+		t.Parallel()
+	}
+
+	dir, err := ioutil.TempDir("", "jvzc_")
+	panicNotNil(err)
+
+	t.Log("testing directory:", dir)
+	defer func() {
+		if !t.Failed() {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	db, err := Open(dir + "/data")
+	panicNotNil(err)
+
+	defer db.Close()
+
+	panicNotNil(db.NewTable("move_testing"))
+	table := db.Table("move_testing")
+	panicNotNil(table.NewIndex("City"))
+
+	jason := Person{Name: "Jason", City: "Sydney", Age: 18}
+	ben := Person{Name: "Ben", City: "Melbourne", Age: 19}
+	panicNotNil(table.Set("jason", jason))
+	panicNotNil(table.Set("ben", ben))
+
+	panicNotNil(table.Move("jason", "jason2"))
+
+	if _, err := table.Get("jason", nil); err != ErrNotFound {
+		t.Fatal("error should be ErrNotFound, but isn't")
+	}
+
+	r := table.Index("City").GetAll("Sydney")
+	expectPerson("jason2", r, jason)
+	if r.Next() {
+		t.Fatal("index should only have jason2, but doesn't")
+	}
+	r.Close()
+
+	if table.Move("jason2", "ben") != ErrAlreadyExists {
+		t.Fatal("error should be ErrAlreadyExists, but isn't")
+	}
+
+	expectPerson("ben", table.Index("City").GetAll("Melbourne"), ben)
+
+	panicNotNil(table.Move("jason2", "ben", true))
+
+	n, err := table.Index("City").GetAll("Melbourne").Count()
+	panicNotNil(err)
+
+	if n != 0 {
+		t.Fatal("count should be 0, but is", n)
+	}
+
+	expectPerson("ben", table.Index("City").GetAll("Sydney"), jason)
+
+	n, err = table.All().Count()
+	panicNotNil(err)
+
+	if n != 1 {
+		t.Fatal("count should be 1, but is", n)
+	}
+
+	if table.Move("missing", "other") != ErrNotFound {
+		t.Fatal("error should be ErrNotFound, but isn't")
+	}
+
+	if table.Move("ben", "") != ErrBadIdentifier {
+		t.Fatal("error should be ErrBadIdentifier, but isn't")
+	}
+
+	// The document changes during the move while another document is
+	// written under the new key, which isn't overwritten by the retry.
+	drew := Person{Name: "Drew", City: "London", Age: 20}
+	raced := false
+	removeListener := table.addListener(func(key string) {
+		if key != "ben2" || raced {
+			return
+		}
+
+		raced = true
+		panicNotNil(table.Set("ben", ben))
+		panicNotNil(table.Set("ben2", drew))
+	})
+
+	if err := table.Move("ben", "ben2"); err != ErrAlreadyExists {
+		t.Fatal("error should be ErrAlreadyExists, but is", err)
+	}
+	removeListener()
+
+	expectPerson("ben", table.Index("City").GetAll("Melbourne"), ben)
+	expectPerson("ben2", table.Index("City").GetAll("London"), drew)
+}
+
+func TestTablePut(t *testing.T) {
+	if testing.Short() {
+		t.Parallel()
+	}
+
+	dir, err := ioutil.TempDir("", "jvzc_")
+	panicNotNil(err)
+
+	t.Log("testing directory:", dir)
+	defer func() {
+		if !t.Failed() {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	db, err := Open(dir + "/data")
+	panicNotNil(err)
+
+	defer db.Close()
+
+	panicNotNil(db.NewTable("put_testing"))
+
+	jason := Person{Name: "Jason", City: "Sydney", Age: 18}
+
+	_, err = db.Table("put_testing").Put(jason)
+	if err == nil {
+		t.Fatal("put without a key function should fail, but doesn't")
+	}
+
+	db.Table("put_testing").SetKeyFunc(func(value interface{}) (string, error) {
+		person, ok := value.(Person)
+		if !ok {
+			return "", errors.New("not a person")
+		}
+
+		return strings.ToLower(person.Name), nil
+	})
+
+	key, err := db.Table("put_testing").Put(jason)
+	panicNotNil(err)
+
+	if key != "jason" {
+		t.Fatal("key should be jason, but is", key)
+	}
+
+	var person Person
+	_, err = db.Table("put_testing").Get("jason", &person)
+	panicNotNil(err)
+
+	if !person.IsSame(jason) {
+		t.Fatal("person should be jason, but isn't")
+	}
+
+	_, err = db.Table("put_testing").Put("not a person")
+	if err == nil || err.Error() != "not a person" {
+		t.Fatal("error should be from the key function, but isn't")
+	}
+
+	_, err = db.Table("put_testing").Put(Person{})
+	if err != ErrBadIdentifier {
+		t.Fatal("error should be ErrBadIdentifier, but isn't")
+	}
+}
+
+func TestTableDeleteDuringRange(t *testing.T) {
+	if testing.Short() {
+		t.Parallel()
+	}
+
+	dir, err := ioutil.TempDir("", "jvzc_")
+	panicNotNil(err)
+
+	t.Log("testing directory:", dir)
+	defer func() {
+		if !t.Failed() {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	db, err := Open(dir + "/data")
+	panicNotNil(err)
+
+	defer db.Close()
+
+	panicNotNil(db.NewTable("delete_testing"))
+
+	for i := 0; i < 1000; i++ {
+		panicNotNil(db.Table("delete_testing").Set(strconv.Itoa(i+1000),
+			Person{Name: "Jason", City: "Sydney", Age: i}))
+	}
+
+	r := db.Table("delete_testing").All()
+	defer r.Close()
+
+	if !r.Next() {
+		t.Fatal("Next should be successful, but isn't")
+	}
+
+	for i := 1; i < 1000; i += 2 {
+		panicNotNil(db.Table("delete_testing").Delete(strconv.Itoa(i + 1000)))
+	}
+
+	for r.Next() {
+		var person Person
+		if err := r.Decode(&person); err != nil {
+			t.Fatal("decode should be successful, but isn't:", err)
+		}
+
+		if person.Name != "Jason" {
+			t.Fatal("person should be jason, but isn't")
+		}
+	}
+
+	if r.Error() != ErrEndOfRange {
+		t.Fatal("error should be ErrEndOfRange, but is", r.Error())
+	}
+}
+
+func TestTableGetMap(t *testing.T) {
+	if testing.Short() {
+		t.Parallel()
+	}
+
+	dir, err := ioutil.TempDir("", "jvzc_")
+	panicNotNil(err)
+
+	t.Log("testing directory:", dir)
+	defer func() {
+		if !t.Failed() {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	db, err := Open(dir + "/data")
+	panicNotNil(err)
+
+	defer db.Close()
+
+	panicNotNil(db.NewTable("map_testing"))
+	table := db.Table("map_testing")
+
+	jason := Person{Name: "Jason", City: "Sydney", Age: 18}
+	ben := Person{Name: "Ben", City: "Melbourne", Age: 19}
+	panicNotNil(table.Set("jason", jason))
+	panicNotNil(table.Set("ben", ben))
+
+	people, err := table.GetMap([]string{"jason", "missing", "ben"}, Person{})
+	panicNotNil(err)
+
+	if len(people) != 2 {
+		t.Fatal("map should have 2 documents, but has", len(people))
+	}
+
+	if person, ok := people["jason"].(Person); !ok || !person.IsSame(jason) {
+		t.Fatal("person should be jason, but isn't")
+	}
+
+	if person, ok := people["ben"].(Person); !ok || !person.IsSame(ben) {
+		t.Fatal("person should be ben, but isn't")
+	}
+
+	if _, found := people["missing"]; found {
+		t.Fatal("missing should not be in the map, but is")
+	}
+
+	pointers, err := table.GetMap([]string{"jason"}, &Person{})
+	panicNotNil(err)
+
+	if person, ok := pointers["jason"].(*Person); !ok ||
+		!person.IsSame(jason) {
+		t.Fatal("person should be a pointer to jason, but isn't")
+	}
+
+	if _, err := table.GetMap([]string{"jason"}, nil); err == nil {
+		t.Fatal("a nil template should fail, but didn't")
+	}
+}
+
+func TestTableGetDynamic(t *testing.T) {
+	if testing.Short() {
+		t.Parallel()
+	}
+
+	dir, err := ioutil.TempDir("", "jvzc_")
+	panicNotNil(err)
+
+	t.Log("testing directory:", dir)
+	defer func() {
+		if !t.Failed() {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	db, err := Open(dir + "/data")
+	panicNotNil(err)
+
+	defer db.Close()
+
+	for _, compression := range []bool{true, false} {
+		name := "dynamic_testing_" + strconv.FormatBool(compression)
+		panicNotNil(db.NewTable(name, compression))
+
+		jason := Person{Name: "Jason", City: "Sydney", Age: 18}
+		panicNotNil(db.Table(name).Set("jason", jason))
+		panicNotNil(db.Table(name).Set("nested", map[string]interface{}{
+			"Person": map[string]interface{}{"Name": "Ben"},
+		}))
+
+		var person Person
+		_, err = db.Table(name).Get("jason", &person)
+		panicNotNil(err)
+
+		if !person.IsSame(jason) {
+			t.Fatal("person should be jason, but isn't")
+		}
+
+		var m map[string]interface{}
+		_, err = db.Table(name).Get("jason", &m)
+		panicNotNil(err)
+
+		if m["Name"] != "Jason" || m["City"] != "Sydney" ||
+			toInt(m["Age"]) != 18 {
+			t.Fatal("map should contain jason, but doesn't:", m)
+		}
+
+		var v interface{}
+		_, err = db.Table(name).Get("jason", &v)
+		panicNotNil(err)
+
+		vm, ok := v.(map[string]interface{})
+		if !ok || vm["Name"] != "Jason" || toInt(vm["Age"]) != 18 {
+			t.Fatal("interface should contain jason, but doesn't:", v)
+		}
+
+		v = nil
+		_, err = db.Table(name).Get("nested", &v)
+		panicNotNil(err)
+
+		nested, ok := v.(map[string]interface{})["Person"].(map[string]interface{})
+		if !ok || nested["Name"] != "Ben" {
+			t.Fatal("interface should contain nested map, but doesn't:", v)
+		}
+	}
+}
+
+func toInt(v interface{}) int {
+	switch n := v.(type) {
+	case int64:
+		return int(n)
+	case uint64:
+		return int(n)
+	}
+
+	return -1
+}
+
+func TestTableSetIfChanged(t *testing.T) {
+	if testing.Short() {
+		t.Parallel()
+	}
+
+	dir, err := ioutil.TempDir("", "jvzc_")
+	panicNotNil(err)
+
+	t.Log("testing directory:", dir)
+	defer func() {
+		if !t.Failed() {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	db, err := Open(dir + "/data")
+	panicNotNil(err)
+
+	defer db.Close()
+
+	panicNotNil(db.NewTable("changed_testing"))
+
+	jason := Person{Name: "Jason", City: "Sydney", Age: 18}
+
+	changed, err := db.Table("changed_testing").SetIfChanged("jason", jason)
+	panicNotNil(err)
+
+	if !changed {
+		t.Fatal("new document should be changed, but isn't")
+	}
+
+	counter, err := db.Table("changed_testing").Get("jason", nil)
+	panicNotNil(err)
+
+	changed, err = db.Table("changed_testing").SetIfChanged("jason", jason)
+	panicNotNil(err)
+
+	if changed {
+		t.Fatal("identical document should not be changed, but is")
+	}
+
+	newCounter, err := db.Table("changed_testing").Get("jason", nil)
+	panicNotNil(err)
+
+	if newCounter != counter {
+		t.Fatal("counter should not change, but does")
+	}
+
+	jason.Age = 19
+	changed, err = db.Table("changed_testing").SetIfChanged("jason", jason)
+	panicNotNil(err)
+
+	if !changed {
+		t.Fatal("modified document should be changed, but isn't")
+	}
+
+	var person Person
+	_, err = db.Table("changed_testing").Get("jason", &person)
+	panicNotNil(err)
+
+	if !person.IsSame(jason) {
+		t.Fatal("person should be jason, but isn't")
+	}
+}
+
+func TestTableBadKeys(t *testing.T) {
+	if testing.Short() {
+		t.Parallel()
+	}
+
+	dir, err := ioutil.TempDir("", "jvzc_")
+	panicNotNil(err)
+
+	t.Log("testing directory:", dir)
+	defer func() {
+		if !t.Failed() {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	db, err := Open(dir + "/data")
+	panicNotNil(err)
+
+	defer db.Close()
+
+	panicNotNil(db.NewTable("keys_testing"))
+
+	table := db.Table("keys_testing")
+	long := strings.Repeat("a", MaxKeyLength+1)
+
+	for _, key := range []string{"", long} {
+		if table.Set(key, "value") != ErrBadIdentifier {
+			t.Fatal("set error should be ErrBadIdentifier, but isn't")
+		}
+
+		if _, err := table.Get(key, nil); err != ErrBadIdentifier {
+			t.Fatal("get error should be ErrBadIdentifier, but isn't")
+		}
+
+		if table.Delete(key) != ErrBadIdentifier {
+			t.Fatal("delete error should be ErrBadIdentifier, but isn't")
+		}
+
+		if _, err := table.SetIfChanged(key, "value"); err != ErrBadIdentifier {
+			t.Fatal("set if changed error should be ErrBadIdentifier, but isn't")
+		}
+	}
+
+	panicNotNil(table.Set(long[:MaxKeyLength], "value"))
+
+	// The key must survive the store being flushed to disk and reopened.
+	db.Close()
+
+	db, err = Open(dir + "/data")
+	panicNotNil(err)
+
+	defer db.Close()
+
+	var value string
+	_, err = db.Table("keys_testing").Get(long[:MaxKeyLength], &value)
+	panicNotNil(err)
+
+	if value != "value" {
+		t.Fatal("value should be \"value\", but is", value)
+	}
+
+	// The sort key of a collated table is stored with the key, so it must
+	// fit as well.
+	panicNotNil(db.NewTable("collated_keys_testing"))
+	collated := db.Table("collated_keys_testing")
+	collated.SetCollation(func(key string) string {
+		return key + key
+	})
+
+	if collated.Set(long[:MaxKeyLength], "value") != ErrBadIdentifier {
+		t.Fatal("set error should be ErrBadIdentifier, but isn't")
+	}
+
+	panicNotNil(collated.Set(long[:MaxKeyLength/2], "value"))
+}
+
+func TestTableVersion(t *testing.T) {
+	if testing.Short() {
+		t.Parallel()
+	}
+
+	dir, err := ioutil.TempDir("", "jvzc_")
+	panicNotNil(err)
+
+	t.Log("testing directory:", dir)
+	defer func() {
+		if !t.Failed() {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	db, err := Open(dir + "/data")
+	panicNotNil(err)
+
+	defer db.Close()
+
+	panicNotNil(db.NewTable("version_testing"))
+	table := db.Table("version_testing")
+
+	jason := Person{Name: "Jason", City: "Sydney", Age: 18}
+
+	panicNotNil(table.SetVersion("jason", jason, Absent))
+
+	if table.SetVersion("jason", jason, Absent) != ErrCounterChanged {
+		t.Fatal("error should be ErrCounterChanged, but isn't")
+	}
+
+	var person Person
+	version, err := table.GetVersion("jason", &person)
+	panicNotNil(err)
+
+	if !person.IsSame(jason) {
+		t.Fatal("person should be jason, but isn't")
+	}
+
+	jason.Age = 19
+	if table.SetVersion("jason", jason, version+1) != ErrCounterChanged {
+		t.Fatal("error should be ErrCounterChanged, but isn't")
+	}
+
+	panicNotNil(table.SetVersion("jason", jason, version))
+
+	if table.DeleteVersion("jason", version) != ErrCounterChanged {
+		t.Fatal("error should be ErrCounterChanged, but isn't")
+	}
+
+	version, err = table.GetVersion("jason", nil)
+	panicNotNil(err)
+
+	panicNotNil(table.DeleteVersion("jason", version))
+
+	_, err = table.GetVersion("jason", nil)
+	if err != ErrNotFound {
+		t.Fatal("error should be ErrNotFound, but isn't")
+	}
+}
+
+func TestTableConfig(t *testing.T) {
+	if testing.Short() {
+		t.Parallel()
+	}
+
+	dir, err := ioutil.TempDir("", "jvzc_")
+	panicNotNil(err)
+
+	t.Log("testing directory:", dir)
+	defer func() {
+		if !t.Failed() {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	db, err := Open(dir + "/data")
+	panicNotNil(err)
+
+	defer db.Close()
+
+	panicNotNil(db.NewTable("config_testing", false))
+	table := db.Table("config_testing")
+	panicNotNil(table.NewIndex("Name"))
+	panicNotNil(table.NewIndex("City", IndexOptions{Shards: 4}))
+	panicNotNil(table.SetCompression(FlateCompression))
+
+	config := table.Config()
+	if config.Name != "config_testing" || config.KeyCompression ||
+		config.Compression != FlateCompression {
+		t.Fatal("config should match table, but is", config)
+	}
+
+	if len(config.Indexes) != 2 || config.Indexes[0].Name != "Name" ||
+		config.Indexes[1].Options.Shards != 4 {
+		t.Fatal("index config should match indexes, but is", config.Indexes)
+	}
+
+	config.Indexes[0].Name = "Changed"
+	if table.Config().Indexes[0].Name != "Name" {
+		t.Fatal("config should be a copy, but isn't")
+	}
+
+	panicNotNil(table.Drop())
+
+	if table.Config().Name != "" {
+		t.Fatal("dropped table config should be empty, but isn't")
+	}
+}
+
+func TestTableInsert(t *testing.T) {
+	if testing.Short() {
+		t.Parallel()
+	}
+
+	dir, err := ioutil.TempDir("", "jvzc_")
+	panicNotNil(err)
+
+	t.Log("testing directory:", dir)
+	defer func() {
+		if !t.Failed() {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	db, err := Open(dir + "/data")
+	panicNotNil(err)
+
+	defer db.Close()
+
+	panicNotNil(db.NewTable("insert_testing"))
+	table := db.Table("insert_testing")
+	panicNotNil(table.NewIndex("City"))
+
+	jason := Person{Name: "Jason", City: "Sydney", Age: 18}
+	panicNotNil(table.Insert("jason", jason))
+
+	drew := Person{Name: "Drew", City: "London", Age: 18}
+	if table.Insert("jason", drew) != ErrAlreadyExists {
+		t.Fatal("error should be ErrAlreadyExists, but isn't")
+	}
+
+	expectPerson("jason", table.Index("City").GetAll("Sydney"), jason)
+
+	count, err := table.Index("City").GetAll("London").Count()
+	panicNotNil(err)
+
+	if count != 0 {
+		t.Fatal("London should have no documents, but does")
+	}
+
+	panicNotNil(table.Delete("jason"))
+	panicNotNil(table.Insert("jason", drew))
+
+	var person Person
+	_, err = table.Get("jason", &person)
+	panicNotNil(err)
+
+	if !person.IsSame(drew) {
+		t.Fatal("person should be drew, but isn't")
+	}
+}
+
+func TestTableSetCounterMissing(t *testing.T) {
+	if testing.Short() {
+		t.Parallel()
+	}
+
+	dir, err := ioutil.TempDir("", "jvzc_")
+	panicNotNil(err)
+
+	t.Log("testing directory:", dir)
+	defer func() {
+		if !t.Failed() {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	db, err := Open(dir + "/data")
+	panicNotNil(err)
+
+	defer db.Close()
+
+	panicNotNil(db.NewTable("counter_testing"))
+	table := db.Table("counter_testing")
+
+	jason := Person{Name: "Jason", City: "Sydney", Age: 18}
+	if table.Set("jason", jason, 1) != ErrCounterChanged {
+		t.Fatal("error should be ErrCounterChanged, but isn't")
+	}
+
+	panicNotNil(table.Set("jason", jason))
+	panicNotNil(table.Delete("jason"))
+
+	var item badger.KVItem
+	panicNotNil(table.data.Get([]byte("jason"), &item))
+
+	if table.Set("jason", jason, item.Counter()) != ErrCounterChanged {
+		t.Fatal("error should be ErrCounterChanged, but isn't")
+	}
+
+	_, err = table.Get("jason", nil)
+	if err != ErrNotFound {
+		t.Fatal("error should be ErrNotFound, but isn't")
+	}
+
+	panicNotNil(table.Set("jason", jason, 0))
+}
+
+func TestTableSetNil(t *testing.T) {
+	if testing.Short() {
+		t.Parallel()
+	}
+
+	dir, err := ioutil.TempDir("", "jvzc_")
+	panicNotNil(err)
+
+	t.Log("testing directory:", dir)
+	defer func() {
+		if !t.Failed() {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	db, err := Open(dir + "/data")
+	panicNotNil(err)
+
+	defer db.Close()
+
+	panicNotNil(db.NewTable("nil_testing"))
+	table := db.Table("nil_testing")
+	panicNotNil(table.NewIndex("City"))
+
+	jason := Person{Name: "Jason", City: "Sydney", Age: 18}
+	panicNotNil(table.Set("jason", &jason))
+
+	var nilPerson *Person
+	for _, value := range []interface{}{nil, nilPerson} {
+		if table.Set("jason", value) != ErrNilValue {
+			t.Fatal("error should be ErrNilValue, but isn't")
+		}
+
+		if table.Insert("ben", value) != ErrNilValue {
+			t.Fatal("error should be ErrNilValue, but isn't")
+		}
+	}
+
+	err = table.Update("jason", func(p Person) (*Person, error) {
+		return nil, nil
+	})
+	if err != ErrNilValue {
+		t.Fatal("error should be ErrNilValue, but is", err)
+	}
+
+	// The document and its index entry are left untouched.
+	expectPerson("jason", table.Index("City").GetAll("Sydney"), jason)
+
+	_, err = table.Get("ben", nil)
+	if err != ErrNotFound {
+		t.Fatal("error should be ErrNotFound, but isn't")
+	}
+
+	// Documents are removed with Delete, after which they don't exist.
+	panicNotNil(table.Delete("jason"))
+
+	_, err = table.Get("jason", nil)
+	if err != ErrNotFound {
+		t.Fatal("error should be ErrNotFound, but isn't")
+	}
+
+	n, err := table.Index("City").GetAll("Sydney").Count()
+	panicNotNil(err)
+
+	if n != 0 {
+		t.Fatal("count should be 0, but is", n)
+	}
+}
+
+func BenchmarkTableSet(b *testing.B) {
+	benchmarks := []struct {
+		name    string
+		indexes []string
+	}{
+		{"NoIndexes", nil},
+		{"Indexed", []string{"City", "Age"}},
+	}
+
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			dir, err := ioutil.TempDir("", "jvzc_")
+			panicNotNil(err)
+			defer os.RemoveAll(dir)
+
+			db, err := Open(dir + "/data")
+			panicNotNil(err)
+			defer db.Close()
+
+			panicNotNil(db.NewTable("bench"))
+			table := db.Table("bench")
+			for _, index := range bm.indexes {
+				panicNotNil(table.NewIndex(index))
+			}
+
+			b.ReportAllocs()
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				panicNotNil(table.Set(strconv.Itoa(i%100),
+					Person{Name: "Jason", City: "Sydney", Age: i}))
+			}
+		})
+	}
+}
+
+func TestTablesAndIndexesSorted(t *testing.T) {
+	if testing.Short() {
+		t.Parallel()
+	}
+
+	dir, err := ioutil.TempDir("", "jvzc_")
+	panicNotNil(err)
+
+	t.Log("testing directory:", dir)
+	defer func() {
+		if !t.Failed() {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	db, err := Open(dir + "/data")
+	panicNotNil(err)
+
+	defer db.Close()
+
+	for _, name := range []string{"people", "cities", "tags"} {
+		panicNotNil(db.NewTable(name))
+	}
+
+	table := db.Table("people")
+	for _, name := range []string{"Name", "Age", "City"} {
+		panicNotNil(table.NewIndex(name))
+	}
+
+	if strings.Join(db.Tables(), ",") != "cities,people,tags" {
+		t.Fatal("tables should be sorted, but aren't:", db.Tables())
+	}
+
+	if strings.Join(table.Indexes(), ",") != "Age,City,Name" {
+		t.Fatal("indexes should be sorted, but aren't:", table.Indexes())
+	}
+}
+
+func TestTableDeleteWhere(t *testing.T) {
+	if testing.Short() {
+		t.Parallel()
+	}
+
+	dir, err := ioutil.TempDir("", "jvzc_")
+	panicNotNil(err)
+
+	t.Log("testing directory:", dir)
+	defer func() {
+		if !t.Failed() {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	db, err := Open(dir + "/data")
+	panicNotNil(err)
+
+	defer db.Close()
+
+	panicNotNil(db.NewTable("indexed_testing"))
+	indexed := db.Table("indexed_testing")
+	panicNotNil(indexed.NewIndex("City"))
+
+	panicNotNil(db.NewTable("plain_testing"))
+	plain := db.Table("plain_testing")
+
+	for i := 0; i < 2500; i++ {
+		key := strconv.Itoa(10000 + i)
+		person := Person{Name: key, City: []string{"Sydney", "Perth"}[i%2]}
+
+		if i < 100 {
+			panicNotNil(indexed.Set(key, person))
+		}
+
+		panicNotNil(plain.Set(key, person))
+	}
+
+	odd := func(key string, raw []byte) (bool, error) {
+		n, err := strconv.Atoi(key)
+		return n%2 == 1, err
+	}
+
+	n, err := plain.DeleteWhere(odd)
+	panicNotNil(err)
+
+	if n != 1250 {
+		t.Fatal("1250 documents should be deleted, but", n, "were")
+	}
+
+	if plain.CountBetween(MinValue, MaxValue) != 1250 {
+		t.Fatal("1250 documents should remain, but don't")
+	}
+
+	n, err = indexed.DeleteWhere(odd)
+	panicNotNil(err)
+
+	if n != 50 {
+		t.Fatal("50 documents should be deleted, but", n, "were")
+	}
+
+	count, err := indexed.Index("City").GetAll("Perth").Count()
+	panicNotNil(err)
+
+	if count != 0 {
+		t.Fatal("no documents should remain in Perth, but", count, "do")
+	}
+
+	testError := errors.New("jvzc testing: test error")
+	n, err = plain.DeleteWhere(func(key string, raw []byte) (bool, error) {
+		if key == "10100" {
+			return false, testError
+		}
+
+		return true, nil
+	})
+	if err != testError || n != 0 {
+		t.Fatal("error should be testError with 0 deleted, but is", err,
+			"with", n)
+	}
+}
+
+func TestTableNames(t *testing.T) {
+	if testing.Short() {
+		t.Parallel()
+	}
+
+	dir, err := ioutil.TempDir("", "jvzc_")
+	panicNotNil(err)
+
+	t.Log("testing directory:", dir)
+	defer func() {
+		if !t.Failed() {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	db, err := Open(dir + "/data")
+	panicNotNil(err)
+
+	panicNotNil(db.NewTable("people"))
+	panicNotNil(db.Table("people").NewIndex("City"))
+	index := db.Table("people").Index("City")
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 10; i++ {
+			name := "other_" + strconv.Itoa(i)
+			panicNotNil(db.NewTable(name))
+			panicNotNil(db.Table(name).Drop())
+		}
+	}()
+
+	for i := 0; i < 100; i++ {
+		if index.name() != "people/City" {
+			t.Fatal("index name should be people/City, but is", index.name())
+		}
+	}
+
+	wg.Wait()
+	db.Close()
+
+	db, err = Open(dir + "/data")
+	panicNotNil(err)
+
+	defer db.Close()
+
+	if db.Table("people").Index("City").name() != "people/City" {
+		t.Fatal("index name should be people/City after reopening, but is",
+			db.Table("people").Index("City").name())
+	}
+
+	index = db.Table("people").Index("City")
+	panicNotNil(index.Drop())
+	if err = index.Drop(); err != ErrNotFound {
+		t.Fatal("error should be ErrNotFound, but is", err)
+	}
+
+	table := db.Table("people")
+	panicNotNil(table.Drop())
+	if err = table.Drop(); err != ErrNotFound {
+		t.Fatal("error should be ErrNotFound, but is", err)
+	}
+}
+
+func TestTableDir(t *testing.T) {
+	if testing.Short() {
+		t.Parallel()
+	}
+
+	dir, err := ioutil.TempDir("", "jvzc_")
+	panicNotNil(err)
+
+	t.Log("testing directory:", dir)
+	defer func() {
+		if !t.Failed() {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	db, err := Open(dir + "/data")
+	panicNotNil(err)
+
+	defer db.Close()
+
+	if db.Path() != dir+"/data" {
+		t.Fatal("path should be", dir+"/data", "but is", db.Path())
+	}
+
+	panicNotNil(db.NewTable("people"))
+
+	expected := dir + "/data/" + Name("people").Hex()
+	if db.Table("people").Dir() != expected {
+		t.Fatal("dir should be", expected, "but is", db.Table("people").Dir())
+	}
+
+	if ex, _ := exists(db.Table("people").Dir()); !ex {
+		t.Fatal("dir should exist, but doesn't")
+	}
+
+	if db.Table("people").DataDir() != expected+"/data" {
+		t.Fatal("data dir should be", expected+"/data", "but is",
+			db.Table("people").DataDir())
+	}
+}
+
+func TestTableDeleteRange(t *testing.T) {
+	if testing.Short() {
+		t.Parallel()
+	}
+
+	dir, err := ioutil.TempDir("", "jvzc_")
+	panicNotNil(err)
+
+	t.Log("testing directory:", dir)
+	defer func() {
+		if !t.Failed() {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	db, err := Open(dir + "/data")
+	panicNotNil(err)
+
+	defer db.Close()
+
+	panicNotNil(db.NewTable("indexed_testing"))
+	indexed := db.Table("indexed_testing")
+	panicNotNil(indexed.NewIndex("City"))
+
+	panicNotNil(db.NewTable("plain_testing"))
+	plain := db.Table("plain_testing")
+
+	for i := 0; i < 2500; i++ {
+		key := strconv.Itoa(10000 + i)
+		person := Person{Name: key, City: []string{"Sydney", "Perth"}[i%2]}
+
+		if i < 100 {
+			panicNotNil(indexed.Set(key, person))
+		}
+
+		panicNotNil(plain.Set(key, person))
+	}
+
+	n, err := indexed.DeleteRange("10020", "10059")
+	panicNotNil(err)
+
+	if n != 40 {
+		t.Fatal("40 documents should be deleted, but", n, "were")
+	}
+
+	if indexed.CountBetween(MinValue, MaxValue) != 60 {
+		t.Fatal("60 documents should remain, but don't")
+	}
+
+	count, err := indexed.Index("City").GetAll("Sydney").Count()
+	panicNotNil(err)
+
+	if count != 30 {
+		t.Fatal("30 documents should remain in Sydney, but", count, "do")
+	}
+
+	n, err = plain.DeleteRange(MinValue, "12200")
+	panicNotNil(err)
+
+	if n != 2201 {
+		t.Fatal("2201 documents should be deleted, but", n, "were")
+	}
+
+	if plain.CountBetween(MinValue, MaxValue) != 299 {
+		t.Fatal("299 documents should remain, but don't")
+	}
+
+	report, err := db.Check()
+	panicNotNil(err)
+
+	if !report.OK() {
+		t.Fatal("indexes should be consistent, but aren't:", report)
+	}
+}
+
+func TestTableOpCounts(t *testing.T) {
+	if testing.Short() {
+		t.Parallel()
+	}
+
+	dir, err := ioutil.TempDir("", "jvzc_")
+	panicNotNil(err)
+
+	t.Log("testing directory:", dir)
+	defer func() {
+		if !t.Failed() {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	db, err := Open(dir + "/data")
+	panicNotNil(err)
+
+	defer db.Close()
+
+	panicNotNil(db.NewTable("counts_testing"))
+	table := db.Table("counts_testing")
+	panicNotNil(table.NewIndex("City"))
+
+	if table.OpCounts() != (OpCounts{}) {
+		t.Fatal("counts should be zero, but aren't")
+	}
+
+	jason := Person{Name: "Jason", City: "Sydney", Age: 18}
+	panicNotNil(table.Set("jason", jason))
+	panicNotNil(table.Set("ben", jason))
+	panicNotNil(table.Delete("ben"))
+
+	var person Person
+	_, err = table.Get("jason", &person)
+	panicNotNil(err)
+
+	if _, err = table.Get("ben", &person); err != ErrNotFound {
+		t.Fatal("error should be ErrNotFound, but is", err)
+	}
+
+	r := table.All()
+	r.Close()
+	r = table.Index("City").Between(MinValue, MaxValue)
+	r.Close()
+	r = table.Index("City").GetAll("Sydney")
+	r.Close()
+
+	r, err = table.Query(map[string]interface{}{"City": "Sydney"})
+	panicNotNil(err)
+	r.Close()
+
+	_, _, err = table.Index("City").Page("Sydney", "", 10)
+	panicNotNil(err)
+
+	// Page reads the document of jason by its key.
+	counts := table.OpCounts()
+	if counts != (OpCounts{Gets: 3, Sets: 2, Deletes: 1, Ranges: 5}) {
+		t.Fatal("counts should be 3 gets, 2 sets, 1 delete and 5 ranges, "+
+			"but are", counts)
+	}
+}
+
+func TestTableGetExists(t *testing.T) {
+	if testing.Short() {
+		t.Parallel()
+	}
+
+	dir, err := ioutil.TempDir("", "jvzc_")
+	panicNotNil(err)
+
+	t.Log("testing directory:", dir)
+	defer func() {
+		if !t.Failed() {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	db, err := Open(dir + "/data")
+	panicNotNil(err)
+
+	defer db.Close()
+
+	panicNotNil(db.NewTable("exists_testing", false))
+	table := db.Table("exists_testing")
+
+	jason := Person{Name: "Jason", City: "Sydney", Age: 18}
+	panicNotNil(table.Set("jason", jason))
+	panicNotNil(table.Set("empty", struct{}{}))
+	panicNotNil(table.data.Set(table.dataKey("blank"), []byte{}, 0))
+	panicNotNil(table.Set("deleted", jason))
+	panicNotNil(table.Delete("deleted"))
+
+	var person Person
+	found, counter, err := table.GetExists("jason", &person)
+	panicNotNil(err)
+	if !found || counter == 0 || !person.IsSame(jason) {
+		t.Fatal("jason should be found, but isn't")
+	}
+
+	// An empty struct is stored as an empty map, which is found by Get.
+	var empty struct{}
+	if _, err = table.Get("empty", &empty); err != nil {
+		t.Fatal("empty document should be found by Get, but isn't:", err)
+	}
+
+	found, _, err = table.GetExists("empty", &empty)
+	panicNotNil(err)
+	if !found {
+		t.Fatal("empty document should be found, but isn't")
+	}
+
+	// An empty value isn't found by Get, but exists.
+	if _, err = table.Get("blank", nil); err != ErrNotFound {
+		t.Fatal("error should be ErrNotFound, but is", err)
+	}
+
+	found, counter, err = table.GetExists("blank", nil)
+	panicNotNil(err)
+	if !found || counter == 0 {
+		t.Fatal("blank document should be found, but isn't")
+	}
+
+	found, _, err = table.GetExists("blank", &person)
+	if !found || err != ErrEmptyValue {
+		t.Fatal("blank document should be found with ErrEmptyValue, "+
+			"but is", found, err)
+	}
+
+	for _, key := range []string{"deleted", "missing"} {
+		found, counter, err = table.GetExists(key, &person)
+		panicNotNil(err)
+		if found || counter != 0 {
+			t.Fatal(key + " should not be found, but is")
+		}
+	}
+}
+
+func TestTableCompareAndSetMulti(t *testing.T) {
+	if testing.Short() {
+		t.Parallel()
+	}
+
+	dir, err := ioutil.TempDir("", "jvzc_")
+	panicNotNil(err)
+
+	t.Log("testing directory:", dir)
+	defer func() {
+		if !t.Failed() {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	db, err := Open(dir + "/data")
+	panicNotNil(err)
+
+	defer db.Close()
+
+	panicNotNil(db.NewTable("multi_testing"))
+	table := db.Table("multi_testing")
+	panicNotNil(table.NewIndex("City"))
+
+	jason := Person{Name: "Jason", City: "Sydney", Age: 18}
+	ben := Person{Name: "Ben", City: "Melbourne", Age: 19}
+	panicNotNil(table.Set("jason", jason))
+	panicNotNil(table.Set("ben", ben))
+
+	jasonCounter, err := table.Get("jason", nil)
+	panicNotNil(err)
+	benCounter, err := table.Get("ben", nil)
+	panicNotNil(err)
+
+	// A stale counter for one key writes nothing.
+	panicNotNil(table.Set("ben", ben))
+
+	jason.City = "Perth"
+	ben.City = "Perth"
+	err = table.CompareAndSetMulti(map[string]interface{}{
+		"jason": jason,
+		"ben":   ben,
+		"drew":  Person{Name: "Drew", City: "Perth"},
+	}, map[string]uint64{
+		"jason": jasonCounter,
+		"ben":   benCounter,
+		"drew":  0,
+	})
+	if !errors.Is(err, ErrCounterChanged) || !strings.Contains(err.Error(), "ben") {
+		t.Fatal("error should be ErrCounterChanged for ben, but is", err)
+	}
+
+	count, err := table.Index("City").GetAll("Perth").Count()
+	panicNotNil(err)
+	if count != 0 {
+		t.Fatal("nothing should be written, but", count, "documents were")
+	}
+
+	benCounter, err = table.Get("ben", nil)
+	panicNotNil(err)
+
+	panicNotNil(table.CompareAndSetMulti(map[string]interface{}{
+		"jason": jason,
+		"ben":   ben,
+		"drew":  Person{Name: "Drew", City: "Perth"},
+	}, map[string]uint64{
+		"jason": jasonCounter,
+		"ben":   benCounter,
+		"drew":  0,
+	}))
+
+	var results []Person
+	panicNotNil(table.Index("City").GetAll("Perth").All(&results))
+	if len(results) != 3 {
+		t.Fatal("3 documents should be in Perth, but", len(results), "are")
+	}
+
+	count, err = table.Index("City").GetAll("Sydney").Count()
+	panicNotNil(err)
+	if count != 0 {
+		t.Fatal("no documents should be in Sydney, but", count, "are")
+	}
+
+	// Keys which are only checked aren't written.
+	jasonCounter, err = table.Get("jason", nil)
+	panicNotNil(err)
+
+	err = table.CompareAndSetMulti(map[string]interface{}{
+		"ben": Person{Name: "Ben", City: "Sydney"},
+	}, map[string]uint64{"jason": jasonCounter + 1})
+	if !errors.Is(err, ErrCounterChanged) {
+		t.Fatal("error should be ErrCounterChanged, but is", err)
+	}
+
+	panicNotNil(table.CompareAndSetMulti(map[string]interface{}{
+		"ben": Person{Name: "Ben", City: "Sydney"},
+	}, map[string]uint64{"jason": jasonCounter}))
+
+	newCounter, err := table.Get("jason", nil)
+	panicNotNil(err)
+	if newCounter != jasonCounter {
+		t.Fatal("jason should not be written, but was")
+	}
+
+	var person Person
+	_, err = table.Get("ben", &person)
+	panicNotNil(err)
+	if person.City != "Sydney" {
+		t.Fatal("ben should be in Sydney, but isn't")
+	}
+}
@@ -0,0 +1,83 @@
+package jvzc
+
+import "context"
+
+// Tail returns a channel of the documents in the table with keys from the
+// given lower bound onwards, in ascending order by key, which then continues
+// to receive documents as they are written to the table. from must be a
+// string or a Bounds, like with Between.
+//
+// Tail is designed for tables whose keys increase with every new document,
+// such as event logs keyed by time. Only documents with keys greater than
+// the last emitted key are followed, so documents written with smaller keys
+// will not be emitted.
+//
+// Tailing stops when the context is cancelled or an error is encountered, in
+// which case the error is sent on the error channel. Both channels are
+// closed when tailing stops.
+func (t *Table) Tail(ctx context.Context,
+	from interface{}) (<-chan Document, <-chan error) {
+	docs := make(chan Document)
+	errs := make(chan error, 1)
+
+	// The listener is registered before the table is read, so that
+	// documents written while it is being read are not missed.
+	changed := make(chan struct{}, 1)
+	removeListener := t.addListener(func(key string) {
+		select {
+		case changed <- struct{}{}:
+		default:
+		}
+	})
+
+	go func() {
+		defer close(docs)
+		defer close(errs)
+		defer removeListener()
+
+		lower := from
+		var lastKey string
+		emitted := false
+
+		for {
+			r := t.Between(lower, MaxValue)
+
+			for r.Next() {
+				if emitted && r.Key() == lastKey {
+					continue
+				}
+
+				select {
+				case docs <- r.Document():
+				case <-ctx.Done():
+					r.Close()
+					errs <- ctx.Err()
+					return
+				}
+
+				lastKey = r.Key()
+				emitted = true
+			}
+
+			r.Close()
+
+			if r.Error() != ErrEndOfRange {
+				errs <- r.Error()
+				return
+			}
+
+			if emitted {
+				lower = lastKey
+			}
+
+			select {
+			case <-changed:
+			case <-ctx.Done():
+				errs <- ctx.Err()
+				return
+			}
+		}
+	}()
+
+	return docs, errs
+}
@@ -0,0 +1,73 @@
+package jvzc
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestTableTail(t *testing.T) {
+	if testing.Short() {
+		t.Parallel()
+	}
+
+	dir, err := ioutil.TempDir("", "jvzc_")
+	panicNotNil(err)
+
+	t.Log("testing directory:", dir)
+	defer func() {
+		if !t.Failed() {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	db, err := Open(dir + "/data")
+	panicNotNil(err)
+
+	defer db.Close()
+
+	panicNotNil(db.NewTable("tail_testing"))
+
+	table := db.Table("tail_testing")
+	panicNotNil(table.Set("001", Person{Name: "Jason", Age: 1}))
+	panicNotNil(table.Set("002", Person{Name: "Ben", Age: 2}))
+	panicNotNil(table.Set("003", Person{Name: "Drew", Age: 3}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	docs, errs := table.Tail(ctx, "002")
+
+	expectAge := func(age int) {
+		select {
+		case doc := <-docs:
+			var person Person
+			panicNotNil(doc.Decode(&person))
+			if person.Age != age {
+				t.Fatal("age should be", age, "but is", person.Age)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("document should be emitted, but isn't")
+		}
+	}
+
+	expectAge(2)
+	expectAge(3)
+
+	panicNotNil(table.Set("004", Person{Name: "Matheus", Age: 4}))
+	expectAge(4)
+
+	// Documents with smaller keys are not followed.
+	panicNotNil(table.Set("000", Person{Name: "Old", Age: 0}))
+	panicNotNil(table.Set("005", Person{Name: "Lisa", Age: 5}))
+	expectAge(5)
+
+	cancel()
+
+	for range docs {
+	}
+
+	if <-errs != context.Canceled {
+		t.Fatal("error should be context.Canceled, but isn't")
+	}
+}
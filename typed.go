@@ -0,0 +1,61 @@
+//go:build go1.18
+
+package jvzc
+
+// Typed wraps a table to get and set documents of a single type, without
+// the need to pass pointers or interface{} values at call sites.
+type Typed[T any] struct {
+	t *Table
+}
+
+// NewTyped returns a Typed wrapper around the table for documents of type T.
+func NewTyped[T any](t *Table) *Typed[T] {
+	return &Typed[T]{t: t}
+}
+
+// Table returns the underlying untyped table.
+func (t *Typed[T]) Table() *Table {
+	return t.t
+}
+
+// Get retrieves a document from the table with its primary key, along with
+// its counter. ErrNotFound will be returned if the document does not exist.
+func (t *Typed[T]) Get(key string) (T, uint64, error) {
+	var value T
+	counter, err := t.t.Get(key, &value)
+	return value, counter, err
+}
+
+// Set sets a document in the table. An optional counter value can be
+// provided to only set the document if the counter value is the same, like
+// with Table.Set.
+func (t *Typed[T]) Set(key string, value T, counter ...uint64) error {
+	return t.t.Set(key, value, counter...)
+}
+
+// All returns a TypedRange of all the documents in the table, sorted in
+// ascending order by key. You can reverse the sorting by specifying true to
+// the optional reverse parameter.
+func (t *Typed[T]) All(reverse ...bool) *TypedRange[T] {
+	return &TypedRange[T]{Range: t.t.All(reverse...)}
+}
+
+// TypedRange is a Range of documents of type T.
+type TypedRange[T any] struct {
+	*Range
+}
+
+// Value returns the current document.
+func (r *TypedRange[T]) Value() (T, error) {
+	var value T
+	err := r.Decode(&value)
+	return value, err
+}
+
+// All returns all of the remaining documents in the range. A nil error will
+// be returned if the range reaches ErrEndOfRange.
+func (r *TypedRange[T]) All() ([]T, error) {
+	var values []T
+	err := r.Range.All(&values)
+	return values, err
+}
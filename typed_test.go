@@ -0,0 +1,77 @@
+//go:build go1.18
+
+package jvzc
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestTyped(t *testing.T) {
+	if testing.Short() {
+		t.Parallel()
+	}
+
+	dir, err := ioutil.TempDir("", "jvzc_")
+	panicNotNil(err)
+
+	t.Log("testing directory:", dir)
+	defer func() {
+		if !t.Failed() {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	db, err := Open(dir + "/data")
+	panicNotNil(err)
+
+	defer db.Close()
+
+	panicNotNil(db.NewTable("typed_testing"))
+
+	people := NewTyped[Person](db.Table("typed_testing"))
+
+	jason := Person{Name: "Jason", City: "Sydney", Age: 18}
+	ben := Person{Name: "Ben", City: "Melbourne", Age: 19}
+
+	panicNotNil(people.Set("jason", jason))
+	panicNotNil(people.Set("ben", ben))
+
+	person, counter, err := people.Get("jason")
+	panicNotNil(err)
+
+	if !person.IsSame(jason) {
+		t.Fatal("person should be jason, but isn't")
+	}
+
+	if people.Set("jason", ben, counter+1) != ErrCounterChanged {
+		t.Fatal("error should be ErrCounterChanged, but isn't")
+	}
+
+	panicNotNil(people.Set("jason", jason, counter))
+
+	_, _, err = people.Get("drew")
+	if err != ErrNotFound {
+		t.Fatal("error should be ErrNotFound, but isn't")
+	}
+
+	r := people.All()
+	if !r.Next() || r.Key() != "ben" {
+		t.Fatal("key should be ben, but isn't")
+	}
+
+	person, err = r.Value()
+	panicNotNil(err)
+
+	if !person.IsSame(ben) {
+		t.Fatal("person should be ben, but isn't")
+	}
+
+	rest, err := r.All()
+	panicNotNil(err)
+
+	if len(rest) != 1 || !rest[0].IsSame(jason) {
+		t.Fatal("rest should be jason, but isn't")
+	}
+}
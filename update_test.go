@@ -6,6 +6,9 @@ import (
 	"os"
 	"sync"
 	"testing"
+	"time"
+
+	"github.com/1lann/msgpack"
 )
 
 type Counter struct {
@@ -146,4 +149,301 @@ func TestUpdateErrors(t *testing.T) {
 	if err != testError {
 		t.Fatal("error should be testError, but isn't")
 	}
+
+	err = db.Table("table_update").Update("test",
+		func(c Counter) (Counter, error) {
+			c.Count++
+			return c, ErrNoChange
+		})
+	panicNotNil(err)
+
+	var counter Counter
+	_, err = db.Table("table_update").Get("test", &counter)
+	panicNotNil(err)
+
+	if counter.Count != 0 {
+		t.Fatal("count should be 0, but is", counter.Count)
+	}
+}
+
+func TestUpdateWithOptions(t *testing.T) {
+	if testing.Short() {
+		t.Parallel()
+	}
+
+	dir, err := ioutil.TempDir("", "jvzc_")
+	panicNotNil(err)
+
+	t.Log("testing directory:", dir)
+	defer func() {
+		if !t.Failed() {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	db, err := Open(dir + "/data")
+	panicNotNil(err)
+
+	defer db.Close()
+
+	panicNotNil(db.NewTable("table_update"))
+	panicNotNil(db.Table("table_update").Set("test", Counter{Count: 0}))
+
+	attempts := 0
+	start := time.Now()
+	err = db.Table("table_update").UpdateWithOptions("test",
+		func(c Counter) (Counter, error) {
+			attempts++
+			// Change the document from under the update to force a retry.
+			panicNotNil(db.Table("table_update").Set("test", Counter{
+				Count: c.Count + 1,
+			}))
+			return c, nil
+		}, UpdateOptions{
+			MaxAttempts: 3,
+			MinBackoff:  10 * time.Millisecond,
+			MaxBackoff:  15 * time.Millisecond,
+		})
+	if !errors.Is(err, ErrCounterChanged) {
+		t.Fatal("error should wrap ErrCounterChanged, but doesn't")
+	}
+
+	if attempts != 3 {
+		t.Fatal("attempts should be 3, but is", attempts)
+	}
+
+	if time.Since(start) < 10*time.Millisecond {
+		t.Fatal("update should back off between attempts, but doesn't")
+	}
+
+	err = db.Table("table_update").UpdateWithOptions("test",
+		func(c Counter) (Counter, error) {
+			c.Count++
+			return c, nil
+		}, UpdateOptions{MaxAttempts: 1})
+	panicNotNil(err)
+
+	var counter Counter
+	_, err = db.Table("table_update").Get("test", &counter)
+	panicNotNil(err)
+
+	if counter.Count != 4 {
+		t.Fatal("count should be 4, but is", counter.Count)
+	}
+}
+
+func TestUpdateReturning(t *testing.T) {
+	if testing.Short() {
+		t.Parallel()
+	}
+
+	dir, err := ioutil.TempDir("", "jvzc_")
+	panicNotNil(err)
+
+	t.Log("testing directory:", dir)
+	defer func() {
+		if !t.Failed() {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	db, err := Open(dir + "/data")
+	panicNotNil(err)
+
+	defer db.Close()
+
+	panicNotNil(db.NewTable("table_update"))
+	panicNotNil(db.Table("table_update").Set("test", Counter{Count: 0}))
+
+	var mutex sync.Mutex
+	seen := make(map[int]bool)
+
+	wg := new(sync.WaitGroup)
+	wg.Add(20)
+
+	for i := 0; i < 20; i++ {
+		go func() {
+			defer wg.Done()
+
+			oldRaw, newRaw, uErr := db.Table("table_update").UpdateReturning(
+				"test", func(c Counter) (Counter, error) {
+					c.Count++
+					return c, nil
+				})
+			panicNotNil(uErr)
+
+			var old, new Counter
+			panicNotNil(msgpack.Unmarshal(oldRaw, &old))
+			panicNotNil(msgpack.Unmarshal(newRaw, &new))
+
+			if new.Count != old.Count+1 {
+				panic("new count should follow old count, but doesn't")
+			}
+
+			mutex.Lock()
+			if seen[old.Count] {
+				panic("old count should only be seen once, but isn't")
+			}
+			seen[old.Count] = true
+			mutex.Unlock()
+		}()
+	}
+
+	wg.Wait()
+
+	if len(seen) != 20 {
+		t.Fatal("20 updates should be returned, but", len(seen), "are")
+	}
+
+	_, _, err = db.Table("table_update").UpdateReturning("missing",
+		func(c Counter) (Counter, error) {
+			return c, nil
+		})
+	if err != ErrNotFound {
+		t.Fatal("error should be ErrNotFound, but isn't")
+	}
+}
+
+func TestUpdateMany(t *testing.T) {
+	if testing.Short() {
+		t.Parallel()
+	}
+
+	dir, err := ioutil.TempDir("", "jvzc_")
+	panicNotNil(err)
+
+	t.Log("testing directory:", dir)
+	defer func() {
+		if !t.Failed() {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	db, err := Open(dir + "/data")
+	panicNotNil(err)
+
+	defer db.Close()
+
+	panicNotNil(db.NewTable("update_many_testing"))
+	table := db.Table("update_many_testing")
+
+	for _, key := range []string{"a", "b", "c"} {
+		panicNotNil(table.Set(key, Counter{Count: 1}))
+	}
+
+	errs := table.UpdateMany([]string{"a", "missing", "b", "c"},
+		func(c Counter) (Counter, error) {
+			c.Count++
+			return c, nil
+		})
+
+	if len(errs) != 1 || errs["missing"] != ErrNotFound {
+		t.Fatal("errors should only have missing, but are", errs)
+	}
+
+	for _, key := range []string{"a", "b", "c"} {
+		var c Counter
+		_, err = table.Get(key, &c)
+		panicNotNil(err)
+
+		if c.Count != 2 {
+			t.Fatal("count should be 2, but is", c.Count)
+		}
+	}
+
+	errs = table.UpdateMany([]string{"a", "b"}, func() {})
+	if len(errs) != 2 || errs["a"] == nil || errs["b"] == nil {
+		t.Fatal("every key should have an error, but doesn't")
+	}
+}
+
+func TestUpdater(t *testing.T) {
+	if testing.Short() {
+		t.Parallel()
+	}
+
+	dir, err := ioutil.TempDir("", "jvzc_")
+	panicNotNil(err)
+
+	t.Log("testing directory:", dir)
+	defer func() {
+		if !t.Failed() {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	db, err := Open(dir + "/data")
+	panicNotNil(err)
+
+	defer db.Close()
+
+	panicNotNil(db.NewTable("updater_testing"))
+	table := db.Table("updater_testing")
+	panicNotNil(table.Set("a", Counter{Count: 1}))
+
+	if _, err = table.Updater(func(c Counter) Counter {
+		return c
+	}); err == nil {
+		t.Fatal("handler should be invalid, but isn't")
+	}
+
+	u, err := table.Updater(func(c Counter) (Counter, error) {
+		c.Count++
+		return c, nil
+	})
+	panicNotNil(err)
+
+	for i := 0; i < 3; i++ {
+		panicNotNil(u.Apply("a"))
+	}
+
+	if u.Apply("missing") != ErrNotFound {
+		t.Fatal("error should be ErrNotFound, but isn't")
+	}
+
+	var c Counter
+	_, err = table.Get("a", &c)
+	panicNotNil(err)
+
+	if c.Count != 4 {
+		t.Fatal("count should be 4, but is", c.Count)
+	}
+}
+
+func BenchmarkUpdate(b *testing.B) {
+	dir, err := ioutil.TempDir("", "jvzc_")
+	panicNotNil(err)
+	defer os.RemoveAll(dir)
+
+	db, err := Open(dir + "/data")
+	panicNotNil(err)
+	defer db.Close()
+
+	panicNotNil(db.NewTable("bench"))
+	table := db.Table("bench")
+	panicNotNil(table.Set("counter", Counter{}))
+
+	handler := func(c Counter) (Counter, error) {
+		c.Count++
+		return c, nil
+	}
+
+	b.Run("Update", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			panicNotNil(table.Update("counter", handler))
+		}
+	})
+
+	b.Run("Updater", func(b *testing.B) {
+		u, err := table.Updater(handler)
+		panicNotNil(err)
+
+		b.ReportAllocs()
+		b.ResetTimer()
+
+		for i := 0; i < b.N; i++ {
+			panicNotNil(u.Apply("counter"))
+		}
+	})
 }
@@ -0,0 +1,301 @@
+package jvzc
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"io"
+	"io/ioutil"
+
+	"github.com/1lann/badger"
+)
+
+// Compression represents the codec used to compress the values of a table.
+type Compression byte
+
+// Supported value compression codecs.
+const (
+	NoCompression Compression = iota
+	FlateCompression
+)
+
+// valueHeader marks a stored value which has been transformed after being
+// marshalled, and is followed by a byte of value flags. 0xc1 is never used
+// by msgpack, so plain msgpack documents written without any transformations
+// (including those written by older versions) can never be mistaken for a
+// transformed value.
+const valueHeader = 0xc1
+
+const (
+	flagFlate = 1 << iota
+	flagAESGCM
+	flagMeta
+	flagVersion
+)
+
+var errBadValue = errors.New("jvzc: malformed stored value")
+
+// SetCompression sets the codec used to compress the values of documents
+// written to the table from now on. Existing documents are not rewritten, but
+// documents written with any codec (or none at all) can always be read back.
+func (t *Table) SetCompression(compression Compression) error {
+	if compression > FlateCompression {
+		return errors.New("jvzc: unsupported compression")
+	}
+
+	if err := t.db.lockConfig(); err != nil {
+		return err
+	}
+	defer t.db.configMutex.Unlock()
+
+	tableName := t.name()
+	for i, table := range t.db.config.Tables {
+		if table.TableName == tableName {
+			t.db.config.Tables[i].Compression = compression
+			if err := t.db.writeConfig(); err != nil {
+				t.db.config.Tables[i].Compression = t.compression
+				return err
+			}
+
+			t.compression = compression
+			return nil
+		}
+	}
+
+	return ErrNotFound
+}
+
+// SetMaxValueSize sets the maximum size in bytes of the marshalled documents
+// written to the table from now on, before they are compressed. Writing a
+// larger document returns ErrValueTooLarge without writing it, which
+// protects the value log from being bloated by runaway documents. 0 sets the
+// limit to the ValueLogFileSize of the options the database was opened with,
+// which is the largest value the underlying storage can store.
+func (t *Table) SetMaxValueSize(size int64) error {
+	if size < 0 {
+		return errors.New("jvzc: invalid maximum value size")
+	}
+
+	if err := t.db.lockConfig(); err != nil {
+		return err
+	}
+	defer t.db.configMutex.Unlock()
+
+	tableName := t.name()
+	for i, table := range t.db.config.Tables {
+		if table.TableName == tableName {
+			t.db.config.Tables[i].MaxValueSize = size
+			if err := t.db.writeConfig(); err != nil {
+				t.db.config.Tables[i].MaxValueSize = t.maxValueSize
+				return err
+			}
+
+			t.maxValueSize = size
+			return nil
+		}
+	}
+
+	return ErrNotFound
+}
+
+// valueSizeLimit returns the maximum size of marshalled documents.
+func (t *Table) valueSizeLimit() int64 {
+	if t.maxValueSize > 0 {
+		return t.maxValueSize
+	}
+
+	return t.db.openOptions.ValueLogFileSize
+}
+
+// SetEncryptionKey enables encryption at rest of the values of all documents
+// written from now on, using AES-GCM with the given 16, 24 or 32 byte key.
+// Each value is encrypted with its own random nonce after it has been
+// compressed. The same key must be set every time the database is opened to
+// read encrypted documents, otherwise ErrNoEncryptionKey will be returned.
+//
+// Note that only document values are encrypted. Primary keys, index keys
+// (which are derived from document values), and the field names in the
+// key compression map of the database configuration are stored in plaintext.
+//
+// It may be called while documents are being read and written, in which
+// case each document is encrypted with either the previous or the new key.
+func (d *DB) SetEncryptionKey(key []byte) error {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return err
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return err
+	}
+
+	d.cipher.Store(aead)
+	return nil
+}
+
+// aead returns the cipher set by SetEncryptionKey, or nil if no encryption
+// key is set.
+func (d *DB) aead() cipher.AEAD {
+	aead, _ := d.cipher.Load().(cipher.AEAD)
+	return aead
+}
+
+// encodeValue transforms a marshalled document into the representation
+// which is stored on disk. The metadata is only stored if metadata is
+// enabled for the table, and the schema version is only stored if the table
+// has migrators.
+func (t *Table) encodeValue(data []byte, meta Meta) ([]byte, error) {
+	if int64(len(data)) > t.valueSizeLimit() {
+		return nil, ErrValueTooLarge
+	}
+
+	aead := t.db.aead()
+	version := t.schemaVersion()
+	if t.compression == NoCompression && aead == nil && !t.metadata &&
+		version == 0 {
+		return data, nil
+	}
+
+	var flags byte
+
+	if t.metadata {
+		data = append(encodeMeta(meta), data...)
+		flags |= flagMeta
+	}
+
+	if version > 0 {
+		data = append([]byte{byte(version)}, data...)
+		flags |= flagVersion
+	}
+
+	if t.compression == FlateCompression {
+		var buf bytes.Buffer
+		w, err := flate.NewWriter(&buf, flate.DefaultCompression)
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err = w.Write(data); err != nil {
+			return nil, err
+		}
+
+		if err = w.Close(); err != nil {
+			return nil, err
+		}
+
+		data = buf.Bytes()
+		flags |= flagFlate
+	}
+
+	if aead != nil {
+		nonce := make([]byte, aead.NonceSize(),
+			aead.NonceSize()+len(data)+aead.Overhead())
+		if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+			return nil, err
+		}
+
+		data = aead.Seal(nonce, nonce, data, nil)
+		flags |= flagAESGCM
+	}
+
+	return append([]byte{valueHeader, flags}, data...), nil
+}
+
+// decodeValue reverses encodeValue, returning the marshalled document of a
+// stored value.
+func (t *Table) decodeValue(raw []byte) ([]byte, error) {
+	data, _, err := t.decodeValueMeta(raw)
+	return data, err
+}
+
+// decodeValueMeta reverses encodeValue, returning the marshalled document of
+// a stored value, migrated to the schema version of the table, and its
+// metadata. The metadata is the zero Meta if the value was stored without
+// metadata.
+func (t *Table) decodeValueMeta(raw []byte) ([]byte, Meta, error) {
+	data, meta, version, err := t.decodeValueVersion(raw)
+	if err != nil {
+		return nil, Meta{}, err
+	}
+
+	data, err = t.migrate(data, version)
+	return data, meta, err
+}
+
+// decodeValueVersion reverses encodeValue, returning the marshalled document
+// of a stored value without migrating it, its metadata, and its schema
+// version, which is 0 if the value was stored without one.
+func (t *Table) decodeValueVersion(raw []byte) ([]byte, Meta, int, error) {
+	if len(raw) == 0 || raw[0] != valueHeader {
+		return raw, Meta{}, 0, nil
+	}
+
+	if len(raw) < 2 {
+		return nil, Meta{}, 0, errBadValue
+	}
+
+	flags, data := raw[1], raw[2:]
+
+	if flags&flagAESGCM != 0 {
+		aead := t.db.aead()
+		if aead == nil {
+			return nil, Meta{}, 0, ErrNoEncryptionKey
+		}
+
+		if len(data) < aead.NonceSize() {
+			return nil, Meta{}, 0, errBadValue
+		}
+
+		var err error
+		data, err = aead.Open(nil, data[:aead.NonceSize()],
+			data[aead.NonceSize():], nil)
+		if err != nil {
+			return nil, Meta{}, 0, err
+		}
+	}
+
+	if flags&flagFlate != 0 {
+		r := flate.NewReader(bytes.NewReader(data))
+		defer r.Close()
+
+		var err error
+		data, err = ioutil.ReadAll(r)
+		if err != nil {
+			return nil, Meta{}, 0, err
+		}
+	}
+
+	var version int
+	if flags&flagVersion != 0 {
+		if len(data) < 1 {
+			return nil, Meta{}, 0, errBadValue
+		}
+
+		version, data = int(data[0]), data[1:]
+	}
+
+	if flags&flagMeta == 0 {
+		return data, Meta{}, version, nil
+	}
+
+	if len(data) < metaSize {
+		return nil, Meta{}, 0, errBadValue
+	}
+
+	return data[metaSize:], decodeMeta(data[:metaSize]), version, nil
+}
+
+// itemData returns the marshalled document of the item, or nil if the item
+// does not exist.
+func (t *Table) itemData(item *badger.KVItem) ([]byte, error) {
+	itemValue := getItemValue(item)
+	if itemValue == nil {
+		return nil, nil
+	}
+
+	return t.decodeValue(itemValue)
+}
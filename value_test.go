@@ -0,0 +1,439 @@
+package jvzc
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/1lann/badger"
+)
+
+func TestValueCompression(t *testing.T) {
+	if testing.Short() {
+		t.Parallel()
+	}
+
+	dir, err := ioutil.TempDir("", "jvzc_")
+	panicNotNil(err)
+
+	t.Log("testing directory:", dir)
+	defer func() {
+		if !t.Failed() {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	db, err := Open(dir + "/data")
+	panicNotNil(err)
+
+	panicNotNil(db.NewTable("compression_testing"))
+	panicNotNil(db.Table("compression_testing").NewIndex("City"))
+
+	legacy := Person{Name: "Ben", City: "Melbourne", Age: 19}
+	panicNotNil(db.Table("compression_testing").Set("ben", legacy))
+
+	panicNotNil(db.Table("compression_testing").SetCompression(FlateCompression))
+
+	large := Person{
+		Name: strings.Repeat("Jason", 1000),
+		City: "Sydney",
+		Age:  18,
+	}
+	panicNotNil(db.Table("compression_testing").Set("jason", large))
+
+	raw := storedValue(db.Table("compression_testing"), "jason")
+	if raw[0] != valueHeader || len(raw) > 1000 {
+		t.Fatal("value should be compressed, but isn't")
+	}
+
+	db.Close()
+
+	db, err = Open(dir + "/data")
+	panicNotNil(err)
+
+	defer db.Close()
+
+	var person Person
+	_, err = db.Table("compression_testing").Get("jason", &person)
+	panicNotNil(err)
+
+	if !person.IsSame(large) {
+		t.Fatal("person should be jason, but isn't")
+	}
+
+	_, err = db.Table("compression_testing").Get("ben", &person)
+	panicNotNil(err)
+
+	if !person.IsSame(legacy) {
+		t.Fatal("person should be ben, but isn't")
+	}
+
+	r := db.Table("compression_testing").All()
+	expectPerson("ben", r, legacy)
+	expectPerson("jason", r, large)
+
+	if r.Next() || r.Error() != ErrEndOfRange {
+		t.Fatal("error should be ErrEndOfRange, but isn't")
+	}
+
+	_, _, err = db.Table("compression_testing").Index("City").One("Sydney",
+		&person)
+	panicNotNil(err)
+
+	if !person.IsSame(large) {
+		t.Fatal("person should be jason, but isn't")
+	}
+
+	panicNotNil(db.Table("compression_testing").Delete("jason"))
+
+	_, _, err = db.Table("compression_testing").Index("City").One("Sydney",
+		&person)
+	if err != ErrNotFound {
+		t.Fatal("error should be ErrNotFound, but isn't")
+	}
+}
+
+func storedValue(t *Table, key string) []byte {
+	var item badger.KVItem
+	panicNotNil(t.data.Get([]byte(key), &item))
+	return getItemValue(&item)
+}
+
+func TestValueEncryption(t *testing.T) {
+	if testing.Short() {
+		t.Parallel()
+	}
+
+	dir, err := ioutil.TempDir("", "jvzc_")
+	panicNotNil(err)
+
+	t.Log("testing directory:", dir)
+	defer func() {
+		if !t.Failed() {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	key := []byte("0123456789abcdef0123456789abcdef")
+
+	db, err := Open(dir + "/data")
+	panicNotNil(err)
+
+	panicNotNil(db.SetEncryptionKey(key))
+	panicNotNil(db.NewTable("encryption_testing"))
+	panicNotNil(db.Table("encryption_testing").NewIndex("City"))
+	panicNotNil(db.Table("encryption_testing").SetCompression(FlateCompression))
+
+	jason := Person{Name: "Jason", City: "Sydney", Age: 18}
+	panicNotNil(db.Table("encryption_testing").Set("jason", jason))
+
+	raw := storedValue(db.Table("encryption_testing"), "jason")
+	if raw[0] != valueHeader || raw[1] != flagFlate|flagAESGCM {
+		t.Fatal("value should be compressed and encrypted, but isn't")
+	}
+
+	if strings.Contains(string(raw), "Sydney") {
+		t.Fatal("value should not contain plaintext, but does")
+	}
+
+	db.Close()
+
+	db, err = Open(dir + "/data")
+	panicNotNil(err)
+
+	var person Person
+	_, err = db.Table("encryption_testing").Get("jason", &person)
+	if err != ErrNoEncryptionKey {
+		t.Fatal("error should be ErrNoEncryptionKey, but isn't")
+	}
+
+	panicNotNil(db.SetEncryptionKey([]byte("fedcba9876543210fedcba9876543210")))
+
+	_, err = db.Table("encryption_testing").Get("jason", &person)
+	if err == nil {
+		t.Fatal("get with the wrong key should fail, but doesn't")
+	}
+
+	panicNotNil(db.SetEncryptionKey(key))
+
+	_, err = db.Table("encryption_testing").Get("jason", &person)
+	panicNotNil(err)
+
+	if !person.IsSame(jason) {
+		t.Fatal("person should be jason, but isn't")
+	}
+
+	person = Person{}
+	_, _, err = db.Table("encryption_testing").Index("City").One("Sydney",
+		&person)
+	panicNotNil(err)
+
+	if !person.IsSame(jason) {
+		t.Fatal("person should be jason, but isn't")
+	}
+
+	db.Close()
+}
+
+func TestTableMetadata(t *testing.T) {
+	if testing.Short() {
+		t.Parallel()
+	}
+
+	dir, err := ioutil.TempDir("", "jvzc_")
+	panicNotNil(err)
+
+	t.Log("testing directory:", dir)
+	defer func() {
+		if !t.Failed() {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	db, err := Open(dir + "/data")
+	panicNotNil(err)
+
+	panicNotNil(db.NewTable("meta_testing"))
+	table := db.Table("meta_testing")
+	panicNotNil(table.NewIndex("City"))
+
+	panicNotNil(table.Set("old", Person{Name: "Old", City: "Sydney"}))
+
+	panicNotNil(table.SetMetadata(true))
+	panicNotNil(db.SetEncryptionKey([]byte(strings.Repeat("k", 32))))
+	panicNotNil(table.SetCompression(FlateCompression))
+
+	jason := Person{Name: "Jason", City: "Sydney", Age: 18}
+	panicNotNil(table.Set("jason", jason))
+
+	meta, err := table.Meta("old")
+	panicNotNil(err)
+
+	if !meta.CreatedAt.IsZero() {
+		t.Fatal("old document should have no metadata, but has", meta)
+	}
+
+	created, err := table.Meta("jason")
+	panicNotNil(err)
+
+	if created.CreatedAt.IsZero() || !created.UpdatedAt.Equal(created.CreatedAt) {
+		t.Fatal("new document metadata should be set, but is", created)
+	}
+
+	time.Sleep(time.Millisecond)
+	jason.Age = 19
+	panicNotNil(table.Set("jason", jason))
+
+	db.Close()
+
+	db, err = Open(dir + "/data")
+	panicNotNil(err)
+
+	defer db.Close()
+
+	panicNotNil(db.SetEncryptionKey([]byte(strings.Repeat("k", 32))))
+	table = db.Table("meta_testing")
+
+	updated, err := table.Meta("jason")
+	panicNotNil(err)
+
+	if !updated.CreatedAt.Equal(created.CreatedAt) ||
+		!updated.UpdatedAt.After(created.UpdatedAt) {
+		t.Fatal("updated document metadata should be updated, but is", updated)
+	}
+
+	modified, err := table.ModifiedAt("jason")
+	panicNotNil(err)
+
+	if !modified.Equal(updated.UpdatedAt) {
+		t.Fatal("modified time should be", updated.UpdatedAt, "but is",
+			modified)
+	}
+
+	modified, err = table.ModifiedAt("old")
+	panicNotNil(err)
+
+	if !modified.IsZero() {
+		t.Fatal("old document should have no modified time, but has",
+			modified)
+	}
+
+	var person Person
+	_, err = table.Get("jason", &person)
+	panicNotNil(err)
+
+	if !person.IsSame(jason) {
+		t.Fatal("person should be jason, but isn't")
+	}
+
+	n, err := table.Index("City").GetAll("Sydney").Count()
+	panicNotNil(err)
+
+	if n != 2 {
+		t.Fatal("count should be 2, but is", n)
+	}
+
+	if _, err = table.Meta("nobody"); err != ErrNotFound {
+		t.Fatal("error should be ErrNotFound, but is", err)
+	}
+
+	if _, err = table.ModifiedAt("nobody"); err != ErrNotFound {
+		t.Fatal("error should be ErrNotFound, but is", err)
+	}
+}
+
+func TestTableArrayEncoding(t *testing.T) {
+	if testing.Short() {
+		t.Parallel()
+	}
+
+	dir, err := ioutil.TempDir("", "jvzc_")
+	panicNotNil(err)
+
+	t.Log("testing directory:", dir)
+	defer func() {
+		if !t.Failed() {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	db, err := Open(dir + "/data")
+	panicNotNil(err)
+
+	panicNotNil(db.NewTable("indexed_testing"))
+	indexed := db.Table("indexed_testing")
+	panicNotNil(indexed.NewIndex("City"))
+
+	if err = indexed.SetArrayEncoding(true); err != errArrayEncoding {
+		t.Fatal("error should be errArrayEncoding, but is", err)
+	}
+
+	panicNotNil(db.NewTable("compressed_testing"))
+	if err = db.Table("compressed_testing").SetArrayEncoding(true); err == nil {
+		t.Fatal("key compressed table should not allow array encoding, " +
+			"but does")
+	}
+
+	panicNotNil(db.NewTable("array_testing", false))
+	table := db.Table("array_testing")
+	panicNotNil(table.SetArrayEncoding(true))
+
+	if err = table.NewIndex("City"); err != errArrayEncoding {
+		t.Fatal("error should be errArrayEncoding, but is", err)
+	}
+
+	jason := Person{Name: "Jason", City: "Sydney", Age: 18}
+	panicNotNil(indexed.Set("jason", jason))
+	panicNotNil(table.Set("jason", jason))
+
+	mapData, err := indexed.getData("jason")
+	panicNotNil(err)
+	arrayData, err := table.getData("jason")
+	panicNotNil(err)
+
+	if len(arrayData) >= len(mapData) {
+		t.Fatal("array encoded document should be smaller, but is",
+			len(arrayData), "bytes compared to", len(mapData))
+	}
+
+	db.Close()
+
+	db, err = Open(dir + "/data")
+	panicNotNil(err)
+
+	defer db.Close()
+
+	table = db.Table("array_testing")
+	if !table.Config().ArrayEncoding {
+		t.Fatal("array encoding should be enabled, but isn't")
+	}
+
+	var person Person
+	_, err = table.Get("jason", &person)
+	panicNotNil(err)
+
+	if !person.IsSame(jason) {
+		t.Fatal("person should be jason, but isn't")
+	}
+
+	panicNotNil(table.SetArrayEncoding(false))
+	panicNotNil(table.Set("jason", jason))
+	panicNotNil(table.NewIndex("City"))
+
+	r := table.Index("City").GetAll("Sydney")
+	expectPerson("jason", r, jason)
+	r.Close()
+}
+
+func TestTableMaxValueSize(t *testing.T) {
+	if testing.Short() {
+		t.Parallel()
+	}
+
+	dir, err := ioutil.TempDir("", "jvzc_")
+	panicNotNil(err)
+
+	t.Log("testing directory:", dir)
+	defer func() {
+		if !t.Failed() {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	db, err := Open(dir + "/data")
+	panicNotNil(err)
+
+	panicNotNil(db.NewTable("size_testing"))
+	table := db.Table("size_testing")
+	panicNotNil(table.NewIndex("City"))
+	panicNotNil(table.SetMaxValueSize(100))
+
+	jason := Person{Name: "Jason", City: "Sydney", Age: 18}
+	panicNotNil(table.Set("jason", jason))
+
+	large := Person{Name: "Jason", City: "Sydney", Data: make([]byte, 100)}
+	if err = table.Set("large", large); err != ErrValueTooLarge {
+		t.Fatal("error should be ErrValueTooLarge, but is", err)
+	}
+
+	err = table.Update("jason", func(p Person) (Person, error) {
+		p.Data = make([]byte, 100)
+		return p, nil
+	})
+	if err != ErrValueTooLarge {
+		t.Fatal("error should be ErrValueTooLarge, but is", err)
+	}
+
+	if _, err = table.Get("large", nil); err != ErrNotFound {
+		t.Fatal("large document should not be written, but is")
+	}
+
+	db.Close()
+
+	db, err = Open(dir + "/data")
+	panicNotNil(err)
+
+	defer db.Close()
+
+	table = db.Table("size_testing")
+	if table.Config().MaxValueSize != 100 {
+		t.Fatal("maximum value size should be 100, but is",
+			table.Config().MaxValueSize)
+	}
+
+	if err = table.Set("large", large); err != ErrValueTooLarge {
+		t.Fatal("error should be ErrValueTooLarge, but is", err)
+	}
+
+	panicNotNil(table.SetMaxValueSize(0))
+	panicNotNil(table.Set("large", large))
+
+	n, err := table.Index("City").GetAll("Sydney").Count()
+	panicNotNil(err)
+
+	if n != 2 {
+		t.Fatal("count should be 2, but is", n)
+	}
+}
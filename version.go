@@ -0,0 +1,30 @@
+package jvzc
+
+// Version is the version of a document, used for optimistic locking. It is
+// the counter returned by Get and accepted by Set and Delete, as a distinct
+// type so that it cannot be confused with other integers. The version changes
+// every time the document is written.
+type Version uint64
+
+// Absent is the Version of a document which doesn't exist. Setting a document
+// with the Absent version only sets it if it doesn't already exist.
+const Absent Version = 0
+
+// GetVersion is like Get, but returns the Version of the document.
+func (t *Table) GetVersion(key string, dst interface{}) (Version, error) {
+	counter, err := t.Get(key, dst)
+	return Version(counter), err
+}
+
+// SetVersion is like Set, but only sets the value if the document is still at
+// the given version. ErrCounterChanged will be returned if it isn't.
+func (t *Table) SetVersion(key string, value interface{},
+	version Version) error {
+	return t.Set(key, value, uint64(version))
+}
+
+// DeleteVersion is like Delete, but only deletes the document if it is still
+// at the given version. ErrCounterChanged will be returned if it isn't.
+func (t *Table) DeleteVersion(key string, version Version) error {
+	return t.Delete(key, uint64(version))
+}
@@ -0,0 +1,98 @@
+package jvzc
+
+import (
+	"log"
+	"runtime/debug"
+)
+
+// WarningCode identifies the kind of problem reported by a Warning.
+type WarningCode int
+
+// Warning codes that may be reported to DB.OnWarning.
+const (
+	// CorruptIndex is reported when the entries of an index are found to be
+	// inconsistent with the documents in its table.
+	CorruptIndex WarningCode = iota + 1
+	// IndexUpdateFailed is reported when an index could not be updated
+	// after a document was written or deleted.
+	IndexUpdateFailed
+	// InvalidBounds is reported when a range is requested with bounds of an
+	// unsupported type. An empty result is returned instead.
+	InvalidBounds
+	// MissingCompressedKey is reported when a document contains a compressed
+	// field name which does not exist in the table's key compression map.
+	MissingCompressedKey
+	// LeakedRange is reported when a range is garbage collected without
+	// being closed. It is only reported if DB.Debug is set.
+	LeakedRange
+	// MissingIndexField is reported when an index is created on a field
+	// which none of the sampled documents of its table contain.
+	MissingIndexField
+	// ChangeLogFailed is reported when a change could not be recorded in the
+	// change log of a table.
+	ChangeLogFailed
+	// UnindexableDocument is reported when the indexed field of a document
+	// could not be queried, such as if the document isn't a map, so the
+	// document is missing from the index.
+	UnindexableDocument
+)
+
+var warningDescriptions = map[WarningCode]string{
+	CorruptIndex:         "corrupt index detected",
+	IndexUpdateFailed:    "error while updating index, index likely corrupt",
+	InvalidBounds:        "bounds must be a string or Bounds",
+	MissingCompressedKey: "failed to decompress non-existent compressed key",
+	LeakedRange:          "range garbage collected without being closed",
+	MissingIndexField:    "indexed field not found in sampled documents",
+	ChangeLogFailed:      "failed to record change in change log",
+	UnindexableDocument:  "failed to query indexed field of document",
+}
+
+// String returns a short description of the warning code.
+func (c WarningCode) String() string {
+	if description, found := warningDescriptions[c]; found {
+		return description
+	}
+
+	return "unknown warning"
+}
+
+// Warning represents a non-fatal problem encountered by the database, such
+// as a corrupt index.
+type Warning struct {
+	Code WarningCode
+	// Name is the name of the table, or "table/index" for an index.
+	Name string
+	// Key is the primary key of the document involved, if any.
+	Key string
+	// Err is the underlying error, if any.
+	Err error
+}
+
+// String returns a human readable representation of the warning.
+func (w Warning) String() string {
+	result := "jvzc: warning: " + w.Code.String() + " in \"" + w.Name + "\""
+	if w.Key != "" {
+		result += " for key \"" + w.Key + "\""
+	}
+
+	if w.Err != nil {
+		result += ": " + w.Err.Error()
+	}
+
+	return result
+}
+
+// warn reports the warning to OnWarning, or logs it if OnWarning is not set.
+func (d *DB) warn(w Warning) {
+	if d.OnWarning != nil {
+		d.OnWarning(w)
+		return
+	}
+
+	log.Println(w.String())
+
+	if w.Code == MissingCompressedKey {
+		log.Println(string(debug.Stack()))
+	}
+}